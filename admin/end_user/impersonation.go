@@ -0,0 +1,238 @@
+package adminuser
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/gorilla/mux"
+	"github.com/hew-team1/all-api-dev/common"
+)
+
+const (
+	defaultImpersonationMinutes = 15
+	maxImpersonationMinutes     = 60
+	maxImpersonationReason      = 500
+)
+
+// ==================== Issue ====================
+type ImpersonationCreateRequest struct {
+	// 操作する管理者（監査ログに残る）
+	Operator   *string `json:"operator"`
+	Reason     *string `json:"reason"`
+	Minutes    *int    `json:"minutes"`
+	AllowWrite bool    `json:"allowWrite"`
+}
+
+type ImpersonationCreateResponse struct {
+	common.Impersonation
+	// "{id}.{secret}"。発行時のみ返す
+	Token string `json:"token"`
+}
+
+func (s *Server) ImpersonationCreate(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	nowTime := now.UTC().In(
+		time.FixedZone("Asia/Tokyo", 9*60*60),
+	).Format("2006-01-02 15:04")
+
+	vars := mux.Vars(r)
+
+	var reqImp ImpersonationCreateRequest
+	if err := json.Unmarshal(common.StreamToByte(r.Body), &reqImp); err != nil {
+		common.WriteError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if reqImp.Operator == nil || *reqImp.Operator == "" {
+		common.WriteError(w, http.StatusBadRequest, "operator is required")
+		return
+	}
+	if reqImp.Reason == nil || *reqImp.Reason == "" {
+		common.WriteError(w, http.StatusBadRequest, "reason is required")
+		return
+	}
+	if utf8.RuneCountInString(*reqImp.Reason) > maxImpersonationReason {
+		common.WriteError(w, http.StatusBadRequest, fmt.Sprintf("reason must be at most %d characters", maxImpersonationReason))
+		return
+	}
+	minutes := defaultImpersonationMinutes
+	if reqImp.Minutes != nil {
+		if *reqImp.Minutes < 1 || *reqImp.Minutes > maxImpersonationMinutes {
+			common.WriteError(w, http.StatusBadRequest, fmt.Sprintf("minutes must be 1 to %d", maxImpersonationMinutes))
+			return
+		}
+		minutes = *reqImp.Minutes
+	}
+
+	// 退会済みのユーザーには発行しない（停止中は問い合わせ対応のため発行できる）
+	result, err := s.db.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String(s.tables.EndUsers),
+		Key: map[string]*dynamodb.AttributeValue{
+			"uid": {
+				S: aws.String(vars["uid"]),
+			},
+		},
+		ProjectionExpression: aws.String("#uid, #deleted"),
+		ExpressionAttributeNames: map[string]*string{
+			"#uid":     aws.String("uid"),
+			"#deleted": aws.String("deletedAt"),
+		},
+	})
+	if err != nil {
+		common.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if result.Item == nil || result.Item["deletedAt"] != nil {
+		common.WriteError(w, http.StatusNotFound, errUserNotFound.Error())
+		return
+	}
+
+	id, err := common.RandomHex(8)
+	if err != nil {
+		common.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	secret, err := common.RandomHex(32)
+	if err != nil {
+		common.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	imp := common.Impersonation{
+		Id:         id,
+		SecretHash: common.HashSecret(secret),
+		Uid:        vars["uid"],
+		Operator:   *reqImp.Operator,
+		Reason:     *reqImp.Reason,
+		AllowWrite: reqImp.AllowWrite,
+		Created:    nowTime,
+		ExpiresAt:  now.Add(time.Duration(minutes) * time.Minute).Unix(),
+	}
+	av, err := dynamodbattribute.MarshalMap(imp)
+	if err != nil {
+		common.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	_, err = s.db.PutItem(&dynamodb.PutItemInput{
+		TableName:           aws.String(s.tables.Impersonations),
+		Item:                av,
+		ConditionExpression: aws.String("attribute_not_exists(#id)"),
+		ExpressionAttributeNames: map[string]*string{
+			"#id": aws.String("id"),
+		},
+	})
+	if err != nil {
+		common.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// 監査ログ（トークンは残さない）
+	j, _ := json.Marshal(imp)
+	fmt.Println("[impersonation] issued", string(j))
+
+	j, _ = json.Marshal(ImpersonationCreateResponse{
+		Impersonation: imp,
+		Token:         id + "." + secret,
+	})
+	w.WriteHeader(http.StatusCreated)
+	w.Write(j)
+}
+
+// ==================== AllGet ====================
+type ImpersonationList []common.Impersonation
+
+func (l ImpersonationList) Len() int {
+	return len(l)
+}
+func (l ImpersonationList) Swap(i, j int) {
+	l[i], l[j] = l[j], l[i]
+}
+func (l ImpersonationList) Less(i, j int) bool {
+	return l[i].Created > l[j].Created
+}
+
+// 有効なトークンの一覧（期限切れはTTLで削除される）
+func (s *Server) ImpersonationAllGet(w http.ResponseWriter, r *http.Request) {
+	param := &dynamodb.ScanInput{
+		TableName:        aws.String(s.tables.Impersonations),
+		FilterExpression: aws.String("#expires > :now"),
+		ExpressionAttributeNames: map[string]*string{
+			"#expires": aws.String("expiresAt"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":now": {N: aws.String(strconv.FormatInt(time.Now().Unix(), 10))},
+		},
+	}
+	if uid := r.URL.Query().Get("uid"); uid != "" {
+		param.FilterExpression = aws.String("#expires > :now AND #uid = :uid")
+		param.ExpressionAttributeNames["#uid"] = aws.String("uid")
+		param.ExpressionAttributeValues[":uid"] = &dynamodb.AttributeValue{S: aws.String(uid)}
+	}
+
+	list := make(ImpersonationList, 0)
+	var unmarshalErr error
+	err := s.db.ScanPages(param, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+		var items ImpersonationList
+		if unmarshalErr = dynamodbattribute.UnmarshalListOfMaps(page.Items, &items); unmarshalErr != nil {
+			return false
+		}
+		list = append(list, items...)
+		return true
+	})
+	if err == nil {
+		err = unmarshalErr
+	}
+	if err != nil {
+		common.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	sort.Sort(list)
+
+	j, _ := json.Marshal(list)
+	w.Write(j)
+
+	// 取得値のログ
+	fmt.Println(string(j))
+}
+
+// ==================== Revoke ====================
+func (s *Server) ImpersonationRevoke(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	result, err := s.db.DeleteItem(&dynamodb.DeleteItemInput{
+		TableName: aws.String(s.tables.Impersonations),
+		Key: map[string]*dynamodb.AttributeValue{
+			"id": {
+				S: aws.String(vars["id"]),
+			},
+		},
+		ConditionExpression: aws.String("attribute_exists(#id)"),
+		ExpressionAttributeNames: map[string]*string{
+			"#id": aws.String("id"),
+		},
+		ReturnValues: aws.String("ALL_OLD"),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			common.WriteError(w, http.StatusNotFound, "impersonation not found")
+			return
+		}
+		common.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var imp common.Impersonation
+	dynamodbattribute.UnmarshalMap(result.Attributes, &imp)
+	j, _ := json.Marshal(imp)
+
+	// 監査ログ
+	fmt.Println("[impersonation] revoked", string(j))
+	w.WriteHeader(http.StatusNoContent)
+}
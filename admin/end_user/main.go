@@ -1,69 +1,64 @@
-package main
+package adminuser
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
-	"io"
-	"log"
 	"net/http"
-	"os"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/credentials"
-	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
 	"github.com/gorilla/mux"
-	"github.com/rs/cors"
+	"github.com/hew-team1/all-api-dev/admin/moderation"
+	"github.com/hew-team1/all-api-dev/common"
 )
 
-func main() {
-	sess, _ := session.NewSession(&aws.Config{
-		Region:      aws.String(os.Getenv("REGION")),
-		Endpoint:    aws.String(os.Getenv("ENDPOINT_DB")),
-		Credentials: credentials.NewStaticCredentials(os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY"), ""),
-	})
+// Admin EndUserAPIのルートをrに登録し、期限を過ぎた一時停止の解除を開始する
+func Mount(r *mux.Router, cfg *common.Config) error {
+	sess, err := cfg.Session(cfg.Endpoints.DB)
+	if err != nil {
+		return err
+	}
 	db := dynamodb.New(sess)
-	server := NewServer(db)
+	reasons, err := moderation.LoadReasonCodes(cfg.ModerationReasonsFile)
+	if err != nil {
+		return err
+	}
+	server := NewServer(db, reasons, cfg)
 
-	r := mux.NewRouter()
 	r.HandleFunc("/admin/users", server.UserAllGet).Methods("GET")
 	r.HandleFunc("/admin/users/active", server.UserActive).Methods("PUT")
-	c := cors.New(cors.Options{
-		AllowedOrigins: []string{"*"},
-		AllowedHeaders: []string{"*"},
-		AllowedMethods: []string{
-			http.MethodHead,
-			http.MethodGet,
-			http.MethodPost,
-			http.MethodPatch,
-			http.MethodPut,
-			http.MethodDelete,
-		},
-	}).Handler(r)
-
-	fmt.Println("サーバー起動 : 60011 port で受信")
-
-	// log.Fatal は、異常を検知すると処理の実行を止めてくれる
-	log.Fatal(http.ListenAndServe(":60011", c))
-}
-
-// io.Readerをbyteのスライスに変換
-func StreamToByte(stream io.Reader) []byte {
-	buf := new(bytes.Buffer)
-	buf.ReadFrom(stream)
-	return buf.Bytes()
+	r.HandleFunc("/admin/users/bulk-active", server.UserBulkActive).Methods("POST")
+	r.HandleFunc("/admin/users/reasons", server.ReasonAllGet).Methods("GET")
+	r.HandleFunc("/admin/users/export", server.UserExport).Methods("GET")
+	r.HandleFunc("/admin/users/{uid}/impersonate", server.ImpersonationCreate).Methods("POST")
+	r.HandleFunc("/admin/users/{uid}/restore", server.UserRestore).Methods("POST")
+	r.HandleFunc("/admin/impersonations", server.ImpersonationAllGet).Methods("GET")
+	r.HandleFunc("/admin/impersonations/{id}", server.ImpersonationRevoke).Methods("DELETE")
+	r.HandleFunc("/admin/reports", server.ReportAllGet).Methods("GET")
+	r.HandleFunc("/admin/reports/{id}", server.ReportUpdate).Methods("PATCH")
+	r.HandleFunc("/admin/stats", server.StatsGet).Methods("GET")
+	r.HandleFunc("/admin/stats/rebuild", server.StatsRebuild).Methods("POST")
+
+	// 期限を過ぎた一時停止の解除
+	go server.LiftExpiredSuspensions(time.Minute)
+	return nil
 }
 
-func NewServer(db *dynamodb.DynamoDB) *Server {
+func NewServer(db *dynamodb.DynamoDB, reasons []moderation.ReasonCode, cfg *common.Config) *Server {
 	return &Server{
-		db: db,
+		db:      db,
+		reasons: reasons,
+		tables:  cfg.Tables,
 	}
 }
 
 type Server struct {
-	db *dynamodb.DynamoDB
+	db     *dynamodb.DynamoDB
+	tables common.Tables
+	// 停止・再開の理由コード
+	reasons []moderation.ReasonCode
 }
 
 // ==================== ALLGet ====================
@@ -76,19 +71,45 @@ type UserAllGetResponse struct {
 	Updated  *string `json:"updated,omitempty" dynamodbav:"updated,omitempty"`
 	IsLogin  bool    `json:"isLogin" dynamodbav:"isLogin"`
 	IsActive bool    `json:"isActive" dynamodbav:"isActive"`
+	// 直近の停止・再開の理由
+	ModerationReason *string `json:"moderationReason,omitempty" dynamodbav:"moderationReason,omitempty"`
+	ModerationNote   *string `json:"moderationNote,omitempty" dynamodbav:"moderationNote,omitempty"`
+	Moderated        *string `json:"moderated,omitempty" dynamodbav:"moderated,omitempty"`
+	SuspendedUntil   *int64  `json:"suspendedUntil,omitempty" dynamodbav:"suspendedUntil,omitempty"`
+	// 退会済みの場合（?includeDeleted=true）
+	DeletedAt *string `json:"deletedAt,omitempty" dynamodbav:"deletedAt,omitempty"`
+	DeletedBy *string `json:"deletedBy,omitempty" dynamodbav:"deletedBy,omitempty"`
+	PurgeAt   *int64  `json:"purgeAt,omitempty" dynamodbav:"purgeAt,omitempty"`
 }
 
 func (s *Server) UserAllGet(w http.ResponseWriter, r *http.Request) {
 
-	tableName := "EndUsers"
+	tableName := s.tables.EndUsers
 
 	param := &dynamodb.ScanInput{
 		TableName: aws.String(tableName),
 	}
+	// 退会済みのユーザーは既定では含めない
+	if !common.IncludeDeleted(r) {
+		param.FilterExpression = aws.String("attribute_not_exists(#D)")
+		param.ExpressionAttributeNames = map[string]*string{
+			"#D": aws.String("deletedAt"),
+		}
+	}
 	result, _ := s.db.Scan(param)
 
 	var resUser []UserAllGetResponse
 	dynamodbattribute.UnmarshalListOfMaps(result.Items, &resUser)
+
+	// セッションはTTLで期限切れになるため、保存されたisLoginではなく有効なセッションの有無を返す
+	loggedIn, err := common.LoggedInUids(s.db, s.tables)
+	if err != nil {
+		common.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	for i := range resUser {
+		resUser[i].IsLogin = loggedIn[aws.StringValue(resUser[i].Uid)]
+	}
 	j, _ := json.Marshal(resUser)
 	w.Write(j)
 
@@ -100,31 +121,37 @@ func (s *Server) UserAllGet(w http.ResponseWriter, r *http.Request) {
 type UserUpdateRequest struct {
 	Uid      *string `json:"uid,omitempty" dynamodbav:"uid,omitempty"`
 	IsActive bool    `json:"isActive" dynamodbav:"isActive"`
+	// 募集者のボードも合わせて停止・再開するか
+	Cascade bool `json:"cascade" dynamodbav:"-"`
+	// 理由は任意（指定する場合は理由コードが必須）
+	moderation.Moderation
 }
 
 func (s *Server) UserActive(w http.ResponseWriter, r *http.Request) {
 	var reqUser UserUpdateRequest
-	json.Unmarshal(StreamToByte(r.Body), &reqUser)
+	json.Unmarshal(common.StreamToByte(r.Body), &reqUser)
+	if reqUser.Uid == nil {
+		common.WriteError(w, http.StatusBadRequest, "uid is required")
+		return
+	}
 
-	tableName := "EndUsers"
-	param := &dynamodb.UpdateItemInput{
-		TableName: aws.String(tableName),
-		Key: map[string]*dynamodb.AttributeValue{
-			"uid": {
-				S: aws.String(*reqUser.Uid),
-			},
-		},
-		UpdateExpression: aws.String("set #A = :a"),
-		ExpressionAttributeNames: map[string]*string{
-			"#A": aws.String("isActive"),
-		},
-		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
-			":a": {
-				BOOL: &reqUser.IsActive,
-			},
-		},
+	var m *moderation.Moderation
+	if reqUser.Reason != nil || reqUser.Note != nil || reqUser.ExpiresAt != nil {
+		if err := moderation.Validate(s.reasons, &reqUser.Moderation, reqUser.IsActive); err != nil {
+			common.WriteError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		m = &reqUser.Moderation
+	}
+
+	if err := s.SetUserActive(*reqUser.Uid, reqUser.IsActive, reqUser.Cascade, m); err != nil {
+		if err == errUserNotFound {
+			common.WriteError(w, http.StatusNotFound, err.Error())
+		} else {
+			common.WriteError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
 	}
-	_, _ = s.db.UpdateItem(param)
 
 	j, _ := json.Marshal(reqUser)
 	// 変更値のログ
@@ -0,0 +1,183 @@
+package adminuser
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/hew-team1/all-api-dev/admin/moderation"
+	"github.com/hew-team1/all-api-dev/common"
+)
+
+const maxBulkItems = 100
+
+// uidの停止・再開（停止時は強制ログアウトし、cascadeならボードも連動させる）
+func (s *Server) SetUserActive(uid string, isActive, cascade bool, m *moderation.Moderation) error {
+	expr, names, values := moderation.Update(isActive, m)
+	names["#uid"] = aws.String("uid")
+	names["#deleted"] = aws.String("deletedAt")
+	// 退会済みのユーザーは対象外
+	result, err := s.db.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName: aws.String(s.tables.EndUsers),
+		Key: map[string]*dynamodb.AttributeValue{
+			"uid": {
+				S: aws.String(uid),
+			},
+		},
+		ConditionExpression:       aws.String("attribute_exists(#uid) AND attribute_not_exists(#deleted)"),
+		UpdateExpression:          aws.String(expr),
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
+		ReturnValues:              aws.String("UPDATED_OLD"),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			return errUserNotFound
+		}
+		return err
+	}
+	if moderation.WasActive(result.Attributes) != isActive {
+		s.AddStats(map[string]int{common.StatUsersSuspended: moderation.InactiveDelta(isActive)})
+	}
+
+	// 停止したユーザーは強制的にログアウトさせる
+	if !isActive {
+		n, err := s.ForceLogout(uid)
+		if err != nil {
+			return err
+		}
+		fmt.Println("revoked sessions:", n)
+	}
+	if cascade {
+		ids, err := s.CascadeRecruits(uid, isActive)
+		if err != nil {
+			return err
+		}
+		fmt.Println("cascaded recruits:", ids)
+	}
+	return nil
+}
+
+var errUserNotFound = fmt.Errorf("user not found")
+
+// ==================== Reasons ====================
+func (s *Server) ReasonAllGet(w http.ResponseWriter, r *http.Request) {
+	j, _ := json.Marshal(s.reasons)
+	w.Write(j)
+}
+
+// ==================== Bulk isActive ====================
+type UserBulkActiveRequest struct {
+	Uids     []string `json:"uids"`
+	IsActive bool     `json:"isActive"`
+	Cascade  bool     `json:"cascade"`
+	moderation.Moderation
+}
+
+type BulkActiveResult struct {
+	Uid   string `json:"uid"`
+	Ok    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+type BulkActiveResponse struct {
+	Succeeded int                `json:"succeeded"`
+	Failed    int                `json:"failed"`
+	Results   []BulkActiveResult `json:"results"`
+}
+
+func (s *Server) UserBulkActive(w http.ResponseWriter, r *http.Request) {
+	var reqBulk UserBulkActiveRequest
+	if err := json.Unmarshal(common.StreamToByte(r.Body), &reqBulk); err != nil {
+		common.WriteError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if len(reqBulk.Uids) == 0 || len(reqBulk.Uids) > maxBulkItems {
+		common.WriteError(w, http.StatusBadRequest, fmt.Sprintf("uids must have 1 to %d items", maxBulkItems))
+		return
+	}
+	if err := moderation.Validate(s.reasons, &reqBulk.Moderation, reqBulk.IsActive); err != nil {
+		common.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	res := BulkActiveResponse{Results: make([]BulkActiveResult, 0, len(reqBulk.Uids))}
+	seen := map[string]bool{}
+	for _, uid := range reqBulk.Uids {
+		if seen[uid] {
+			continue
+		}
+		seen[uid] = true
+
+		result := BulkActiveResult{Uid: uid, Ok: true}
+		if err := s.SetUserActive(uid, reqBulk.IsActive, reqBulk.Cascade, &reqBulk.Moderation); err != nil {
+			result.Ok = false
+			result.Error = err.Error()
+			res.Failed++
+		} else {
+			res.Succeeded++
+		}
+		res.Results = append(res.Results, result)
+	}
+
+	j, _ := json.Marshal(res)
+	w.Write(j)
+
+	// 変更値のログ
+	fmt.Println(string(j))
+}
+
+// ==================== Expire ====================
+// 期限を過ぎた一時停止を定期的に解除する
+func (s *Server) LiftExpiredSuspensions(interval time.Duration) {
+	for {
+		if err := s.liftExpiredSuspensions(time.Now()); err != nil {
+			fmt.Println("Got error lifting suspensions:")
+			fmt.Println(err.Error())
+		}
+		time.Sleep(interval)
+	}
+}
+
+func (s *Server) liftExpiredSuspensions(now time.Time) error {
+	var uids []string
+	err := s.db.ScanPages(&dynamodb.ScanInput{
+		TableName:            aws.String(s.tables.EndUsers),
+		FilterExpression:     aws.String("#A = :a AND #until <= :now"),
+		ProjectionExpression: aws.String("#uid"),
+		ExpressionAttributeNames: map[string]*string{
+			"#A":     aws.String("isActive"),
+			"#until": aws.String("suspendedUntil"),
+			"#uid":   aws.String("uid"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":a":   {BOOL: aws.Bool(false)},
+			":now": {N: aws.String(strconv.FormatInt(now.Unix(), 10))},
+		},
+	}, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+		for _, item := range page.Items {
+			uids = append(uids, aws.StringValue(item["uid"].S))
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, uid := range uids {
+		m := &moderation.Moderation{Reason: aws.String(moderation.ExpiredReasonCode)}
+		// 一時停止に連動して停止したボードも再開する
+		if err := s.SetUserActive(uid, true, true, m); err != nil {
+			return err
+		}
+
+		// 解除のログ
+		fmt.Println("suspension expired:", uid)
+	}
+	return nil
+}
@@ -0,0 +1,313 @@
+package adminuser
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/gorilla/mux"
+	"github.com/hew-team1/all-api-dev/admin/moderation"
+	"github.com/hew-team1/all-api-dev/common"
+)
+
+// 通報の対象
+const (
+	ReportTargetRecruit = "recruit"
+	ReportTargetUser    = "user"
+)
+
+// 通報の状態
+//
+//	open      : 未対応
+//	triaged   : 確認済み・対応中
+//	resolved  : 対応済み（停止などの処分を行った）
+//	dismissed : 対応不要
+const (
+	ReportStatusOpen      = "open"
+	ReportStatusTriaged   = "triaged"
+	ReportStatusResolved  = "resolved"
+	ReportStatusDismissed = "dismissed"
+)
+
+// 状態ごとに変更できる状態
+var reportTransitions = map[string][]string{
+	ReportStatusOpen:    {ReportStatusTriaged, ReportStatusResolved, ReportStatusDismissed},
+	ReportStatusTriaged: {ReportStatusOpen, ReportStatusResolved, ReportStatusDismissed},
+}
+
+var errReportNotFound = fmt.Errorf("report not found")
+
+// 対応時に行った停止・再開の操作
+type ReportAction struct {
+	IsActive bool `json:"isActive" dynamodbav:"isActive"`
+	// 対象がユーザーの場合のみ、募集者のボードも合わせて停止・再開するか
+	Cascade bool `json:"cascade" dynamodbav:"cascade"`
+	moderation.Moderation
+}
+
+// Reportsの項目
+type Report struct {
+	Id          string  `json:"id" dynamodbav:"id"`
+	TargetType  string  `json:"targetType" dynamodbav:"targetType"`
+	TargetId    string  `json:"targetId" dynamodbav:"targetId"`
+	ReporterUid string  `json:"reporterUid" dynamodbav:"reporterUid"`
+	Category    string  `json:"category" dynamodbav:"category"`
+	Detail      *string `json:"detail,omitempty" dynamodbav:"detail,omitempty"`
+	Status      string  `json:"status" dynamodbav:"status"`
+	Created     string  `json:"created" dynamodbav:"created"`
+	Updated     string  `json:"updated" dynamodbav:"updated"`
+	// 管理者の対応
+	AdminNote *string       `json:"adminNote,omitempty" dynamodbav:"adminNote,omitempty"`
+	Action    *ReportAction `json:"action,omitempty" dynamodbav:"action,omitempty"`
+}
+
+// idの通報を取得（存在しない場合はnil）
+func (s *Server) FindReport(id string) (*Report, error) {
+	result, err := s.db.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String(s.tables.Reports),
+		Key: map[string]*dynamodb.AttributeValue{
+			"id": {
+				S: aws.String(id),
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.Item == nil {
+		return nil, nil
+	}
+
+	var report Report
+	if err := dynamodbattribute.UnmarshalMap(result.Item, &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// 通報の対象に停止・再開の操作を行う
+func (s *Server) ApplyReportAction(report *Report, action *ReportAction) error {
+	switch report.TargetType {
+	case ReportTargetUser:
+		return s.SetUserActive(report.TargetId, action.IsActive, action.Cascade, &action.Moderation)
+	case ReportTargetRecruit:
+		id, err := strconv.Atoi(report.TargetId)
+		if err != nil {
+			return err
+		}
+		return moderation.SetRecruitActive(s.db, s.tables, id, moderation.RecruitChange{
+			IsActive:   action.IsActive,
+			Moderation: &action.Moderation,
+		})
+	}
+	return fmt.Errorf("unknown target type %q", report.TargetType)
+}
+
+// ==================== AllGet ====================
+// 古い順（対応待ちの順）
+type ReportList []Report
+
+func (r ReportList) Len() int {
+	return len(r)
+}
+func (r ReportList) Swap(i, j int) {
+	r[i], r[j] = r[j], r[i]
+}
+func (r ReportList) Less(i, j int) bool {
+	if r[i].Created != r[j].Created {
+		return r[i].Created < r[j].Created
+	}
+	return r[i].Id < r[j].Id
+}
+
+func (s *Server) ReportAllGet(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	param := &dynamodb.ScanInput{
+		TableName: aws.String(s.tables.Reports),
+	}
+	filters := ""
+	names := map[string]*string{}
+	values := map[string]*dynamodb.AttributeValue{}
+	for _, key := range []string{"status", "targetType", "targetId", "category"} {
+		v := query.Get(key)
+		if v == "" {
+			continue
+		}
+		if filters != "" {
+			filters += " AND "
+		}
+		filters += "#" + key + " = :" + key
+		names["#"+key] = aws.String(key)
+		values[":"+key] = &dynamodb.AttributeValue{S: aws.String(v)}
+	}
+	if filters != "" {
+		param.FilterExpression = aws.String(filters)
+		param.ExpressionAttributeNames = names
+		param.ExpressionAttributeValues = values
+	}
+
+	reports := make(ReportList, 0)
+	var unmarshalErr error
+	err := s.db.ScanPages(param, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+		var items ReportList
+		if unmarshalErr = dynamodbattribute.UnmarshalListOfMaps(page.Items, &items); unmarshalErr != nil {
+			return false
+		}
+		reports = append(reports, items...)
+		return true
+	})
+	if err == nil {
+		err = unmarshalErr
+	}
+	if err != nil {
+		common.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	sort.Sort(reports)
+
+	j, _ := json.Marshal(reports)
+	w.Write(j)
+
+	// 取得値のログ
+	fmt.Println(string(j))
+}
+
+// ==================== Update ====================
+type ReportUpdateRequest struct {
+	Status *string `json:"status"`
+	Note   *string `json:"note"`
+	// resolved にする場合のみ指定できる
+	Action *ReportAction `json:"action"`
+}
+
+func (s *Server) ReportUpdate(w http.ResponseWriter, r *http.Request) {
+	nowTime := time.Now().UTC().In(
+		time.FixedZone("Asia/Tokyo", 9*60*60),
+	).Format("2006-01-02 15:04")
+
+	vars := mux.Vars(r)
+
+	var reqReport ReportUpdateRequest
+	if err := json.Unmarshal(common.StreamToByte(r.Body), &reqReport); err != nil {
+		common.WriteError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if reqReport.Status == nil {
+		common.WriteError(w, http.StatusBadRequest, "status is required")
+		return
+	}
+	if reqReport.Note != nil && utf8.RuneCountInString(*reqReport.Note) > moderation.MaxNote {
+		common.WriteError(w, http.StatusBadRequest, fmt.Sprintf("note must be at most %d characters", moderation.MaxNote))
+		return
+	}
+	if reqReport.Action != nil {
+		if *reqReport.Status != ReportStatusResolved {
+			common.WriteError(w, http.StatusBadRequest, "action can only be set when resolving")
+			return
+		}
+		if err := moderation.Validate(s.reasons, &reqReport.Action.Moderation, reqReport.Action.IsActive); err != nil {
+			common.WriteError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	report, err := s.FindReport(vars["id"])
+	if err != nil {
+		common.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if report == nil {
+		common.WriteError(w, http.StatusNotFound, errReportNotFound.Error())
+		return
+	}
+	allowed := false
+	for _, next := range reportTransitions[report.Status] {
+		if next == *reqReport.Status {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		common.WriteError(w, http.StatusConflict, fmt.Sprintf("cannot change status from %s to %s", report.Status, *reqReport.Status))
+		return
+	}
+
+	// 処分を先に行い、失敗した場合は通報の状態を変えない
+	if reqReport.Action != nil {
+		if err := s.ApplyReportAction(report, reqReport.Action); err != nil {
+			switch err {
+			case errUserNotFound, moderation.ErrRecruitNotFound:
+				common.WriteError(w, http.StatusNotFound, err.Error())
+			default:
+				common.WriteError(w, http.StatusInternalServerError, err.Error())
+			}
+			return
+		}
+	}
+
+	expr := "set #status = :status, #updated = :updated"
+	names := map[string]*string{
+		"#status":  aws.String("status"),
+		"#updated": aws.String("updated"),
+	}
+	values := map[string]*dynamodb.AttributeValue{
+		":status":  {S: reqReport.Status},
+		":updated": {S: aws.String(nowTime)},
+		":current": {S: aws.String(report.Status)},
+	}
+	if reqReport.Note != nil {
+		expr += ", #note = :note"
+		names["#note"] = aws.String("adminNote")
+		values[":note"] = &dynamodb.AttributeValue{S: reqReport.Note}
+	}
+	if reqReport.Action != nil {
+		av, err := dynamodbattribute.Marshal(reqReport.Action)
+		if err != nil {
+			common.WriteError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		expr += ", #action = :action"
+		names["#action"] = aws.String("action")
+		values[":action"] = av
+	}
+
+	// 同時に他の管理者が変更した場合は409
+	result, err := s.db.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName: aws.String(s.tables.Reports),
+		Key: map[string]*dynamodb.AttributeValue{
+			"id": {
+				S: aws.String(report.Id),
+			},
+		},
+		ConditionExpression:       aws.String("#status = :current"),
+		UpdateExpression:          aws.String(expr),
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
+		ReturnValues:              aws.String("ALL_NEW"),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			common.WriteError(w, http.StatusConflict, "report was updated by someone else")
+			return
+		}
+		common.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var updated Report
+	dynamodbattribute.UnmarshalMap(result.Attributes, &updated)
+	j, _ := json.Marshal(updated)
+	w.Write(j)
+
+	// 変更値のログ
+	fmt.Println(string(j))
+}
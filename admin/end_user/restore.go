@@ -0,0 +1,97 @@
+package adminuser
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/gorilla/mux"
+	"github.com/hew-team1/all-api-dev/common"
+)
+
+// ==================== Restore ====================
+// 猶予期間中（EndUsersの行が削除される前）の退会を取り消す
+// 引き継ぎ・匿名化したボードと、取り消したログインは元に戻らない
+func (s *Server) UserRestore(w http.ResponseWriter, r *http.Request) {
+	nowTime := time.Now().UTC().In(
+		time.FixedZone("Asia/Tokyo", 9*60*60),
+	).Format("2006-01-02 15:04")
+
+	uid := mux.Vars(r)["uid"]
+	key := map[string]*dynamodb.AttributeValue{
+		"uid": {
+			S: aws.String(uid),
+		},
+	}
+	current, err := s.db.GetItem(&dynamodb.GetItemInput{
+		TableName:      aws.String(s.tables.EndUsers),
+		Key:            key,
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		common.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if current.Item == nil {
+		common.WriteError(w, http.StatusNotFound, errUserNotFound.Error())
+		return
+	}
+	if current.Item["deletedAt"] == nil {
+		common.WriteError(w, http.StatusConflict, "user is not deleted")
+		return
+	}
+	// ボードの引き継ぎの途中で復元すると、引き継ぎ先と作成者が食い違う
+	if current.Item["deleting"] != nil {
+		common.WriteError(w, http.StatusConflict, "user deletion is in progress")
+		return
+	}
+	// 退会前に停止中だったユーザーは停止中に戻す（記録が無い場合も停止中にする）
+	isActive := current.Item["activeBeforeDelete"] != nil && aws.BoolValue(current.Item["activeBeforeDelete"].BOOL)
+
+	result, err := s.db.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName:           aws.String(s.tables.EndUsers),
+		Key:                 key,
+		ConditionExpression: aws.String("attribute_exists(#deleted) AND attribute_not_exists(#deleting)"),
+		UpdateExpression:    aws.String("set #A = :a, #updated = :updated remove #deleted, #by, #before, #purge"),
+		ExpressionAttributeNames: map[string]*string{
+			"#A":        aws.String("isActive"),
+			"#updated":  aws.String("updated"),
+			"#deleted":  aws.String("deletedAt"),
+			"#by":       aws.String("deletedBy"),
+			"#before":   aws.String("activeBeforeDelete"),
+			"#purge":    aws.String("purgeAt"),
+			"#deleting": aws.String("deleting"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":a":       {BOOL: aws.Bool(isActive)},
+			":updated": {S: aws.String(nowTime)},
+		},
+		ReturnValues: aws.String("ALL_NEW"),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			common.WriteError(w, http.StatusConflict, "user is not deleted")
+			return
+		}
+		common.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	restored := map[string]int{common.StatUsers: 1, common.StatUsersDeleted: -1}
+	if !isActive {
+		restored[common.StatUsersSuspended] = 1
+	}
+	s.AddStats(restored)
+
+	var resUser UserAllGetResponse
+	dynamodbattribute.UnmarshalMap(result.Attributes, &resUser)
+	j, _ := json.Marshal(resUser)
+	w.Write(j)
+
+	// 復元のログ
+	fmt.Println(string(j))
+}
@@ -0,0 +1,10 @@
+package adminuser
+
+import (
+	"github.com/hew-team1/all-api-dev/common"
+)
+
+// uidのセッションを全て削除し、ログアウト状態にする（ユーザーが無い場合はセッションの削除のみ）
+func (s *Server) ForceLogout(uid string) (int, error) {
+	return common.RevokeAllSessions(s.db, s.tables, uid)
+}
@@ -0,0 +1,311 @@
+package adminuser
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/hew-team1/all-api-dev/admin/moderation"
+	"github.com/hew-team1/all-api-dev/common"
+)
+
+const (
+	defaultStatDays = 14
+	maxStatDays     = 90
+)
+
+// カウンターを加算する（統計のみのため、失敗しても処理は止めない）
+func (s *Server) AddStats(deltas map[string]int) {
+	common.AddStats(s.db, s.tables.AtomicCounter, deltas)
+}
+
+// カウンターの値をまとめて取得する（無い項目は0）
+func (s *Server) GetStats(keys []string) (map[string]int, error) {
+	counts := make(map[string]int, len(keys))
+	for start := 0; start < len(keys); start += 100 {
+		end := start + 100
+		if end > len(keys) {
+			end = len(keys)
+		}
+		reqKeys := make([]map[string]*dynamodb.AttributeValue, 0, end-start)
+		for _, key := range keys[start:end] {
+			reqKeys = append(reqKeys, map[string]*dynamodb.AttributeValue{
+				"countKey": {S: aws.String("stats:" + key)},
+			})
+		}
+		items := map[string]*dynamodb.KeysAndAttributes{
+			s.tables.AtomicCounter: {Keys: reqKeys},
+		}
+		for len(items) > 0 {
+			result, err := s.db.BatchGetItem(&dynamodb.BatchGetItemInput{RequestItems: items})
+			if err != nil {
+				return nil, err
+			}
+			for _, item := range result.Responses[s.tables.AtomicCounter] {
+				key := aws.StringValue(item["countKey"].S)[len("stats:"):]
+				if item["countNumber"] != nil {
+					counts[key], _ = strconv.Atoi(aws.StringValue(item["countNumber"].N))
+				}
+			}
+			items = result.UnprocessedKeys
+		}
+	}
+	return counts, nil
+}
+
+// ==================== Get ====================
+type DailyCount struct {
+	Date  string `json:"date"`
+	Count int    `json:"count"`
+}
+
+type UserStats struct {
+	Total     int          `json:"total"`
+	Active    int          `json:"active"`
+	Suspended int          `json:"suspended"`
+	Deleted   int          `json:"deleted"`
+	NewPerDay []DailyCount `json:"newPerDay"`
+	// 停止した数（workerのstatsハンドラーを動かしている場合のみ）
+	SuspendedPerDay []DailyCount `json:"suspendedPerDay"`
+}
+
+type RecruitStats struct {
+	Total     int          `json:"total"`
+	Active    int          `json:"active"`
+	Suspended int          `json:"suspended"`
+	Closed    int          `json:"closed"`
+	Deleted   int          `json:"deleted"`
+	NewPerDay []DailyCount `json:"newPerDay"`
+	// 停止した数（workerのstatsハンドラーを動かしている場合のみ）
+	SuspendedPerDay []DailyCount   `json:"suspendedPerDay"`
+	Positions       map[string]int `json:"positions"`
+	Capacity        int            `json:"capacity"`
+	Members         int            `json:"members"`
+	FillRate        float64        `json:"fillRate"`
+}
+
+type MailStats struct {
+	Sent        int     `json:"sent"`
+	Failed      int     `json:"failed"`
+	SuccessRate float64 `json:"successRate"`
+}
+
+type StatsResponse struct {
+	Users       UserStats    `json:"users"`
+	Recruits    RecruitStats `json:"recruits"`
+	JoinsPerDay []DailyCount `json:"joinsPerDay"`
+	Mail        MailStats    `json:"mail"`
+}
+
+func (s *Server) StatsGet(w http.ResponseWriter, r *http.Request) {
+	days := defaultStatDays
+	if v := r.URL.Query().Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxStatDays {
+			common.WriteError(w, http.StatusBadRequest, fmt.Sprintf("days must be 1 to %d", maxStatDays))
+			return
+		}
+		days = n
+	}
+
+	// 古い順の日付
+	now := time.Now()
+	dates := make([]string, days)
+	for i := range dates {
+		dates[i] = common.StatDate(now.AddDate(0, 0, i-days+1))
+	}
+
+	keys := []string{
+		common.StatUsers, common.StatUsersSuspended, common.StatUsersDeleted,
+		common.StatRecruits, common.StatRecruitsOff, common.StatRecruitsClosed, common.StatRecruitsDeleted, common.StatRecruitsCapacity, common.StatRecruitsMembers,
+		common.StatMailSent, common.StatMailFailed,
+	}
+	for _, p := range common.StatPositions {
+		keys = append(keys, common.StatPosition+p)
+	}
+	for _, date := range dates {
+		keys = append(keys, common.StatUsersNew+date, common.StatRecruitsNew+date, common.StatJoins+date, common.StatUsersSuspendedOn+date, common.StatRecruitsSuspendedOn+date)
+	}
+	counts, err := s.GetStats(keys)
+	if err != nil {
+		common.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	perDay := func(prefix string) []DailyCount {
+		res := make([]DailyCount, 0, len(dates))
+		for _, date := range dates {
+			res = append(res, DailyCount{Date: date, Count: counts[prefix+date]})
+		}
+		return res
+	}
+
+	res := StatsResponse{
+		Users: UserStats{
+			Total:           counts[common.StatUsers],
+			Active:          counts[common.StatUsers] - counts[common.StatUsersSuspended],
+			Suspended:       counts[common.StatUsersSuspended],
+			Deleted:         counts[common.StatUsersDeleted],
+			NewPerDay:       perDay(common.StatUsersNew),
+			SuspendedPerDay: perDay(common.StatUsersSuspendedOn),
+		},
+		Recruits: RecruitStats{
+			Total:           counts[common.StatRecruits],
+			Active:          counts[common.StatRecruits] - counts[common.StatRecruitsOff],
+			Suspended:       counts[common.StatRecruitsOff] - counts[common.StatRecruitsClosed],
+			Closed:          counts[common.StatRecruitsClosed],
+			Deleted:         counts[common.StatRecruitsDeleted],
+			NewPerDay:       perDay(common.StatRecruitsNew),
+			SuspendedPerDay: perDay(common.StatRecruitsSuspendedOn),
+			Positions:       map[string]int{},
+			Capacity:        counts[common.StatRecruitsCapacity],
+			Members:         counts[common.StatRecruitsMembers],
+		},
+		JoinsPerDay: perDay(common.StatJoins),
+		Mail: MailStats{
+			Sent:   counts[common.StatMailSent],
+			Failed: counts[common.StatMailFailed],
+		},
+	}
+	for _, p := range common.StatPositions {
+		res.Recruits.Positions[p] = counts[common.StatPosition+p]
+	}
+	if res.Recruits.Capacity > 0 {
+		res.Recruits.FillRate = float64(res.Recruits.Members) / float64(res.Recruits.Capacity)
+	}
+	if total := res.Mail.Sent + res.Mail.Failed; total > 0 {
+		res.Mail.SuccessRate = float64(res.Mail.Sent) / float64(total)
+	}
+
+	j, _ := json.Marshal(res)
+	w.Write(j)
+
+	// 取得値のログ
+	fmt.Println(string(j))
+}
+
+// ==================== Rebuild ====================
+// EndUsersとRecruitsを1度だけ走査し、カウンターを数え直す
+// （参加数とメールの送信数は元のデータが無いため数え直さない）
+func (s *Server) RebuildStats() (map[string]int, error) {
+	counts := map[string]int{
+		common.StatUsers: 0, common.StatUsersSuspended: 0, common.StatUsersDeleted: 0,
+		common.StatRecruits: 0, common.StatRecruitsOff: 0, common.StatRecruitsClosed: 0, common.StatRecruitsDeleted: 0, common.StatRecruitsCapacity: 0, common.StatRecruitsMembers: 0,
+	}
+	for _, p := range common.StatPositions {
+		counts[common.StatPosition+p] = 0
+	}
+
+	err := s.db.ScanPages(&dynamodb.ScanInput{
+		TableName:            aws.String(s.tables.EndUsers),
+		ProjectionExpression: aws.String("#A, #deleted, #created"),
+		ExpressionAttributeNames: map[string]*string{
+			"#A":       aws.String("isActive"),
+			"#deleted": aws.String("deletedAt"),
+			"#created": aws.String("created"),
+		},
+	}, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+		for _, item := range page.Items {
+			if item["deletedAt"] != nil {
+				counts[common.StatUsersDeleted]++
+				continue
+			}
+			counts[common.StatUsers]++
+			if !moderation.WasActive(item) {
+				counts[common.StatUsersSuspended]++
+			}
+			if item["created"] != nil {
+				if created := aws.StringValue(item["created"].S); len(created) >= 10 {
+					counts[common.StatUsersNew+created[:10]]++
+				}
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.db.ScanPages(&dynamodb.ScanInput{
+		TableName:            aws.String(s.tables.Recruits),
+		ProjectionExpression: aws.String("#A, #closed, #deleted, #created, #total, #members"),
+		ExpressionAttributeNames: map[string]*string{
+			"#A":       aws.String("isActive"),
+			"#closed":  aws.String("closed"),
+			"#deleted": aws.String("deletedAt"),
+			"#created": aws.String("created"),
+			"#total":   aws.String("totalMember"),
+			"#members": aws.String("members"),
+		},
+	}, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+		for _, item := range page.Items {
+			// 削除したボードは削除数のみに数える
+			if item["deletedAt"] != nil {
+				counts[common.StatRecruitsDeleted]++
+				continue
+			}
+			counts[common.StatRecruits]++
+			if !moderation.WasActive(item) {
+				counts[common.StatRecruitsOff]++
+			}
+			if item["closed"] != nil {
+				counts[common.StatRecruitsClosed]++
+			}
+			if item["created"] != nil {
+				if created := aws.StringValue(item["created"].S); len(created) >= 10 {
+					counts[common.StatRecruitsNew+created[:10]]++
+				}
+			}
+			if item["totalMember"] != nil {
+				capacity, _ := strconv.Atoi(aws.StringValue(item["totalMember"].S))
+				counts[common.StatRecruitsCapacity] += capacity
+			}
+			if item["members"] != nil {
+				for _, member := range item["members"].L {
+					counts[common.StatRecruitsMembers]++
+					position := ""
+					if member.M != nil && member.M["position"] != nil {
+						position = aws.StringValue(member.M["position"].S)
+					}
+					counts[common.PositionStat(position)]++
+				}
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for key, n := range counts {
+		_, err := s.db.PutItem(&dynamodb.PutItemInput{
+			TableName: aws.String(s.tables.AtomicCounter),
+			Item: map[string]*dynamodb.AttributeValue{
+				"countKey":    {S: aws.String("stats:" + key)},
+				"countNumber": {N: aws.String(strconv.Itoa(n))},
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return counts, nil
+}
+
+func (s *Server) StatsRebuild(w http.ResponseWriter, r *http.Request) {
+	counts, err := s.RebuildStats()
+	if err != nil {
+		common.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	j, _ := json.Marshal(counts)
+	w.Write(j)
+
+	// 変更値のログ
+	fmt.Println(string(j))
+}
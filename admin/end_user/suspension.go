@@ -0,0 +1,57 @@
+package adminuser
+
+import (
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/hew-team1/all-api-dev/admin/moderation"
+)
+
+// uidが募集者のボードの停止・再開を連動させる
+//
+//	停止時 : 公開中のボードを停止し、印を付ける
+//	再開時 : 印の付いたボードのみ再開する（管理者が個別に停止したボードはそのまま）
+func (s *Server) CascadeRecruits(uid string, isActive bool) ([]int, error) {
+	param := &dynamodb.ScanInput{
+		TableName:        aws.String(s.tables.Recruits),
+		FilterExpression: aws.String("#M = :m AND #A = :a"),
+		ExpressionAttributeNames: map[string]*string{
+			"#M": aws.String("masterId"),
+			"#A": aws.String("isActive"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":m": {S: aws.String(uid)},
+			":a": {BOOL: aws.Bool(!isActive)},
+		},
+	}
+	if isActive {
+		param.FilterExpression = aws.String("#M = :m AND #A = :a AND #C = :c")
+		param.ExpressionAttributeNames["#C"] = aws.String(moderation.SuspendedWithOwnerAttr)
+		param.ExpressionAttributeValues[":c"] = &dynamodb.AttributeValue{BOOL: aws.Bool(true)}
+	}
+
+	var ids []int
+	err := s.db.ScanPages(param, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+		for _, item := range page.Items {
+			id, _ := strconv.Atoi(aws.StringValue(item["id"].N))
+			ids = append(ids, id)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range ids {
+		err := moderation.SetRecruitActive(s.db, s.tables, id, moderation.RecruitChange{
+			IsActive:  isActive,
+			WithOwner: true,
+		})
+		// 走査の後に削除されたボードは飛ばす
+		if err != nil && err != moderation.ErrRecruitNotFound {
+			return ids, err
+		}
+	}
+	return ids, nil
+}
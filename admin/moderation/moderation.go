@@ -0,0 +1,268 @@
+package moderation
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/hew-team1/all-api-dev/common"
+)
+
+// ==================== Moderation ====================
+// Admin EndUserAPIとAdmin RecruitAPIで共有する停止・再開の理由と、ボードの停止・再開
+
+const (
+	MaxNote    = 500
+	TimeFormat = "2006-01-02 15:04"
+)
+
+// 理由コードを使える操作
+const (
+	ReasonActionSuspend = "suspend"
+	ReasonActionRestore = "restore"
+)
+
+// 停止・再開の理由コード
+type ReasonCode struct {
+	Code  string `json:"code"`
+	Label string `json:"label"`
+	// suspend / restore（空の場合はどちらにも使える）
+	Action string `json:"action,omitempty"`
+}
+
+// 設定の moderationReasonsFile が無い場合の理由コード
+var defaultReasonCodes = []ReasonCode{
+	{Code: "spam", Label: "スパム", Action: ReasonActionSuspend},
+	{Code: "harassment", Label: "嫌がらせ", Action: ReasonActionSuspend},
+	{Code: "inappropriate", Label: "不適切な内容", Action: ReasonActionSuspend},
+	{Code: "impersonation", Label: "なりすまし", Action: ReasonActionSuspend},
+	{Code: "terms_violation", Label: "利用規約違反", Action: ReasonActionSuspend},
+	{Code: "appeal_accepted", Label: "異議申し立ての承認", Action: ReasonActionRestore},
+	{Code: "mistake", Label: "誤った操作の取り消し", Action: ReasonActionRestore},
+	{Code: "suspension_expired", Label: "停止期間の終了", Action: ReasonActionRestore},
+	{Code: "other", Label: "その他"},
+}
+
+// 期限切れで自動的に再開するときの理由コード
+const ExpiredReasonCode = "suspension_expired"
+
+// pathから理由コードの一覧を読み込む（JSONの配列、pathが空の場合は既定の理由コード）
+func LoadReasonCodes(path string) ([]ReasonCode, error) {
+	if path == "" {
+		return defaultReasonCodes, nil
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var codes []ReasonCode
+	if err := json.Unmarshal(b, &codes); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if len(codes) == 0 {
+		return nil, fmt.Errorf("%s: no reason codes", path)
+	}
+	return codes, nil
+}
+
+// 停止・再開の理由
+type Moderation struct {
+	Reason *string `json:"reason,omitempty"`
+	Note   *string `json:"note,omitempty"`
+	// 停止の期限（"2006-01-02 15:04"、日本時間）。過ぎると自動的に再開する
+	ExpiresAt *string `json:"expiresAt,omitempty"`
+
+	until *time.Time
+}
+
+// 理由コード（reasonsのいずれか）と期限の検証
+func Validate(reasons []ReasonCode, m *Moderation, isActive bool) error {
+	if m.Reason == nil {
+		return fmt.Errorf("reason is required")
+	}
+	action := ReasonActionSuspend
+	if isActive {
+		action = ReasonActionRestore
+	}
+	found := false
+	for _, code := range reasons {
+		if code.Code == *m.Reason && (code.Action == "" || code.Action == action) {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("reason %q cannot be used to %s", *m.Reason, action)
+	}
+	if m.Note != nil && utf8.RuneCountInString(*m.Note) > MaxNote {
+		return fmt.Errorf("note must be at most %d characters", MaxNote)
+	}
+	if m.ExpiresAt != nil {
+		if isActive {
+			return fmt.Errorf("expiresAt can only be set when suspending")
+		}
+		until, err := time.ParseInLocation(TimeFormat, *m.ExpiresAt, time.FixedZone("Asia/Tokyo", 9*60*60))
+		if err != nil {
+			return fmt.Errorf("expiresAt must be formatted as %s", TimeFormat)
+		}
+		if !until.After(time.Now()) {
+			return fmt.Errorf("expiresAt must be in the future")
+		}
+		m.until = &until
+	}
+	return nil
+}
+
+// isActiveと理由を反映するUpdateExpression（removeは合わせて削除する属性）
+func Update(isActive bool, m *Moderation, remove ...string) (string, map[string]*string, map[string]*dynamodb.AttributeValue) {
+	return update(isActive, m, "", remove)
+}
+
+// setは合わせて設定する式
+func update(isActive bool, m *Moderation, set string, remove []string) (string, map[string]*string, map[string]*dynamodb.AttributeValue) {
+	nowTime := time.Now().UTC().In(
+		time.FixedZone("Asia/Tokyo", 9*60*60),
+	).Format(TimeFormat)
+
+	names := map[string]*string{
+		"#A":     aws.String("isActive"),
+		"#until": aws.String("suspendedUntil"),
+	}
+	values := map[string]*dynamodb.AttributeValue{
+		":a": {BOOL: aws.Bool(isActive)},
+	}
+	if set != "" {
+		set += ", "
+	}
+	set += "#A = :a"
+	if m != nil && m.Reason != nil {
+		names["#reason"] = aws.String("moderationReason")
+		names["#note"] = aws.String("moderationNote")
+		names["#moderated"] = aws.String("moderated")
+		values[":reason"] = &dynamodb.AttributeValue{S: m.Reason}
+		values[":moderated"] = &dynamodb.AttributeValue{S: aws.String(nowTime)}
+		set += ", #reason = :reason, #moderated = :moderated"
+		if m.Note != nil && *m.Note != "" {
+			values[":note"] = &dynamodb.AttributeValue{S: m.Note}
+			set += ", #note = :note"
+		} else {
+			remove = append(remove, "#note")
+		}
+	}
+	if m != nil && m.until != nil {
+		values[":until"] = &dynamodb.AttributeValue{N: aws.String(strconv.FormatInt(m.until.Unix(), 10))}
+		set += ", #until = :until"
+	} else {
+		remove = append(remove, "#until")
+	}
+
+	expr := "set " + set
+	for i, name := range remove {
+		if i == 0 {
+			expr += " remove " + name
+		} else {
+			expr += ", " + name
+		}
+	}
+	return expr, names, values
+}
+
+// 更新前のisActive（無い場合は公開中として扱う）
+func WasActive(old map[string]*dynamodb.AttributeValue) bool {
+	if old["isActive"] == nil {
+		return true
+	}
+	return aws.BoolValue(old["isActive"].BOOL)
+}
+
+// 停止なら+1、再開なら-1
+func InactiveDelta(isActive bool) int {
+	if isActive {
+		return -1
+	}
+	return 1
+}
+
+// ==================== Recruit ====================
+
+// ユーザーの停止に合わせて停止したボードの印
+const SuspendedWithOwnerAttr = "suspendedWithOwner"
+
+var (
+	ErrRecruitNotFound = fmt.Errorf("recruit not found")
+	ErrVersionConflict = fmt.Errorf("recruit was modified, reload and retry")
+)
+
+// ボードの停止・再開の指定
+type RecruitChange struct {
+	IsActive   bool
+	Moderation *Moderation
+	// nilでない場合は、ボードのversionが一致する場合のみ変更する
+	Version *int
+	// 募集者の停止・再開に連動させる場合（停止時に印を付ける）
+	// falseの場合は印を外し、以後は募集者の再開に連動させない
+	WithOwner bool
+}
+
+// idのボードの停止・再開
+func SetRecruitActive(db *dynamodb.DynamoDB, tables common.Tables, id int, c RecruitChange) error {
+	set, remove := "", []string{"#C"}
+	if c.WithOwner && !c.IsActive {
+		set, remove = "#C = :c", nil
+	}
+	expr, names, values := update(c.IsActive, c.Moderation, set, remove)
+	if set != "" {
+		values[":c"] = &dynamodb.AttributeValue{BOOL: aws.Bool(true)}
+	}
+	expr += " " + common.VersionIncrement(names, values)
+	names["#id"] = aws.String("id")
+	names["#C"] = aws.String(SuspendedWithOwnerAttr)
+	cond := "attribute_exists(#id)"
+	if c.Version != nil {
+		cond += " AND " + common.VersionCondition(*c.Version, names, values)
+	}
+	key := map[string]*dynamodb.AttributeValue{
+		"id": {
+			N: aws.String(strconv.Itoa(id)),
+		},
+	}
+	result, err := db.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName:                 aws.String(tables.Recruits),
+		Key:                       key,
+		ConditionExpression:       aws.String(cond),
+		UpdateExpression:          aws.String(expr),
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
+		ReturnValues:              aws.String("UPDATED_OLD"),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			if c.Version == nil {
+				return ErrRecruitNotFound
+			}
+			// ボードが無いのか、versionが違うのか
+			current, err := db.GetItem(&dynamodb.GetItemInput{
+				TableName: aws.String(tables.Recruits),
+				Key:       key,
+			})
+			if err != nil {
+				return err
+			}
+			if current.Item == nil {
+				return ErrRecruitNotFound
+			}
+			return ErrVersionConflict
+		}
+		return err
+	}
+	if WasActive(result.Attributes) != c.IsActive {
+		common.AddStats(db, tables.AtomicCounter, map[string]int{common.StatRecruitsOff: InactiveDelta(c.IsActive)})
+	}
+	return nil
+}
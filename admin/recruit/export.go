@@ -0,0 +1,254 @@
+package adminrecruit
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/hew-team1/all-api-dev/common"
+)
+
+// Excelで文字化けしないようにCSVの先頭に付けるBOM
+const utf8BOM = "\xEF\xBB\xBF"
+
+// エクスポートの指定
+type ExportOptions struct {
+	Format  string
+	Columns []string
+	// created の範囲（from以上・toの日の終わりまで）
+	From string
+	To   string
+	BOM  bool
+	// 削除済みの項目も含めるか
+	IncludeDeleted bool
+}
+
+// クエリからエクスポートの指定を読み込む（columnsはallowedの中から選ぶ）
+func ParseExportOptions(r *http.Request, allowed, defaults []string) (*ExportOptions, error) {
+	query := r.URL.Query()
+	opts := &ExportOptions{
+		Format:  query.Get("format"),
+		Columns: defaults,
+		BOM:     query.Get("bom") == "true" || query.Get("bom") == "1",
+		// 削除済みの項目は既定では含めない
+		IncludeDeleted: common.IncludeDeleted(r),
+	}
+	if opts.Format == "" {
+		opts.Format = "csv"
+	}
+	if opts.Format != "csv" && opts.Format != "jsonl" {
+		return nil, fmt.Errorf("format must be csv or jsonl")
+	}
+
+	if v := query.Get("columns"); v != "" {
+		known := map[string]bool{}
+		for _, c := range allowed {
+			known[c] = true
+		}
+		opts.Columns = nil
+		seen := map[string]bool{}
+		for _, c := range strings.Split(v, ",") {
+			c = strings.TrimSpace(c)
+			if !known[c] {
+				return nil, fmt.Errorf("unknown column %q", c)
+			}
+			if !seen[c] {
+				seen[c] = true
+				opts.Columns = append(opts.Columns, c)
+			}
+		}
+	}
+
+	for _, d := range []struct {
+		key  string
+		dest *string
+	}{{"from", &opts.From}, {"to", &opts.To}} {
+		v := query.Get(d.key)
+		if v == "" {
+			continue
+		}
+		day, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be formatted as 2006-01-02", d.key)
+		}
+		if d.key == "to" {
+			// created は "2006-01-02 15:04" なので翌日の0時より前とする
+			day = day.AddDate(0, 0, 1)
+		}
+		*d.dest = day.Format("2006-01-02")
+	}
+	if opts.From != "" && opts.To != "" && opts.From >= opts.To {
+		return nil, fmt.Errorf("from must not be after to")
+	}
+	return opts, nil
+}
+
+// 選択した項目のみを読み、createdと削除済みかで絞り込むScan
+func (opts *ExportOptions) ScanInput(tableName string) *dynamodb.ScanInput {
+	names := map[string]*string{}
+	projection := make([]string, 0, len(opts.Columns))
+	for i, c := range opts.Columns {
+		name := "#c" + strconv.Itoa(i)
+		names[name] = aws.String(c)
+		projection = append(projection, name)
+	}
+	param := &dynamodb.ScanInput{
+		TableName:                aws.String(tableName),
+		ProjectionExpression:     aws.String(strings.Join(projection, ", ")),
+		ExpressionAttributeNames: names,
+	}
+
+	filters := []string{}
+	values := map[string]*dynamodb.AttributeValue{}
+	if opts.From != "" {
+		filters = append(filters, "#created >= :from")
+		values[":from"] = &dynamodb.AttributeValue{S: aws.String(opts.From)}
+	}
+	if opts.To != "" {
+		filters = append(filters, "#created < :to")
+		values[":to"] = &dynamodb.AttributeValue{S: aws.String(opts.To)}
+	}
+	if !opts.IncludeDeleted {
+		filters = append(filters, "attribute_not_exists(#deleted)")
+		names["#deleted"] = aws.String("deletedAt")
+	}
+	if len(filters) > 0 {
+		if opts.From != "" || opts.To != "" {
+			names["#created"] = aws.String("created")
+		}
+		param.FilterExpression = aws.String(strings.Join(filters, " AND "))
+		if len(values) > 0 {
+			param.ExpressionAttributeValues = values
+		}
+	}
+	return param
+}
+
+// CSVのセルの値（リスト・マップはJSONにする）
+func csvValue(v interface{}) string {
+	var s string
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		s = t
+	case bool:
+		s = strconv.FormatBool(t)
+	case float64:
+		s = strconv.FormatFloat(t, 'f', -1, 64)
+	default:
+		b, _ := json.Marshal(t)
+		s = string(b)
+	}
+	// 表計算ソフトで数式として扱われないようにする
+	if s != "" && strings.ContainsAny(s[:1], "=+-@") {
+		if _, err := strconv.ParseFloat(s, 64); err != nil {
+			s = "'" + s
+		}
+	}
+	return s
+}
+
+// tableNameをページごとに読み、そのままレスポンスに書き込む
+func (s *Server) ExportTable(w http.ResponseWriter, tableName, filename string, opts *ExportOptions) {
+	nowDate := time.Now().UTC().In(
+		time.FixedZone("Asia/Tokyo", 9*60*60),
+	).Format("20060102")
+
+	if opts.Format == "csv" {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson; charset=utf-8")
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-%s.%s"`, filename, nowDate, opts.Format))
+
+	flusher, _ := w.(http.Flusher)
+	cw := csv.NewWriter(w)
+	enc := json.NewEncoder(w)
+	if opts.Format == "csv" {
+		if opts.BOM {
+			w.Write([]byte(utf8BOM))
+		}
+		cw.Write(opts.Columns)
+	}
+
+	rows := 0
+	var writeErr error
+	err := s.db.ScanPages(opts.ScanInput(tableName), func(page *dynamodb.ScanOutput, lastPage bool) bool {
+		for _, item := range page.Items {
+			var values map[string]interface{}
+			if writeErr = dynamodbattribute.UnmarshalMap(item, &values); writeErr != nil {
+				return false
+			}
+			if opts.Format == "csv" {
+				record := make([]string, len(opts.Columns))
+				for i, c := range opts.Columns {
+					record[i] = csvValue(values[c])
+				}
+				writeErr = cw.Write(record)
+			} else {
+				row := make(map[string]interface{}, len(opts.Columns))
+				for _, c := range opts.Columns {
+					row[c] = values[c]
+				}
+				writeErr = enc.Encode(row)
+			}
+			if writeErr != nil {
+				return false
+			}
+			rows++
+		}
+		// ページごとに送信し、全件をメモリに保持しない
+		cw.Flush()
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return true
+	})
+	cw.Flush()
+	if err == nil {
+		err = writeErr
+	}
+	if err == nil {
+		err = cw.Error()
+	}
+
+	// ヘッダー送信後のため、エラーはログのみ
+	if err != nil {
+		fmt.Println("Got error exporting " + tableName + ":")
+		fmt.Println(err.Error())
+		return
+	}
+
+	// エクスポートのログ
+	fmt.Println("exported", tableName, rows, "rows")
+}
+
+// ==================== Export ====================
+var recruitExportColumns = []string{
+	"id", "masterId", "title", "eventDay", "day", "organizer", "commit", "beginner", "message",
+	"slackUrl", "totalMember", "position", "reword", "imageUrl", "members", "created", "updated", "isActive",
+	"moderationReason", "moderationNote", "moderated", "suspendedUntil", "closed",
+	"deletedAt", "deletedBy", "version",
+}
+
+var recruitExportDefaults = []string{
+	"id", "masterId", "title", "eventDay", "day", "organizer", "totalMember", "position", "members",
+	"created", "updated", "isActive",
+}
+
+func (s *Server) RecruitExport(w http.ResponseWriter, r *http.Request) {
+	opts, err := ParseExportOptions(r, recruitExportColumns, recruitExportDefaults)
+	if err != nil {
+		common.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.ExportTable(w, s.tables.Recruits, "recruits", opts)
+}
@@ -1,15 +0,0 @@
-module main
-
-go 1.15
-
-require (
-	github.com/aws/aws-sdk-go v1.37.25
-	github.com/davecgh/go-spew v1.1.1 // indirect
-	github.com/gorilla/mux v1.8.0
-	github.com/kr/text v0.2.0 // indirect
-	github.com/rs/cors v1.7.0
-	golang.org/x/net v0.0.0-20210119194325-5f4716e94777 // indirect
-	golang.org/x/text v0.3.5 // indirect
-	gopkg.in/check.v1 v1.0.0-20201130134442-10cb98267c6c // indirect
-	gopkg.in/yaml.v2 v2.4.0 // indirect
-)
@@ -1,70 +1,58 @@
-package main
+package adminrecruit
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
-	"io"
-	"log"
 	"net/http"
-	"os"
 	"sort"
-	"strconv"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/credentials"
-	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
 	"github.com/gorilla/mux"
-	"github.com/rs/cors"
+	"github.com/hew-team1/all-api-dev/admin/moderation"
+	"github.com/hew-team1/all-api-dev/common"
 )
 
-func main() {
-	sess, _ := session.NewSession(&aws.Config{
-		Region:      aws.String(os.Getenv("REGION")),
-		Endpoint:    aws.String(os.Getenv("ENDPOINT_DB")),
-		Credentials: credentials.NewStaticCredentials(os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY"), ""),
-	})
+// Admin RecruitAPIのルートをrに登録し、期限を過ぎた一時停止の解除を開始する
+func Mount(r *mux.Router, cfg *common.Config) error {
+	sess, err := cfg.Session(cfg.Endpoints.DB)
+	if err != nil {
+		return err
+	}
 	db := dynamodb.New(sess)
-	server := NewServer(db)
+	reasons, err := moderation.LoadReasonCodes(cfg.ModerationReasonsFile)
+	if err != nil {
+		return err
+	}
+	server := NewServer(db, reasons, cfg)
 
-	r := mux.NewRouter()
 	r.HandleFunc("/admin/recruits", server.RecruitAllGet).Methods("GET")
 	r.HandleFunc("/admin/recruits/active", server.RecruitActive).Methods("PUT")
-	c := cors.New(cors.Options{
-		AllowedOrigins: []string{"*"},
-		AllowedHeaders: []string{"*"},
-		AllowedMethods: []string{
-			http.MethodHead,
-			http.MethodGet,
-			http.MethodPost,
-			http.MethodPatch,
-			http.MethodPut,
-			http.MethodDelete,
-		},
-	}).Handler(r)
-
-	fmt.Println("サーバー起動 : 60012 port で受信")
-	// log.Fatal は、異常を検知すると処理の実行を止めてくれる
-	log.Fatal(http.ListenAndServe(":60012", c))
-}
-
-// io.Readerをbyteのスライスに変換
-func StreamToByte(stream io.Reader) []byte {
-	buf := new(bytes.Buffer)
-	buf.ReadFrom(stream)
-	return buf.Bytes()
+	r.HandleFunc("/admin/recruits/bulk-active", server.RecruitBulkActive).Methods("POST")
+	r.HandleFunc("/admin/recruits/reasons", server.ReasonAllGet).Methods("GET")
+	r.HandleFunc("/admin/recruits/export", server.RecruitExport).Methods("GET")
+	r.HandleFunc("/admin/recruits/{id}/restore", server.RecruitRestore).Methods("POST")
+
+	// 期限を過ぎた一時停止の解除
+	go server.LiftExpiredSuspensions(time.Minute)
+	return nil
 }
 
-func NewServer(db *dynamodb.DynamoDB) *Server {
+func NewServer(db *dynamodb.DynamoDB, reasons []moderation.ReasonCode, cfg *common.Config) *Server {
 	return &Server{
-		db: db,
+		db:      db,
+		reasons: reasons,
+		tables:  cfg.Tables,
 	}
 }
 
 type Server struct {
-	db *dynamodb.DynamoDB
+	db     *dynamodb.DynamoDB
+	tables common.Tables
+	// 停止・再開の理由コード
+	reasons []moderation.ReasonCode
 }
 
 // Recruitのmembersの構造体
@@ -86,30 +74,50 @@ func (r AllGetType) Less(i, j int) bool {
 
 // ==================== AllGet ===================
 type RecruitAllGetResponse struct {
-	Id          *int               `json:"id,omitempty" dynamodbav:"id,omitempty"`
-	MasterId    *string            `json:"masterId,omitempty" dynamodbav:"masterId,omitempty"`
-	Title       *string            `json:"title,omitempty" dynamodbav:"title,omitempty"`
-	EventDay    *string            `json:"eventDay,omitempty" dynamodbav:"eventDay,omitempty"`
-	Day         *string            `json:"day,omitempty" dynamodbav:"day,omitempty"`
-	Organizer   *string            `json:"organizer,omitempty" dynamodbav:"organizer,omitempty"`
-	Commit      *string            `json:"commit,omitempty" dynamodbav:"commit,omitempty"`
-	Beginner    *string            `json:"beginner,omitempty" dynamodbav:"beginner,omitempty"`
-	Message     *string            `json:"message,omitempty" dynamodbav:"message,omitempty"`
-	SlackUrl    *string            `json:"slackUrl,omitempty" dynamodbav:"slackUrl,omitempty"`
-	TotalMember *string            `json:"totalMember,omitempty" dynamodbav:"totalMember,omitempty"`
-	Position    *string            `json:"position,omitempty" dynamodbav:"position,omitempty"`
-	Members     *[]RecruitsMembers `json:"members,omitempty" dynamodbav:"members,omitempty"`
-	Created     *string            `json:"created,omitempty" dynamodbav:"created,omitempty"`
-	Updated     *string            `json:"updated,omitempty" dynamodbav:"updated,omitempty"`
-	IsActive    bool               `json:"isActive" dynamodbav:"isActive"`
+	Id                *int               `json:"id,omitempty" dynamodbav:"id,omitempty"`
+	MasterId          *string            `json:"masterId,omitempty" dynamodbav:"masterId,omitempty"`
+	Title             *string            `json:"title,omitempty" dynamodbav:"title,omitempty"`
+	EventDay          *string            `json:"eventDay,omitempty" dynamodbav:"eventDay,omitempty"`
+	Day               *string            `json:"day,omitempty" dynamodbav:"day,omitempty"`
+	Organizer         *string            `json:"organizer,omitempty" dynamodbav:"organizer,omitempty"`
+	Commit            *string            `json:"commit,omitempty" dynamodbav:"commit,omitempty"`
+	Beginner          *string            `json:"beginner,omitempty" dynamodbav:"beginner,omitempty"`
+	Message           *string            `json:"message,omitempty" dynamodbav:"message,omitempty"`
+	SlackUrl          *string            `json:"slackUrl,omitempty" dynamodbav:"slackUrl,omitempty"`
+	TotalMember       *string            `json:"totalMember,omitempty" dynamodbav:"totalMember,omitempty"`
+	Position          *string            `json:"position,omitempty" dynamodbav:"position,omitempty"`
+	ImageUrl          *string            `json:"imageUrl,omitempty" dynamodbav:"imageUrl,omitempty"`
+	ImageThumbnailUrl *string            `json:"imageThumbnailUrl,omitempty" dynamodbav:"imageThumbnailUrl,omitempty"`
+	Members           *[]RecruitsMembers `json:"members,omitempty" dynamodbav:"members,omitempty"`
+	Created           *string            `json:"created,omitempty" dynamodbav:"created,omitempty"`
+	Updated           *string            `json:"updated,omitempty" dynamodbav:"updated,omitempty"`
+	IsActive          bool               `json:"isActive" dynamodbav:"isActive"`
+	Closed            *string            `json:"closed,omitempty" dynamodbav:"closed,omitempty"`
+	// 直近の停止・再開の理由
+	ModerationReason *string `json:"moderationReason,omitempty" dynamodbav:"moderationReason,omitempty"`
+	ModerationNote   *string `json:"moderationNote,omitempty" dynamodbav:"moderationNote,omitempty"`
+	Moderated        *string `json:"moderated,omitempty" dynamodbav:"moderated,omitempty"`
+	SuspendedUntil   *int64  `json:"suspendedUntil,omitempty" dynamodbav:"suspendedUntil,omitempty"`
+	// 募集者が削除した場合（?includeDeleted=true）
+	DeletedAt *string `json:"deletedAt,omitempty" dynamodbav:"deletedAt,omitempty"`
+	DeletedBy *string `json:"deletedBy,omitempty" dynamodbav:"deletedBy,omitempty"`
+	PurgeAt   *int64  `json:"purgeAt,omitempty" dynamodbav:"purgeAt,omitempty"`
+	Version   int     `json:"version" dynamodbav:"version"`
 }
 type AllGetType []RecruitAllGetResponse
 
 func (s *Server) RecruitAllGet(w http.ResponseWriter, r *http.Request) {
-	tableName := "Recruits"
+	tableName := s.tables.Recruits
 	param := &dynamodb.ScanInput{
 		TableName: aws.String(tableName),
 	}
+	// 削除したボードは既定では含めない
+	if !common.IncludeDeleted(r) {
+		param.FilterExpression = aws.String("attribute_not_exists(#D)")
+		param.ExpressionAttributeNames = map[string]*string{
+			"#D": aws.String("deletedAt"),
+		}
+	}
 	result, _ := s.db.Scan(param)
 
 	var resRecruit = make(AllGetType, 0)
@@ -126,32 +134,50 @@ func (s *Server) RecruitAllGet(w http.ResponseWriter, r *http.Request) {
 type RecruitUpdateRequest struct {
 	Id       *int `json:"id,omitempty" dynamodbav:"id,omitempty"`
 	IsActive bool `json:"isActive" dynamodbav:"isActive"`
+	// 理由は任意（指定する場合は理由コードが必須）
+	moderation.Moderation
 }
 
 func (s *Server) RecruitActive(w http.ResponseWriter, r *http.Request) {
-	var reqRecruit RecruitAllGetResponse
-	json.Unmarshal(StreamToByte(r.Body), &reqRecruit)
+	var reqRecruit RecruitUpdateRequest
+	json.Unmarshal(common.StreamToByte(r.Body), &reqRecruit)
+	if reqRecruit.Id == nil {
+		common.WriteError(w, http.StatusBadRequest, "id is required")
+		return
+	}
 
-	tableName := "Recruits"
-	param := &dynamodb.UpdateItemInput{
-		TableName: aws.String(tableName),
-		Key: map[string]*dynamodb.AttributeValue{
-			"id": {
-				N: aws.String(strconv.Itoa(*reqRecruit.Id)),
-			},
-		},
-		UpdateExpression: aws.String("set #A = :a"),
-		ExpressionAttributeNames: map[string]*string{
-			"#A": aws.String("isActive"),
-		},
-		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
-			":a": {
-				BOOL: &reqRecruit.IsActive,
-			},
-		},
-		ReturnValues: aws.String("UPDATED_NEW"),
+	var m *moderation.Moderation
+	if reqRecruit.Reason != nil || reqRecruit.Note != nil || reqRecruit.ExpiresAt != nil {
+		if err := moderation.Validate(s.reasons, &reqRecruit.Moderation, reqRecruit.IsActive); err != nil {
+			common.WriteError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		m = &reqRecruit.Moderation
+	}
+
+	// If-Matchがある場合は、GETした後に募集者などが変更していれば412を返す
+	var version *int
+	if v, ok, err := common.IfMatch(r); err != nil {
+		common.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	} else if ok {
+		version = &v
+	}
+
+	if err := moderation.SetRecruitActive(s.db, s.tables, *reqRecruit.Id, moderation.RecruitChange{
+		IsActive:   reqRecruit.IsActive,
+		Moderation: m,
+		Version:    version,
+	}); err != nil {
+		if err == moderation.ErrRecruitNotFound {
+			common.WriteError(w, http.StatusNotFound, err.Error())
+		} else if err == moderation.ErrVersionConflict {
+			common.WriteError(w, http.StatusPreconditionFailed, err.Error())
+		} else {
+			common.WriteError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
 	}
-	_, _ = s.db.UpdateItem(param)
 
 	j, _ := json.Marshal(reqRecruit)
 	// 変更値のログ
@@ -0,0 +1,135 @@
+package adminrecruit
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/hew-team1/all-api-dev/admin/moderation"
+	"github.com/hew-team1/all-api-dev/common"
+)
+
+const maxBulkItems = 100
+
+// ==================== Reasons ====================
+func (s *Server) ReasonAllGet(w http.ResponseWriter, r *http.Request) {
+	j, _ := json.Marshal(s.reasons)
+	w.Write(j)
+}
+
+// ==================== Bulk isActive ====================
+type RecruitBulkActiveRequest struct {
+	Ids      []int `json:"ids"`
+	IsActive bool  `json:"isActive"`
+	moderation.Moderation
+}
+
+type BulkActiveResult struct {
+	Id    int    `json:"id"`
+	Ok    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+type BulkActiveResponse struct {
+	Succeeded int                `json:"succeeded"`
+	Failed    int                `json:"failed"`
+	Results   []BulkActiveResult `json:"results"`
+}
+
+func (s *Server) RecruitBulkActive(w http.ResponseWriter, r *http.Request) {
+	var reqBulk RecruitBulkActiveRequest
+	if err := json.Unmarshal(common.StreamToByte(r.Body), &reqBulk); err != nil {
+		common.WriteError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if len(reqBulk.Ids) == 0 || len(reqBulk.Ids) > maxBulkItems {
+		common.WriteError(w, http.StatusBadRequest, fmt.Sprintf("ids must have 1 to %d items", maxBulkItems))
+		return
+	}
+	if err := moderation.Validate(s.reasons, &reqBulk.Moderation, reqBulk.IsActive); err != nil {
+		common.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	res := BulkActiveResponse{Results: make([]BulkActiveResult, 0, len(reqBulk.Ids))}
+	seen := map[int]bool{}
+	for _, id := range reqBulk.Ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		result := BulkActiveResult{Id: id, Ok: true}
+		if err := moderation.SetRecruitActive(s.db, s.tables, id, moderation.RecruitChange{
+			IsActive:   reqBulk.IsActive,
+			Moderation: &reqBulk.Moderation,
+		}); err != nil {
+			result.Ok = false
+			result.Error = err.Error()
+			res.Failed++
+		} else {
+			res.Succeeded++
+		}
+		res.Results = append(res.Results, result)
+	}
+
+	j, _ := json.Marshal(res)
+	w.Write(j)
+
+	// 変更値のログ
+	fmt.Println(string(j))
+}
+
+// ==================== Expire ====================
+// 期限を過ぎた一時停止を定期的に解除する
+func (s *Server) LiftExpiredSuspensions(interval time.Duration) {
+	for {
+		if err := s.liftExpiredSuspensions(time.Now()); err != nil {
+			fmt.Println("Got error lifting suspensions:")
+			fmt.Println(err.Error())
+		}
+		time.Sleep(interval)
+	}
+}
+
+func (s *Server) liftExpiredSuspensions(now time.Time) error {
+	var ids []int
+	err := s.db.ScanPages(&dynamodb.ScanInput{
+		TableName:            aws.String(s.tables.Recruits),
+		FilterExpression:     aws.String("#A = :a AND #until <= :now"),
+		ProjectionExpression: aws.String("#id"),
+		ExpressionAttributeNames: map[string]*string{
+			"#A":     aws.String("isActive"),
+			"#until": aws.String("suspendedUntil"),
+			"#id":    aws.String("id"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":a":   {BOOL: aws.Bool(false)},
+			":now": {N: aws.String(strconv.FormatInt(now.Unix(), 10))},
+		},
+	}, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+		for _, item := range page.Items {
+			id, _ := strconv.Atoi(aws.StringValue(item["id"].N))
+			ids = append(ids, id)
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		m := &moderation.Moderation{Reason: aws.String(moderation.ExpiredReasonCode)}
+		if err := moderation.SetRecruitActive(s.db, s.tables, id, moderation.RecruitChange{IsActive: true, Moderation: m}); err != nil {
+			return err
+		}
+
+		// 解除のログ
+		fmt.Println("suspension expired:", id)
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package adminrecruit
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/gorilla/mux"
+	"github.com/hew-team1/all-api-dev/admin/moderation"
+	"github.com/hew-team1/all-api-dev/common"
+)
+
+// ==================== Restore ====================
+// 募集者が削除したボードを、TTLで削除される前に元に戻す（isActiveは削除前のまま）
+func (s *Server) RecruitRestore(w http.ResponseWriter, r *http.Request) {
+	nowTime := time.Now().UTC().In(
+		time.FixedZone("Asia/Tokyo", 9*60*60),
+	).Format(moderation.TimeFormat)
+
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		common.WriteError(w, http.StatusBadRequest, "id must be a number")
+		return
+	}
+	expected, checkVersion, err := common.IfMatch(r)
+	if err != nil {
+		common.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	key := map[string]*dynamodb.AttributeValue{
+		"id": {
+			N: aws.String(vars["id"]),
+		},
+	}
+	current, err := s.db.GetItem(&dynamodb.GetItemInput{
+		TableName:      aws.String(s.tables.Recruits),
+		Key:            key,
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		common.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if current.Item == nil {
+		common.WriteError(w, http.StatusNotFound, moderation.ErrRecruitNotFound.Error())
+		return
+	}
+	if current.Item["deletedAt"] == nil {
+		common.WriteError(w, http.StatusConflict, "recruit is not deleted")
+		return
+	}
+	version := common.ItemVersion(current.Item)
+	if checkVersion && version != expected {
+		common.WriteError(w, http.StatusPreconditionFailed, moderation.ErrVersionConflict.Error())
+		return
+	}
+
+	names := map[string]*string{
+		"#deleted": aws.String("deletedAt"),
+		"#by":      aws.String("deletedBy"),
+		"#purge":   aws.String("purgeAt"),
+		"#updated": aws.String("updated"),
+	}
+	values := map[string]*dynamodb.AttributeValue{
+		":updated": {S: aws.String(nowTime)},
+	}
+	expr := "set #updated = :updated remove #deleted, #by, #purge " + common.VersionIncrement(names, values)
+	cond := "attribute_exists(#deleted) AND " + common.VersionCondition(version, names, values)
+
+	var resRecruit RecruitAllGetResponse
+	dynamodbattribute.UnmarshalMap(current.Item, &resRecruit)
+
+	// ボードと作成者の項目は1つのトランザクションで戻す（作成者の項目はTTLで先に削除されている場合もあるため登録し直す）
+	owner := map[string]*dynamodb.AttributeValue{
+		"recruitId": {N: aws.String(vars["id"])},
+		"uid":       {S: aws.String(aws.StringValue(resRecruit.MasterId))},
+	}
+	if resRecruit.Created != nil {
+		owner["created"] = &dynamodb.AttributeValue{S: resRecruit.Created}
+	}
+	items := []*dynamodb.TransactWriteItem{
+		{
+			Update: &dynamodb.Update{
+				TableName:                 aws.String(s.tables.Recruits),
+				Key:                       key,
+				ConditionExpression:       aws.String(cond),
+				UpdateExpression:          aws.String(expr),
+				ExpressionAttributeNames:  names,
+				ExpressionAttributeValues: values,
+			},
+		},
+		{
+			Put: &dynamodb.Put{
+				TableName: aws.String(s.tables.RecruitOwners),
+				Item:      owner,
+			},
+		},
+	}
+	_, err = s.db.TransactWriteItems(&dynamodb.TransactWriteItemsInput{TransactItems: items})
+	if failed, ok := common.CanceledItems(err, len(items)); ok && failed[0] {
+		common.WriteError(w, http.StatusPreconditionFailed, moderation.ErrVersionConflict.Error())
+		return
+	}
+	if err != nil {
+		fmt.Println("Got error calling TransactWriteItems:")
+		fmt.Println(err.Error())
+		common.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	s.AddStats(restoredStats(&resRecruit))
+	if err := s.restoreMemberships(id, &resRecruit); err != nil {
+		fmt.Println("Got error updating memberships:")
+		fmt.Println(err.Error())
+	}
+
+	resRecruit.DeletedAt = nil
+	resRecruit.DeletedBy = nil
+	resRecruit.PurgeAt = nil
+	resRecruit.Updated = &nowTime
+	resRecruit.Version = version + 1
+	j, _ := json.Marshal(resRecruit)
+	w.Header().Set("ETag", common.ETag(resRecruit.Version))
+	w.Write(j)
+
+	// 復元のログ
+	fmt.Println(string(j))
+}
+
+// 削除時に除いたカウンターを戻す
+func restoredStats(rec *RecruitAllGetResponse) map[string]int {
+	deltas := map[string]int{
+		common.StatRecruits:        1,
+		common.StatRecruitsDeleted: -1,
+	}
+	if !rec.IsActive {
+		deltas[common.StatRecruitsOff]++
+	}
+	if rec.Closed != nil {
+		deltas[common.StatRecruitsClosed]++
+	}
+	capacity, _ := strconv.Atoi(aws.StringValue(rec.TotalMember))
+	deltas[common.StatRecruitsCapacity] += capacity
+	if rec.Members != nil {
+		for _, member := range *rec.Members {
+			deltas[common.StatRecruitsMembers]++
+			deltas[common.PositionStat(aws.StringValue(member.Position))]++
+		}
+	}
+	return deltas
+}
+
+// ボードのmembersのMembershipsの項目からpurgeAtを削除する（TTLで削除済みの項目は登録し直す）
+func (s *Server) restoreMemberships(id int, rec *RecruitAllGetResponse) error {
+	if rec.Members == nil {
+		return nil
+	}
+	for _, member := range *rec.Members {
+		uid := aws.StringValue(member.Uid)
+		if uid == "" || uid == common.DeletedUserUid {
+			continue
+		}
+		_, err := s.db.UpdateItem(&dynamodb.UpdateItemInput{
+			TableName: aws.String(s.tables.Memberships),
+			Key: map[string]*dynamodb.AttributeValue{
+				"recruitId": {N: aws.String(strconv.Itoa(id))},
+				"uid":       {S: aws.String(uid)},
+			},
+			UpdateExpression: aws.String("set #position = if_not_exists(#position, :position) remove #purge"),
+			ExpressionAttributeNames: map[string]*string{
+				"#position": aws.String("position"),
+				"#purge":    aws.String("purgeAt"),
+			},
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":position": {S: aws.String(aws.StringValue(member.Position))},
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
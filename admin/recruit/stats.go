@@ -0,0 +1,10 @@
+package adminrecruit
+
+import (
+	"github.com/hew-team1/all-api-dev/common"
+)
+
+// カウンターを加算する（統計のみのため、失敗しても処理は止めない）
+func (s *Server) AddStats(deltas map[string]int) {
+	common.AddStats(s.db, s.tables.AtomicCounter, deltas)
+}
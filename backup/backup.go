@@ -0,0 +1,303 @@
+// テーブルのバックアップと復元
+//
+// テーブルごとに <設定ファイルのキー>.jsonl（例 : endUsers.jsonl）を書き込み、
+// 復元先のテーブル名は復元先の設定から決めるため、接頭辞や接続先の違う環境に復元できる。
+// 書き込み中の変更は含まれる場合と含まれない場合があり、時点の揃ったスナップショットではない
+package backup
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/hew-team1/all-api-dev/common"
+)
+
+// 復元時にまとめて書き込む件数
+const chunkSize = 1000
+
+type Archiver struct {
+	db *dynamodb.DynamoDB
+	// 設定ファイルのキーとテーブル名
+	tables map[string]string
+	// Scanのセグメント数・BatchWriteItemの並列数
+	workers int
+}
+
+func NewArchiver(db *dynamodb.DynamoDB, cfg *common.Config, workers int) *Archiver {
+	if workers < 1 {
+		workers = 1
+	}
+	return &Archiver{
+		db:      db,
+		tables:  cfg.Tables.ByKey(),
+		workers: workers,
+	}
+}
+
+// 1テーブル分の結果
+type Result struct {
+	Table string
+	Name  string
+	Count int
+	// テーブルまたはファイルが無く、何もしなかった
+	Skipped bool
+}
+
+// keysの順を揃え、存在しないキーを弾く（空の場合は全てのテーブル）
+func (a *Archiver) selectKeys(keys []string) ([]string, error) {
+	if len(keys) == 0 {
+		for key := range a.tables {
+			keys = append(keys, key)
+		}
+	}
+	for _, key := range keys {
+		if _, ok := a.tables[key]; !ok {
+			valid := []string{}
+			for k := range a.tables {
+				valid = append(valid, k)
+			}
+			sort.Strings(valid)
+			return nil, fmt.Errorf("unknown table %q (one of %s)", key, strings.Join(valid, ", "))
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func filename(dir, key string) string {
+	return filepath.Join(dir, key+".jsonl")
+}
+
+// ==================== Backup ====================
+// keysのテーブル（空の場合は全て）をdirに書き込む。存在しないテーブルは飛ばす
+func (a *Archiver) Backup(dir string, keys []string) ([]Result, error) {
+	keys, err := a.selectKeys(keys)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	results := []Result{}
+	for _, key := range keys {
+		name := a.tables[key]
+		exists, err := a.exists(name)
+		if err != nil {
+			return results, err
+		}
+		if !exists {
+			results = append(results, Result{Table: key, Name: name, Skipped: true})
+			continue
+		}
+		count, err := a.backupTable(dir, key, name)
+		if err != nil {
+			return results, fmt.Errorf("%s: %v", name, err)
+		}
+		results = append(results, Result{Table: key, Name: name, Count: count})
+	}
+	return results, nil
+}
+
+func (a *Archiver) exists(name string) (bool, error) {
+	_, err := a.db.DescribeTable(&dynamodb.DescribeTableInput{
+		TableName: aws.String(name),
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeResourceNotFoundException {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// 一時ファイルに書き込み、全て書き込めた場合のみ置き換える
+func (a *Archiver) backupTable(dir, key, name string) (int, error) {
+	f, err := ioutil.TempFile(dir, key+".*.tmp")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+
+	nowTime := time.Now().UTC().In(
+		time.FixedZone("Asia/Tokyo", 9*60*60),
+	).Format("2006-01-02 15:04")
+	if err := enc.Encode(Header{
+		Format:  Format,
+		Version: Version,
+		Table:   key,
+		Source:  name,
+		Created: nowTime,
+	}); err != nil {
+		return 0, err
+	}
+
+	count, err := a.scan(name, func(item map[string]*dynamodb.AttributeValue) error {
+		return enc.Encode(encodeItem(item))
+	})
+	if err != nil {
+		return 0, err
+	}
+	if err := w.Flush(); err != nil {
+		return 0, err
+	}
+	if err := f.Close(); err != nil {
+		return 0, err
+	}
+	return count, os.Rename(f.Name(), filename(dir, key))
+}
+
+// テーブルをworkersの数のセグメントに分けて並列にScanし、1件ずつfnに渡す（fnは並列には呼ばれない）
+func (a *Archiver) scan(name string, fn func(item map[string]*dynamodb.AttributeValue) error) (int, error) {
+	items := make(chan map[string]*dynamodb.AttributeValue, 100)
+	// 書き込みに失敗した場合はScanを止める
+	done := make(chan struct{})
+	errs := make(chan error, a.workers)
+
+	var wg sync.WaitGroup
+	for segment := 0; segment < a.workers; segment++ {
+		wg.Add(1)
+		go func(segment int) {
+			defer wg.Done()
+			err := a.db.ScanPages(&dynamodb.ScanInput{
+				TableName:      aws.String(name),
+				Segment:        aws.Int64(int64(segment)),
+				TotalSegments:  aws.Int64(int64(a.workers)),
+				ConsistentRead: aws.Bool(true),
+			}, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+				for _, item := range page.Items {
+					select {
+					case items <- item:
+					case <-done:
+						return false
+					}
+				}
+				return true
+			})
+			if err != nil {
+				errs <- err
+			}
+		}(segment)
+	}
+	go func() {
+		wg.Wait()
+		close(items)
+	}()
+
+	count := 0
+	var fnErr error
+	for item := range items {
+		if fnErr = fn(item); fnErr != nil {
+			close(done)
+			// Scanが止まるまで読み捨てる
+			for range items {
+			}
+			break
+		}
+		count++
+	}
+	if fnErr != nil {
+		return count, fnErr
+	}
+	select {
+	case err := <-errs:
+		return count, err
+	default:
+		return count, nil
+	}
+}
+
+// ==================== Restore ====================
+// dirのファイルを復元先のテーブルに書き込む（同じキーの項目は上書きし、それ以外の項目は残す）
+//
+// テーブルは先に migrate で作成しておく。keysが空の場合はdirにある全てのファイルを復元する
+func (a *Archiver) Restore(dir string, keys []string) ([]Result, error) {
+	all := len(keys) == 0
+	keys, err := a.selectKeys(keys)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []Result{}
+	for _, key := range keys {
+		name := a.tables[key]
+		f, err := os.Open(filename(dir, key))
+		if os.IsNotExist(err) && all {
+			results = append(results, Result{Table: key, Name: name, Skipped: true})
+			continue
+		}
+		if err != nil {
+			return results, err
+		}
+		count, err := a.restoreFile(f, key, name)
+		f.Close()
+		if err != nil {
+			return results, fmt.Errorf("%s: %v", filename(dir, key), err)
+		}
+		results = append(results, Result{Table: key, Name: name, Count: count})
+	}
+	return results, nil
+}
+
+func (a *Archiver) restoreFile(f io.Reader, key, name string) (int, error) {
+	r := bufio.NewReader(f)
+	line, err := r.ReadBytes('\n')
+	if err != nil {
+		return 0, fmt.Errorf("missing header: %v", err)
+	}
+	var header Header
+	if err := json.Unmarshal(line, &header); err != nil {
+		return 0, fmt.Errorf("invalid header: %v", err)
+	}
+	if header.Format != Format {
+		return 0, fmt.Errorf("not a backup file (format %q)", header.Format)
+	}
+	if header.Version < 1 || header.Version > Version {
+		return 0, fmt.Errorf("unsupported version %d (supported up to %d)", header.Version, Version)
+	}
+	if header.Table != key {
+		return 0, fmt.Errorf("file contains %q, not %q", header.Table, key)
+	}
+
+	count := 0
+	requests := []common.PutRequest{}
+	for n := 2; ; n++ {
+		line, err := r.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return count, err
+		}
+		if len(strings.TrimSpace(string(line))) > 0 {
+			var item map[string]value
+			if err := json.Unmarshal(line, &item); err != nil {
+				return count, fmt.Errorf("line %d: %v", n, err)
+			}
+			requests = append(requests, common.PutRequest{Table: name, Item: decodeItem(item)})
+		}
+
+		if len(requests) == chunkSize || (err == io.EOF && len(requests) > 0) {
+			if err := common.BatchPut(a.db, requests, a.workers); err != nil {
+				return count, err
+			}
+			count += len(requests)
+			requests = requests[:0]
+		}
+		if err == io.EOF {
+			return count, nil
+		}
+	}
+}
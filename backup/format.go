@@ -0,0 +1,103 @@
+package backup
+
+import (
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// ファイルの形式（1行目がHeader、2行目以降が1行1項目のDynamoDB JSON）
+const (
+	Format = "all-api-dev/backup"
+	// 形式を変えた場合は上げ、restoreで古い形式も読めるようにする
+	Version = 1
+)
+
+// 各ファイルの1行目
+type Header struct {
+	Format  string `json:"format"`
+	Version int    `json:"version"`
+	// 設定ファイルのキー（endUsersなど）。復元先のテーブル名はこのキーで決める
+	Table string `json:"table"`
+	// バックアップ元のテーブル名
+	Source  string `json:"source"`
+	Created string `json:"created"`
+}
+
+// DynamoDB JSONの値（{"S": "..."} {"N": "1"} など、使う型のみを持つ）
+//
+// 空のリスト・マップも残すよう、LとMはポインターにする
+type value struct {
+	S    *string           `json:"S,omitempty"`
+	N    *string           `json:"N,omitempty"`
+	B    []byte            `json:"B,omitempty"`
+	BOOL *bool             `json:"BOOL,omitempty"`
+	NULL *bool             `json:"NULL,omitempty"`
+	L    *[]value          `json:"L,omitempty"`
+	M    *map[string]value `json:"M,omitempty"`
+	SS   []*string         `json:"SS,omitempty"`
+	NS   []*string         `json:"NS,omitempty"`
+	BS   [][]byte          `json:"BS,omitempty"`
+}
+
+func encodeItem(item map[string]*dynamodb.AttributeValue) map[string]value {
+	m := make(map[string]value, len(item))
+	for k, av := range item {
+		m[k] = encode(av)
+	}
+	return m
+}
+
+func encode(av *dynamodb.AttributeValue) value {
+	v := value{
+		S:    av.S,
+		N:    av.N,
+		B:    av.B,
+		BOOL: av.BOOL,
+		NULL: av.NULL,
+		SS:   av.SS,
+		NS:   av.NS,
+		BS:   av.BS,
+	}
+	if av.L != nil {
+		l := make([]value, len(av.L))
+		for i := range av.L {
+			l[i] = encode(av.L[i])
+		}
+		v.L = &l
+	}
+	if av.M != nil {
+		m := encodeItem(av.M)
+		v.M = &m
+	}
+	return v
+}
+
+func decodeItem(m map[string]value) map[string]*dynamodb.AttributeValue {
+	item := make(map[string]*dynamodb.AttributeValue, len(m))
+	for k, v := range m {
+		item[k] = decode(v)
+	}
+	return item
+}
+
+func decode(v value) *dynamodb.AttributeValue {
+	av := &dynamodb.AttributeValue{
+		S:    v.S,
+		N:    v.N,
+		B:    v.B,
+		BOOL: v.BOOL,
+		NULL: v.NULL,
+		SS:   v.SS,
+		NS:   v.NS,
+		BS:   v.BS,
+	}
+	if v.L != nil {
+		av.L = make([]*dynamodb.AttributeValue, len(*v.L))
+		for i, e := range *v.L {
+			av.L[i] = decode(e)
+		}
+	}
+	if v.M != nil {
+		av.M = decodeItem(*v.M)
+	}
+	return av
+}
@@ -0,0 +1,187 @@
+package common
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// BatchWriteItemの1回の上限
+const batchSize = 25
+
+// 処理されなかった項目を再送する回数の上限と、最初の待ち時間（再送ごとに倍にする）
+const (
+	batchAttempts  = 10
+	batchRetryWait = 50 * time.Millisecond
+)
+
+// 書き込み先のテーブルと項目
+type PutRequest struct {
+	Table string
+	Item  map[string]*dynamodb.AttributeValue
+}
+
+// requestsを25件ずつworkersの数だけ並列に書き込む（seed・restoreなどの一括登録用）
+func BatchPut(db *dynamodb.DynamoDB, requests []PutRequest, workers int) error {
+	if workers < 1 {
+		workers = 1
+	}
+	batches := make(chan []PutRequest)
+	errs := make(chan error, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for batch := range batches {
+				if err := writeBatch(db, batch); err != nil {
+					errs <- err
+					// 残りのバッチは読み捨てる
+					for range batches {
+					}
+					return
+				}
+			}
+		}()
+	}
+
+	for start := 0; start < len(requests); start += batchSize {
+		end := start + batchSize
+		if end > len(requests) {
+			end = len(requests)
+		}
+		batches <- requests[start:end]
+	}
+	close(batches)
+	wg.Wait()
+
+	select {
+	case err := <-errs:
+		return err
+	default:
+		return nil
+	}
+}
+
+func writeBatch(db *dynamodb.DynamoDB, batch []PutRequest) error {
+	items := map[string][]*dynamodb.WriteRequest{}
+	for _, req := range batch {
+		items[req.Table] = append(items[req.Table], &dynamodb.WriteRequest{
+			PutRequest: &dynamodb.PutRequest{Item: req.Item},
+		})
+	}
+
+	// 処理されなかった項目は待ってから再送する
+	wait := batchRetryWait
+	for attempt := 0; len(items) > 0; attempt++ {
+		if attempt == batchAttempts {
+			return fmt.Errorf("batch write did not finish after %d attempts", attempt)
+		}
+		if attempt > 0 {
+			time.Sleep(wait)
+			wait *= 2
+		}
+		result, err := db.BatchWriteItem(&dynamodb.BatchWriteItemInput{
+			RequestItems: items,
+		})
+		if err != nil {
+			return err
+		}
+		items = result.UnprocessedItems
+	}
+	return nil
+}
+
+// BatchGetItemの1回の上限
+const batchGetSize = 100
+
+// tableのkeysの項目をまとめて取得する（重複したキーは1回だけ取得し、存在しない項目は含めない）
+//
+// projectionが空の場合は全ての属性を取得する
+func BatchGet(db *dynamodb.DynamoDB, table string, keys []map[string]*dynamodb.AttributeValue, projection string, names map[string]*string) ([]map[string]*dynamodb.AttributeValue, error) {
+	// BatchGetItemは重複したキーを受け付けない
+	seen := map[string]bool{}
+	unique := make([]map[string]*dynamodb.AttributeValue, 0, len(keys))
+	for _, key := range keys {
+		k := keyString(key)
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		unique = append(unique, key)
+	}
+
+	items := make([]map[string]*dynamodb.AttributeValue, 0, len(unique))
+	for start := 0; start < len(unique); start += batchGetSize {
+		end := start + batchGetSize
+		if end > len(unique) {
+			end = len(unique)
+		}
+		request := map[string]*dynamodb.KeysAndAttributes{
+			table: {Keys: unique[start:end]},
+		}
+		if projection != "" {
+			request[table].ProjectionExpression = aws.String(projection)
+			request[table].ExpressionAttributeNames = names
+		}
+		// 処理されなかったキーは待ってから再送する
+		wait := batchRetryWait
+		for attempt := 0; len(request) > 0; attempt++ {
+			if attempt == batchAttempts {
+				return items, fmt.Errorf("batch get did not finish after %d attempts", attempt)
+			}
+			if attempt > 0 {
+				time.Sleep(wait)
+				wait *= 2
+			}
+			result, err := db.BatchGetItem(&dynamodb.BatchGetItemInput{RequestItems: request})
+			if err != nil {
+				return items, err
+			}
+			items = append(items, result.Responses[table]...)
+			request = result.UnprocessedKeys
+		}
+	}
+	return items, nil
+}
+
+// キーの重複の判定に使う文字列
+func keyString(key map[string]*dynamodb.AttributeValue) string {
+	attrs := make([]string, 0, len(key))
+	for name := range key {
+		attrs = append(attrs, name)
+	}
+	sort.Strings(attrs)
+	res := ""
+	for _, name := range attrs {
+		res += name + "=" + aws.StringValue(key[name].S) + aws.StringValue(key[name].N) + "\x00"
+	}
+	return res
+}
+
+// ==================== Users ====================
+// uidsのうち停止中のユーザーのuid（存在しないuidは含めない）
+func SuspendedUids(db *dynamodb.DynamoDB, table string, uids []string) (map[string]bool, error) {
+	suspended := map[string]bool{}
+	keys := make([]map[string]*dynamodb.AttributeValue, 0, len(uids))
+	for _, uid := range uids {
+		keys = append(keys, map[string]*dynamodb.AttributeValue{"uid": {S: aws.String(uid)}})
+	}
+	items, err := BatchGet(db, table, keys, "#U, #A", map[string]*string{
+		"#U": aws.String("uid"),
+		"#A": aws.String("isActive"),
+	})
+	if err != nil {
+		return suspended, err
+	}
+	for _, item := range items {
+		if item["isActive"] != nil && !aws.BoolValue(item["isActive"].BOOL) {
+			suspended[aws.StringValue(item["uid"].S)] = true
+		}
+	}
+	return suspended, nil
+}
@@ -0,0 +1,150 @@
+package common
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// 画像などのファイルの保存先
+type BlobStore interface {
+	// keyにファイルを保存し、公開URLを返す
+	Put(key string, body []byte, contentType string) (string, error)
+	// keyのファイルを削除する（存在しない場合もエラーにしない）
+	Delete(key string) error
+}
+
+// 設定の blob.store に応じた保存先を作成
+//
+//	local : blob.dir に保存し、blob.baseUrl から配信する
+//	s3    : blob.bucket に保存する（endpoints.s3 があればそこに接続）
+func NewBlobStore(cfg *Config) (BlobStore, error) {
+	switch cfg.Blob.Store {
+	case "local":
+		return NewLocalBlobStore(cfg.Blob.Dir, cfg.Blob.BaseURL)
+	case "s3":
+		cfgs := cfg.AWS(cfg.Endpoints.S3)
+		if cfg.Endpoints.S3 != "" {
+			cfgs.S3ForcePathStyle = aws.Bool(true)
+		}
+		sess, err := session.NewSession(&cfgs)
+		if err != nil {
+			return nil, err
+		}
+		return NewS3BlobStore(s3.New(sess), cfg.Blob.Bucket, cfg.Blob.BaseURL), nil
+	default:
+		return nil, fmt.Errorf("unknown blob store: %s", cfg.Blob.Store)
+	}
+}
+
+// ==================== Local ====================
+type LocalBlobStore struct {
+	dir     string
+	baseURL string
+}
+
+func NewLocalBlobStore(dir, baseURL string) (*LocalBlobStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	if baseURL == "" {
+		baseURL = "/images"
+	}
+	return &LocalBlobStore{
+		dir:     dir,
+		baseURL: strings.TrimRight(baseURL, "/"),
+	}, nil
+}
+
+// keyをdir配下のパスに変換（dirの外は指せない）
+func (l *LocalBlobStore) path(key string) (string, error) {
+	root, err := filepath.Abs(l.dir)
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(root, filepath.FromSlash(key))
+	if !strings.HasPrefix(path, root+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid blob key: %s", key)
+	}
+	return path, nil
+}
+
+func (l *LocalBlobStore) Put(key string, body []byte, contentType string) (string, error) {
+	path, err := l.path(key)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+	if err := ioutil.WriteFile(path, body, 0644); err != nil {
+		return "", err
+	}
+	return l.baseURL + "/" + key, nil
+}
+
+func (l *LocalBlobStore) Delete(key string) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// 保存したファイルを配信するハンドラ
+func (l *LocalBlobStore) Handler() http.Handler {
+	return http.FileServer(http.Dir(l.dir))
+}
+
+// ==================== S3 ====================
+type S3BlobStore struct {
+	s3      *s3.S3
+	bucket  string
+	baseURL string
+}
+
+func NewS3BlobStore(client *s3.S3, bucket, baseURL string) *S3BlobStore {
+	if baseURL == "" {
+		baseURL = "https://" + bucket + ".s3." + aws.StringValue(client.Config.Region) + ".amazonaws.com"
+		if client.Config.Endpoint != nil {
+			baseURL = strings.TrimRight(*client.Config.Endpoint, "/") + "/" + bucket
+		}
+	}
+	return &S3BlobStore{
+		s3:      client,
+		bucket:  bucket,
+		baseURL: strings.TrimRight(baseURL, "/"),
+	}
+}
+
+func (b *S3BlobStore) Put(key string, body []byte, contentType string) (string, error) {
+	_, err := b.s3.PutObject(&s3.PutObjectInput{
+		Bucket:      aws.String(b.bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(body),
+		ContentType: aws.String(contentType),
+	})
+	if err != nil {
+		return "", err
+	}
+	return b.baseURL + "/" + key, nil
+}
+
+func (b *S3BlobStore) Delete(key string) error {
+	_, err := b.s3.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(b.bucket),
+		Key:    aws.String(key),
+	})
+	return err
+}
@@ -0,0 +1,58 @@
+// 各サービスで共通の処理
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/rs/cors"
+)
+
+// io.Readerをbyteのスライスに変換
+func StreamToByte(stream io.Reader) []byte {
+	buf := new(bytes.Buffer)
+	buf.ReadFrom(stream)
+	return buf.Bytes()
+}
+
+// エラーレスポンスの構造体
+type ErrorResponse struct {
+	Message string `json:"message"`
+}
+
+// ステータスコードとメッセージをJSONで返却
+func WriteError(w http.ResponseWriter, status int, message string) {
+	j, _ := json.Marshal(ErrorResponse{Message: message})
+	w.WriteHeader(status)
+	w.Write(j)
+
+	// エラーのログ
+	fmt.Println(status, message)
+}
+
+// 管理画面の一覧に削除済みの項目を含めるか（?includeDeleted=true）
+func IncludeDeleted(r *http.Request) bool {
+	v := r.URL.Query().Get("includeDeleted")
+	return v == "true" || v == "1"
+}
+
+// 全てのサービスで同じCORSの設定
+func CORS(h http.Handler) http.Handler {
+	return cors.New(cors.Options{
+		AllowedOrigins: []string{"*"},
+		AllowedHeaders: []string{"*"},
+		// 作成時のLocationと楽観的ロックのETagをフロントエンドから読めるようにする
+		ExposedHeaders: []string{"ETag", "Location"},
+		AllowedMethods: []string{
+			http.MethodHead,
+			http.MethodGet,
+			http.MethodPost,
+			http.MethodPatch,
+			http.MethodPut,
+			http.MethodDelete,
+		},
+	}).Handler(h)
+}
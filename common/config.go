@@ -0,0 +1,562 @@
+package common
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/mail"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"gopkg.in/yaml.v2"
+)
+
+// 全サービスの設定
+//
+// 既定値 → 設定ファイル（YAML） → 環境変数 の順に読み込み、後のものが優先される
+type Config struct {
+	// AWSのリージョン（REGION）
+	Region string `yaml:"region"`
+	// 空の場合はAWS SDKの既定の方法で認証情報を探す（AWS_ACCESS_KEY_ID・AWS_SECRET_ACCESS_KEY）
+	AccessKeyID     string `yaml:"accessKeyId"`
+	SecretAccessKey string `yaml:"secretAccessKey"`
+
+	Endpoints EndpointConfig `yaml:"endpoints"`
+	// サービス名ごとの待ち受けアドレス（<サービス名>_ADDR、例 : END_USER_ADDR）
+	Addrs  map[string]string `yaml:"addrs"`
+	Tables Tables            `yaml:"tables"`
+	// テーブル名の接頭辞（TABLE_PREFIX、例 : dev_ → dev_Recruits）
+	// 同じAWSアカウントで環境ごと・テストの実行ごとにテーブルを分ける
+	TablePrefix string `yaml:"tablePrefix"`
+
+	Mail MailConfig `yaml:"mail"`
+	Blob BlobConfig `yaml:"blob"`
+
+	// メール本文などに載せるフロントエンドのURL（PUBLIC_BASE_URL）
+	PublicBaseURL string `yaml:"publicBaseUrl"`
+	// ボードのidの採番
+	RecruitIDs IDConfig `yaml:"recruitIds"`
+	// 退会からEndUsersの行を完全に削除するまでの日数（ACCOUNT_DELETE_GRACE_DAYS）
+	DeleteGraceDays int `yaml:"deleteGraceDays"`
+	// 募集者が削除したボードをTTLで完全に削除するまでの日数（RECRUIT_DELETE_RETENTION_DAYS）
+	RecruitRetentionDays int `yaml:"recruitRetentionDays"`
+	// 変更イベントの処理（worker）
+	Events EventsConfig `yaml:"events"`
+	// Webhookの送信
+	Webhooks WebhooksConfig `yaml:"webhooks"`
+	// 管理画面の理由コードのJSON（MODERATION_REASONS_FILE、空の場合は既定の理由コード）
+	ModerationReasonsFile string `yaml:"moderationReasonsFile"`
+	// connpassの代わりに返すイベントのJSON（CONNPASS_EVENTS_FILE、seedで生成する）
+	ConnpassEventsFile string `yaml:"connpassEventsFile"`
+}
+
+// 接続先（空の場合はAWSの既定の接続先）
+type EndpointConfig struct {
+	DB  string `yaml:"db"`  // ENDPOINT_DB
+	SES string `yaml:"ses"` // ENDPOINT_SES
+	S3  string `yaml:"s3"`  // ENDPOINT_S3
+}
+
+// テーブル名（TABLE_<テーブル名>、例 : TABLE_END_USERS。接頭辞は含めない）
+type Tables struct {
+	EndUsers        string `yaml:"endUsers"`
+	Recruits        string `yaml:"recruits"`
+	AtomicCounter   string `yaml:"atomicCounter"`
+	Sessions        string `yaml:"sessions"`
+	UserEmails      string `yaml:"userEmails"`
+	IdempotencyKeys string `yaml:"idempotencyKeys"`
+	Reports         string `yaml:"reports"`
+	Impersonations  string `yaml:"impersonations"`
+	// ボードの作成者（uidごとの一覧用）
+	RecruitOwners string `yaml:"recruitOwners"`
+	// ボードの参加者（uidごとの一覧用）
+	Memberships string `yaml:"memberships"`
+	// 変更イベントのworkerがシャードごとに読み終えた位置
+	StreamCheckpoints string `yaml:"streamCheckpoints"`
+	// ボード・ユーザーごとのWebhookの登録
+	Webhooks string `yaml:"webhooks"`
+	// Webhookの送信結果（有効期限あり）
+	WebhookDeliveries string `yaml:"webhookDeliveries"`
+	// migrate で適用済みのバージョン
+	SchemaMigrations string `yaml:"schemaMigrations"`
+}
+
+// 全てのテーブル名
+func (t Tables) Names() []string {
+	return []string{
+		t.EndUsers,
+		t.Recruits,
+		t.AtomicCounter,
+		t.Sessions,
+		t.UserEmails,
+		t.IdempotencyKeys,
+		t.Reports,
+		t.Impersonations,
+		t.RecruitOwners,
+		t.Memberships,
+		t.StreamCheckpoints,
+		t.Webhooks,
+		t.WebhookDeliveries,
+		t.SchemaMigrations,
+	}
+}
+
+// 設定ファイルのキーとテーブル名（backupのファイル名に使い、接頭辞が違う環境にも復元できるようにする）
+func (t Tables) ByKey() map[string]string {
+	return map[string]string{
+		"endUsers":          t.EndUsers,
+		"recruits":          t.Recruits,
+		"atomicCounter":     t.AtomicCounter,
+		"sessions":          t.Sessions,
+		"userEmails":        t.UserEmails,
+		"idempotencyKeys":   t.IdempotencyKeys,
+		"reports":           t.Reports,
+		"impersonations":    t.Impersonations,
+		"recruitOwners":     t.RecruitOwners,
+		"memberships":       t.Memberships,
+		"streamCheckpoints": t.StreamCheckpoints,
+		"webhooks":          t.Webhooks,
+		"webhookDeliveries": t.WebhookDeliveries,
+		"schemaMigrations":  t.SchemaMigrations,
+	}
+}
+
+// 全てのテーブル名にprefixを付ける
+func (t Tables) WithPrefix(prefix string) Tables {
+	return Tables{
+		EndUsers:          prefix + t.EndUsers,
+		Recruits:          prefix + t.Recruits,
+		AtomicCounter:     prefix + t.AtomicCounter,
+		Sessions:          prefix + t.Sessions,
+		UserEmails:        prefix + t.UserEmails,
+		IdempotencyKeys:   prefix + t.IdempotencyKeys,
+		Reports:           prefix + t.Reports,
+		Impersonations:    prefix + t.Impersonations,
+		RecruitOwners:     prefix + t.RecruitOwners,
+		Memberships:       prefix + t.Memberships,
+		StreamCheckpoints: prefix + t.StreamCheckpoints,
+		Webhooks:          prefix + t.Webhooks,
+		WebhookDeliveries: prefix + t.WebhookDeliveries,
+		SchemaMigrations:  prefix + t.SchemaMigrations,
+	}
+}
+
+// idの採番の方法
+type IDConfig struct {
+	// RECRUIT_ID_STRATEGY : counter（AtomicCounterの連番）または time（作成日時順の数値）
+	Strategy string `yaml:"strategy"`
+	// RECRUIT_ID_BLOCK_SIZE : counterの場合に1回でまとめて確保する数（インスタンスごとに確保し、再起動で残りは欠番になる）
+	BlockSize int `yaml:"blockSize"`
+}
+
+// 変更イベントの処理
+type EventsConfig struct {
+	// EVENT_HANDLERS : workerで実行するハンドラー（カンマ区切り : mail, stats, webhook, log）
+	// mail を含むworkerを動かす場合は、RecruitAPIの MAIL_VIA_WORKER を true にする
+	Handlers []string `yaml:"handlers"`
+	// EVENT_POLL_SECONDS : ストリームを読む間隔（秒）
+	PollSeconds int `yaml:"pollSeconds"`
+}
+
+// workerで実行できるハンドラー
+var EventHandlerNames = []string{"mail", "stats", "webhook", "log"}
+
+// nameのハンドラーを実行するか
+func (e EventsConfig) Enabled(name string) bool {
+	for _, h := range e.Handlers {
+		if h == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Webhookの送信
+type WebhooksConfig struct {
+	// WEBHOOK_TIMEOUT_SECONDS : 1回の送信のタイムアウト（秒）
+	TimeoutSeconds int `yaml:"timeoutSeconds"`
+	// WEBHOOK_ATTEMPTS : 失敗した場合を含めた送信の回数
+	Attempts int `yaml:"attempts"`
+	// WEBHOOK_ALLOW_PRIVATE : http:// と、localhost・プライベートIPのURLを許可する（ローカル開発のみ）
+	AllowPrivate bool `yaml:"allowPrivate"`
+}
+
+// 通知メールの送信元
+type MailConfig struct {
+	Sender     string `yaml:"sender"`     // MAIL_SENDER
+	SenderName string `yaml:"senderName"` // MAIL_SENDER_NAME
+	// 本文に載せる問い合わせ先（MAIL_SUPPORT）
+	Support string `yaml:"support"`
+	// MAIL_VIA_WORKER : RecruitAPIは参加時のメールを送らず、workerの mail ハンドラーに任せる
+	ViaWorker bool `yaml:"viaWorker"`
+}
+
+// 画像などの保存先
+type BlobConfig struct {
+	Store   string `yaml:"store"`   // BLOB_STORE : local または s3
+	Dir     string `yaml:"dir"`     // BLOB_DIR
+	Bucket  string `yaml:"bucket"`  // BLOB_BUCKET
+	BaseURL string `yaml:"baseUrl"` // BLOB_BASE_URL
+}
+
+// 既定の設定（待ち受けアドレスはdocker-composeのポートに合わせる）
+func DefaultConfig() *Config {
+	return &Config{
+		Addrs: map[string]string{
+			"end_user":       ":60001",
+			"recruit":        ":60002",
+			"connpass":       ":60003",
+			"admin_end_user": ":60011",
+			"admin_recruit":  ":60012",
+		},
+		Tables: Tables{
+			EndUsers:          "EndUsers",
+			Recruits:          "Recruits",
+			AtomicCounter:     "AtomicCounter",
+			Sessions:          "Sessions",
+			UserEmails:        "UserEmails",
+			IdempotencyKeys:   "IdempotencyKeys",
+			Reports:           "Reports",
+			Impersonations:    "Impersonations",
+			RecruitOwners:     "RecruitOwners",
+			Memberships:       "Memberships",
+			StreamCheckpoints: "StreamCheckpoints",
+			Webhooks:          "Webhooks",
+			WebhookDeliveries: "WebhookDeliveries",
+			SchemaMigrations:  "SchemaMigrations",
+		},
+		Mail: MailConfig{
+			Sender:     "info@raityupiyo.dev",
+			SenderName: "GuildHack",
+			Support:    "support@raityupiyo.dev",
+		},
+		Blob: BlobConfig{
+			Store: "local",
+			Dir:   "./storage",
+		},
+		RecruitIDs: IDConfig{
+			Strategy:  "counter",
+			BlockSize: 1,
+		},
+		Events: EventsConfig{
+			Handlers:    []string{"stats"},
+			PollSeconds: 1,
+		},
+		Webhooks: WebhooksConfig{
+			TimeoutSeconds: 5,
+			Attempts:       3,
+		},
+		PublicBaseURL:        "https://raityupiyo.dev",
+		DeleteGraceDays:      30,
+		RecruitRetentionDays: 30,
+	}
+}
+
+// 設定を読み込み、検証する（pathが空の場合は設定ファイルを読まない）
+func LoadConfig(path string) (*Config, error) {
+	cfg := DefaultConfig()
+	if path != "" {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		// 既定値の入ったmapには書き込めないため、読み込んだ後に上書きする
+		addrs := cfg.Addrs
+		cfg.Addrs = nil
+		if err := yaml.UnmarshalStrict(b, cfg); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		for name, addr := range cfg.Addrs {
+			addrs[name] = addr
+		}
+		cfg.Addrs = addrs
+	}
+	if err := cfg.loadEnv(); err != nil {
+		return nil, err
+	}
+	cfg.Tables = cfg.Tables.WithPrefix(cfg.TablePrefix)
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (c *Config) loadEnv() error {
+	for key, dest := range map[string]*string{
+		"REGION":                   &c.Region,
+		"AWS_ACCESS_KEY_ID":        &c.AccessKeyID,
+		"AWS_SECRET_ACCESS_KEY":    &c.SecretAccessKey,
+		"ENDPOINT_DB":              &c.Endpoints.DB,
+		"ENDPOINT_SES":             &c.Endpoints.SES,
+		"ENDPOINT_S3":              &c.Endpoints.S3,
+		"TABLE_END_USERS":          &c.Tables.EndUsers,
+		"TABLE_RECRUITS":           &c.Tables.Recruits,
+		"TABLE_ATOMIC_COUNTER":     &c.Tables.AtomicCounter,
+		"TABLE_SESSIONS":           &c.Tables.Sessions,
+		"TABLE_USER_EMAILS":        &c.Tables.UserEmails,
+		"TABLE_IDEMPOTENCY_KEYS":   &c.Tables.IdempotencyKeys,
+		"TABLE_REPORTS":            &c.Tables.Reports,
+		"TABLE_IMPERSONATIONS":     &c.Tables.Impersonations,
+		"TABLE_RECRUIT_OWNERS":     &c.Tables.RecruitOwners,
+		"TABLE_MEMBERSHIPS":        &c.Tables.Memberships,
+		"TABLE_STREAM_CHECKPOINTS": &c.Tables.StreamCheckpoints,
+		"TABLE_WEBHOOKS":           &c.Tables.Webhooks,
+		"TABLE_WEBHOOK_DELIVERIES": &c.Tables.WebhookDeliveries,
+		"TABLE_SCHEMA_MIGRATIONS":  &c.Tables.SchemaMigrations,
+		"TABLE_PREFIX":             &c.TablePrefix,
+		"MAIL_SENDER":              &c.Mail.Sender,
+		"MAIL_SENDER_NAME":         &c.Mail.SenderName,
+		"MAIL_SUPPORT":             &c.Mail.Support,
+		"BLOB_STORE":               &c.Blob.Store,
+		"BLOB_DIR":                 &c.Blob.Dir,
+		"BLOB_BUCKET":              &c.Blob.Bucket,
+		"BLOB_BASE_URL":            &c.Blob.BaseURL,
+		"PUBLIC_BASE_URL":          &c.PublicBaseURL,
+		"RECRUIT_ID_STRATEGY":      &c.RecruitIDs.Strategy,
+		"MODERATION_REASONS_FILE":  &c.ModerationReasonsFile,
+		"CONNPASS_EVENTS_FILE":     &c.ConnpassEventsFile,
+	} {
+		if v, ok := os.LookupEnv(key); ok && v != "" {
+			*dest = v
+		}
+	}
+	for name := range c.Addrs {
+		if v := os.Getenv(strings.ToUpper(name) + "_ADDR"); v != "" {
+			c.Addrs[name] = v
+		}
+	}
+	if v := os.Getenv("ACCOUNT_DELETE_GRACE_DAYS"); v != "" {
+		days, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("ACCOUNT_DELETE_GRACE_DAYS must be a number: %q", v)
+		}
+		c.DeleteGraceDays = days
+	}
+	if v := os.Getenv("EVENT_HANDLERS"); v != "" {
+		c.Events.Handlers = nil
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				c.Events.Handlers = append(c.Events.Handlers, name)
+			}
+		}
+	}
+	if v := os.Getenv("EVENT_POLL_SECONDS"); v != "" {
+		seconds, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("EVENT_POLL_SECONDS must be a number: %q", v)
+		}
+		c.Events.PollSeconds = seconds
+	}
+	for name, dst := range map[string]*int{
+		"WEBHOOK_TIMEOUT_SECONDS": &c.Webhooks.TimeoutSeconds,
+		"WEBHOOK_ATTEMPTS":        &c.Webhooks.Attempts,
+	} {
+		if v := os.Getenv(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return fmt.Errorf("%s must be a number: %q", name, v)
+			}
+			*dst = n
+		}
+	}
+	if v := os.Getenv("MAIL_VIA_WORKER"); v != "" {
+		via, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("MAIL_VIA_WORKER must be true or false: %q", v)
+		}
+		c.Mail.ViaWorker = via
+	}
+	if v := os.Getenv("WEBHOOK_ALLOW_PRIVATE"); v != "" {
+		allow, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("WEBHOOK_ALLOW_PRIVATE must be true or false: %q", v)
+		}
+		c.Webhooks.AllowPrivate = allow
+	}
+	if v := os.Getenv("RECRUIT_DELETE_RETENTION_DAYS"); v != "" {
+		days, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("RECRUIT_DELETE_RETENTION_DAYS must be a number: %q", v)
+		}
+		c.RecruitRetentionDays = days
+	}
+	if v := os.Getenv("RECRUIT_ID_BLOCK_SIZE"); v != "" {
+		size, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("RECRUIT_ID_BLOCK_SIZE must be a number: %q", v)
+		}
+		c.RecruitIDs.BlockSize = size
+	}
+	return nil
+}
+
+var (
+	tableNamePattern   = regexp.MustCompile(`^[a-zA-Z0-9_.-]{3,255}$`)
+	tablePrefixPattern = regexp.MustCompile(`^[a-zA-Z0-9_.-]*$`)
+)
+
+// 設定の誤りをまとめて返す
+func (c *Config) Validate() error {
+	errs := []string{}
+	add := func(format string, a ...interface{}) {
+		errs = append(errs, fmt.Sprintf(format, a...))
+	}
+
+	if c.Region == "" {
+		add("region (REGION) is required")
+	}
+	if (c.AccessKeyID == "") != (c.SecretAccessKey == "") {
+		add("accessKeyId (AWS_ACCESS_KEY_ID) and secretAccessKey (AWS_SECRET_ACCESS_KEY) must be set together")
+	}
+	for _, e := range []struct{ key, endpoint string }{
+		{"endpoints.db (ENDPOINT_DB)", c.Endpoints.DB},
+		{"endpoints.ses (ENDPOINT_SES)", c.Endpoints.SES},
+		{"endpoints.s3 (ENDPOINT_S3)", c.Endpoints.S3},
+	} {
+		if e.endpoint != "" && !isHTTPURL(e.endpoint) {
+			add("%s must be an http(s) URL: %q", e.key, e.endpoint)
+		}
+	}
+
+	names := make([]string, 0, len(c.Addrs))
+	for name := range c.Addrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, port, err := net.SplitHostPort(c.Addrs[name]); err != nil || port == "" {
+			add("addrs.%s (%s_ADDR) must be host:port: %q", name, strings.ToUpper(name), c.Addrs[name])
+		}
+	}
+
+	if !tablePrefixPattern.MatchString(c.TablePrefix) {
+		add("tablePrefix (TABLE_PREFIX) may only contain a-z, A-Z, 0-9, _, - and .: %q", c.TablePrefix)
+	}
+	for _, t := range []struct{ key, name string }{
+		{"endUsers", c.Tables.EndUsers},
+		{"recruits", c.Tables.Recruits},
+		{"atomicCounter", c.Tables.AtomicCounter},
+		{"sessions", c.Tables.Sessions},
+		{"userEmails", c.Tables.UserEmails},
+		{"idempotencyKeys", c.Tables.IdempotencyKeys},
+		{"reports", c.Tables.Reports},
+		{"impersonations", c.Tables.Impersonations},
+		{"recruitOwners", c.Tables.RecruitOwners},
+		{"memberships", c.Tables.Memberships},
+		{"streamCheckpoints", c.Tables.StreamCheckpoints},
+		{"webhooks", c.Tables.Webhooks},
+		{"webhookDeliveries", c.Tables.WebhookDeliveries},
+		{"schemaMigrations", c.Tables.SchemaMigrations},
+	} {
+		if !tableNamePattern.MatchString(t.name) {
+			add("tables.%s is not a valid table name: %q", t.key, t.name)
+		}
+	}
+
+	if _, err := mail.ParseAddress(c.Mail.Sender); err != nil {
+		add("mail.sender (MAIL_SENDER) must be an email address: %q", c.Mail.Sender)
+	}
+	if c.Mail.SenderName == "" {
+		add("mail.senderName (MAIL_SENDER_NAME) is required")
+	}
+	if _, err := mail.ParseAddress(c.Mail.Support); err != nil {
+		add("mail.support (MAIL_SUPPORT) must be an email address: %q", c.Mail.Support)
+	}
+
+	switch c.Blob.Store {
+	case "local":
+		if c.Blob.Dir == "" {
+			add("blob.dir (BLOB_DIR) is required when blob.store is local")
+		}
+	case "s3":
+		if c.Blob.Bucket == "" {
+			add("blob.bucket (BLOB_BUCKET) is required when blob.store is s3")
+		}
+	default:
+		add("blob.store (BLOB_STORE) must be local or s3: %q", c.Blob.Store)
+	}
+
+	if !isHTTPURL(c.PublicBaseURL) {
+		add("publicBaseUrl (PUBLIC_BASE_URL) must be an http(s) URL: %q", c.PublicBaseURL)
+	}
+	switch c.RecruitIDs.Strategy {
+	case "counter":
+		if c.RecruitIDs.BlockSize < 1 {
+			add("recruitIds.blockSize (RECRUIT_ID_BLOCK_SIZE) must be at least 1")
+		}
+	case "time":
+	default:
+		add("recruitIds.strategy (RECRUIT_ID_STRATEGY) must be counter or time: %q", c.RecruitIDs.Strategy)
+	}
+	if c.DeleteGraceDays < 0 {
+		add("deleteGraceDays (ACCOUNT_DELETE_GRACE_DAYS) must not be negative")
+	}
+	if c.RecruitRetentionDays < 0 {
+		add("recruitRetentionDays (RECRUIT_DELETE_RETENTION_DAYS) must not be negative")
+	}
+	for _, name := range c.Events.Handlers {
+		known := false
+		for _, n := range EventHandlerNames {
+			known = known || n == name
+		}
+		if !known {
+			add("events.handlers (EVENT_HANDLERS) has unknown handler %q (available: %s)", name, strings.Join(EventHandlerNames, ", "))
+		}
+	}
+	if c.Events.PollSeconds < 1 {
+		add("events.pollSeconds (EVENT_POLL_SECONDS) must be at least 1")
+	}
+	if c.Webhooks.TimeoutSeconds < 1 {
+		add("webhooks.timeoutSeconds (WEBHOOK_TIMEOUT_SECONDS) must be at least 1")
+	}
+	if c.Webhooks.Attempts < 1 || c.Webhooks.Attempts > 10 {
+		add("webhooks.attempts (WEBHOOK_ATTEMPTS) must be 1 to 10")
+	}
+	if c.ModerationReasonsFile != "" {
+		if _, err := os.Stat(c.ModerationReasonsFile); err != nil {
+			add("moderationReasonsFile (MODERATION_REASONS_FILE): %v", err)
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid config:\n  %s", strings.Join(errs, "\n  "))
+	}
+	return nil
+}
+
+func isHTTPURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// endpointに接続するAWSのセッション（endpointが空の場合はAWSの既定の接続先）
+func (c *Config) Session(endpoint string) (*session.Session, error) {
+	cfgs := c.AWS(endpoint)
+	return session.NewSession(&cfgs)
+}
+
+// endpointに接続するAWSの設定
+func (c *Config) AWS(endpoint string) aws.Config {
+	cfgs := aws.Config{
+		Region: aws.String(c.Region),
+	}
+	if endpoint != "" {
+		cfgs.Endpoint = aws.String(endpoint)
+	}
+	if c.AccessKeyID != "" {
+		cfgs.Credentials = credentials.NewStaticCredentials(c.AccessKeyID, c.SecretAccessKey, "")
+	}
+	return cfgs
+}
+
+// 通知メールの送信元（"名前<アドレス>"）
+func (m MailConfig) From() string {
+	return m.SenderName + "<" + m.Sender + ">"
+}
@@ -0,0 +1,359 @@
+// テスト用のDynamoDB（メモリ上に項目を持つHTTPサーバー）
+//
+// ハンドラーのテストで、DynamoDB Localを起動せずに *dynamodb.DynamoDB を使うためのもの。
+// GetItem・PutItem・Scan・Query・BatchGetItemのみに対応し、
+// 式は "=", "<>", attribute_exists, attribute_not_exists の AND のみを解釈する（それ以外はエラーを返す）
+package dynamotest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+type item = map[string]*dynamodb.AttributeValue
+
+type Server struct {
+	srv *httptest.Server
+
+	mu     sync.Mutex
+	keys   map[string][]string
+	tables map[string][]item
+}
+
+// 空のDynamoDBを起動する（Closeで停止する）
+func New() *Server {
+	s := &Server{
+		keys:   map[string][]string{},
+		tables: map[string][]item{},
+	}
+	s.srv = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// サーバーに接続するクライアント（再試行しない）
+func (s *Server) Client() *dynamodb.DynamoDB {
+	sess := session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String("ap-northeast-1"),
+		Endpoint:    aws.String(s.srv.URL),
+		Credentials: credentials.NewStaticCredentials("test", "test", ""),
+		MaxRetries:  aws.Int(0),
+	}))
+	return dynamodb.New(sess)
+}
+
+// tableのキーの属性名（パーティションキー、ソートキーの順）
+func (s *Server) Table(table string, keys ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[table] = keys
+}
+
+// vをtableに保存する（同じキーの項目は置き換える）
+func (s *Server) Put(table string, v interface{}) {
+	av, err := dynamodbattribute.MarshalMap(v)
+	if err != nil {
+		panic(err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.put(table, av)
+}
+
+func (s *Server) put(table string, av item) {
+	for i, it := range s.tables[table] {
+		if s.sameKey(table, it, av) {
+			s.tables[table][i] = av
+			return
+		}
+	}
+	s.tables[table] = append(s.tables[table], av)
+}
+
+func (s *Server) sameKey(table string, a, b item) bool {
+	keys := s.keys[table]
+	if len(keys) == 0 {
+		return false
+	}
+	for _, k := range keys {
+		if a[k] == nil || b[k] == nil || !reflect.DeepEqual(a[k], b[k]) {
+			return false
+		}
+	}
+	return true
+}
+
+// ==================== HTTP ====================
+type apiError struct {
+	code    string
+	message string
+}
+
+func (e *apiError) Error() string { return e.message }
+
+func validation(format string, args ...interface{}) error {
+	return &apiError{code: "ValidationException", message: fmt.Sprintf(format, args...)}
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	target := r.Header.Get("X-Amz-Target")
+	op := target[strings.LastIndex(target, ".")+1:]
+
+	var res interface{}
+	var err error
+	s.mu.Lock()
+	switch op {
+	case "GetItem":
+		var in dynamodb.GetItemInput
+		if err = decode(r, &in); err == nil {
+			res, err = s.getItem(&in)
+		}
+	case "PutItem":
+		var in dynamodb.PutItemInput
+		if err = decode(r, &in); err == nil {
+			s.put(aws.StringValue(in.TableName), in.Item)
+			res = map[string]interface{}{}
+		}
+	case "Scan":
+		var in dynamodb.ScanInput
+		if err = decode(r, &in); err == nil {
+			res, err = s.find(aws.StringValue(in.TableName), "", in.FilterExpression, in.ProjectionExpression, in.ExpressionAttributeNames, in.ExpressionAttributeValues)
+		}
+	case "Query":
+		var in dynamodb.QueryInput
+		if err = decode(r, &in); err == nil {
+			res, err = s.find(aws.StringValue(in.TableName), aws.StringValue(in.KeyConditionExpression), in.FilterExpression, in.ProjectionExpression, in.ExpressionAttributeNames, in.ExpressionAttributeValues)
+		}
+	case "BatchGetItem":
+		var in dynamodb.BatchGetItemInput
+		if err = decode(r, &in); err == nil {
+			res, err = s.batchGetItem(&in)
+		}
+	default:
+		err = &apiError{code: "UnknownOperationException", message: "unsupported operation " + op}
+	}
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+	if err != nil {
+		code := "InternalServerError"
+		if aerr, ok := err.(*apiError); ok {
+			code = aerr.code
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"__type":  "com.amazonaws.dynamodb.v20120810#" + code,
+			"message": err.Error(),
+		})
+		return
+	}
+	json.NewEncoder(w).Encode(res)
+}
+
+func decode(r *http.Request, v interface{}) error {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		return validation("invalid request: %s", err)
+	}
+	return nil
+}
+
+// ==================== Operations ====================
+func (s *Server) getItem(in *dynamodb.GetItemInput) (interface{}, error) {
+	table := aws.StringValue(in.TableName)
+	for _, it := range s.tables[table] {
+		if s.sameKey(table, it, in.Key) {
+			return map[string]interface{}{"Item": encodeItem(it)}, nil
+		}
+	}
+	return map[string]interface{}{}, nil
+}
+
+func (s *Server) find(table, keyCond string, filter, projection *string, names map[string]*string, values item) (interface{}, error) {
+	items := []interface{}{}
+	for _, it := range s.tables[table] {
+		for _, expr := range []string{keyCond, aws.StringValue(filter)} {
+			ok, err := match(expr, it, names, values)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				it = nil
+				break
+			}
+		}
+		if it == nil {
+			continue
+		}
+		projected, err := project(it, aws.StringValue(projection), names)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, encodeItem(projected))
+	}
+	return map[string]interface{}{
+		"Items":        items,
+		"Count":        len(items),
+		"ScannedCount": len(items),
+	}, nil
+}
+
+func (s *Server) batchGetItem(in *dynamodb.BatchGetItemInput) (interface{}, error) {
+	responses := map[string][]interface{}{}
+	for table, req := range in.RequestItems {
+		if len(req.Keys) > 100 {
+			return nil, validation("too many keys")
+		}
+		responses[table] = []interface{}{}
+		for _, key := range req.Keys {
+			for _, it := range s.tables[table] {
+				if !s.sameKey(table, it, key) {
+					continue
+				}
+				projected, err := project(it, aws.StringValue(req.ProjectionExpression), req.ExpressionAttributeNames)
+				if err != nil {
+					return nil, err
+				}
+				responses[table] = append(responses[table], encodeItem(projected))
+			}
+		}
+	}
+	return map[string]interface{}{
+		"Responses":       responses,
+		"UnprocessedKeys": map[string]interface{}{},
+	}, nil
+}
+
+// ==================== Expression ====================
+func name(token string, names map[string]*string) (string, error) {
+	token = strings.TrimSpace(token)
+	if strings.HasPrefix(token, "#") {
+		if names[token] == nil {
+			return "", validation("undefined name %s", token)
+		}
+		return *names[token], nil
+	}
+	return token, nil
+}
+
+// exprをitemが満たすか（空の式は常に満たす）
+func match(expr string, it item, names map[string]*string, values item) (bool, error) {
+	expr = strings.TrimSpace(expr)
+	if expr == "" {
+		return true, nil
+	}
+	if strings.Contains(expr, " OR ") || strings.Contains(expr, "NOT ") {
+		return false, validation("unsupported expression %q", expr)
+	}
+	for _, cond := range strings.Split(expr, " AND ") {
+		cond = strings.Trim(strings.TrimSpace(cond), "()")
+		var ok bool
+		switch {
+		case strings.HasPrefix(cond, "attribute_exists(") || strings.HasPrefix(cond, "attribute_not_exists("):
+			open := strings.Index(cond, "(")
+			attr, err := name(strings.TrimSuffix(cond[open+1:], ")"), names)
+			if err != nil {
+				return false, err
+			}
+			ok = it[attr] != nil
+			if strings.HasPrefix(cond, "attribute_not_exists(") {
+				ok = !ok
+			}
+		case strings.Contains(cond, "<>") || strings.Contains(cond, "="):
+			op := "="
+			if strings.Contains(cond, "<>") {
+				op = "<>"
+			}
+			parts := strings.SplitN(cond, op, 2)
+			attr, err := name(parts[0], names)
+			if err != nil {
+				return false, err
+			}
+			value := values[strings.TrimSpace(parts[1])]
+			if value == nil {
+				return false, validation("undefined value %s", parts[1])
+			}
+			ok = it[attr] != nil && reflect.DeepEqual(it[attr], value)
+			if op == "<>" {
+				ok = !ok
+			}
+		default:
+			return false, validation("unsupported condition %q", cond)
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// projectionの項目のみ（空の場合は全ての項目）
+func project(it item, projection string, names map[string]*string) (item, error) {
+	if projection == "" {
+		return it, nil
+	}
+	res := item{}
+	for _, token := range strings.Split(projection, ",") {
+		attr, err := name(token, names)
+		if err != nil {
+			return nil, err
+		}
+		if it[attr] != nil {
+			res[attr] = it[attr]
+		}
+	}
+	return res, nil
+}
+
+// ==================== JSON ====================
+// AttributeValueをnilの項目を含めないJSONの値に変換する
+func encodeItem(it item) map[string]interface{} {
+	res := map[string]interface{}{}
+	for k, v := range it {
+		res[k] = encodeValue(v)
+	}
+	return res
+}
+
+func encodeValue(v *dynamodb.AttributeValue) map[string]interface{} {
+	switch {
+	case v.S != nil:
+		return map[string]interface{}{"S": *v.S}
+	case v.N != nil:
+		return map[string]interface{}{"N": *v.N}
+	case v.BOOL != nil:
+		return map[string]interface{}{"BOOL": *v.BOOL}
+	case v.NULL != nil:
+		return map[string]interface{}{"NULL": *v.NULL}
+	case v.B != nil:
+		return map[string]interface{}{"B": v.B}
+	case v.M != nil:
+		return map[string]interface{}{"M": encodeItem(v.M)}
+	case v.L != nil:
+		l := make([]interface{}, 0, len(v.L))
+		for _, e := range v.L {
+			l = append(l, encodeValue(e))
+		}
+		return map[string]interface{}{"L": l}
+	case v.SS != nil:
+		return map[string]interface{}{"SS": v.SS}
+	case v.NS != nil:
+		return map[string]interface{}{"NS": v.NS}
+	case v.BS != nil:
+		return map[string]interface{}{"BS": v.BS}
+	}
+	return map[string]interface{}{"NULL": true}
+}
@@ -0,0 +1,149 @@
+package common
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"net/http"
+)
+
+// ==================== Image ====================
+// アバターと募集の画像のアップロードで共有する
+
+const (
+	maxImageBytes     = 5 << 20 // アップロードできる画像の上限（5MB）
+	maxImageDimension = 4096    // 縦横の最大ピクセル数
+	thumbnailSize     = 200     // サムネイルの長辺のピクセル数
+	imageFormField    = "image" // multipartのフィールド名
+)
+
+// アップロードを受け付ける形式
+var allowedImageTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+}
+
+// 保存用に変換した画像
+type ProcessedImage struct {
+	Original    []byte
+	Thumbnail   []byte
+	Ext         string
+	ContentType string
+}
+
+// multipartの画像を読み込み、形式とサイズを検証する
+func ReadUploadedImage(w http.ResponseWriter, r *http.Request) ([]byte, int, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxImageBytes+1<<20)
+	if err := r.ParseMultipartForm(maxImageBytes); err != nil {
+		return nil, http.StatusRequestEntityTooLarge, fmt.Errorf("image must be at most %d bytes", maxImageBytes)
+	}
+	file, header, err := r.FormFile(imageFormField)
+	if err != nil {
+		return nil, http.StatusBadRequest, fmt.Errorf("multipart field %q is required", imageFormField)
+	}
+	defer file.Close()
+	if header.Size > maxImageBytes {
+		return nil, http.StatusRequestEntityTooLarge, fmt.Errorf("image must be at most %d bytes", maxImageBytes)
+	}
+
+	body, err := ioutil.ReadAll(file)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	if !allowedImageTypes[http.DetectContentType(body)] {
+		return nil, http.StatusUnsupportedMediaType, fmt.Errorf("image must be jpeg, png or gif")
+	}
+	return body, http.StatusOK, nil
+}
+
+// 画像を再エンコードし（メタデータは除去される）、サムネイルを作成する
+func ProcessImage(body []byte) (*ProcessedImage, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if config.Width > maxImageDimension || config.Height > maxImageDimension {
+		return nil, fmt.Errorf("image must be at most %dx%d pixels", maxImageDimension, maxImageDimension)
+	}
+	src, format, err := image.Decode(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	res := &ProcessedImage{Ext: "png", ContentType: "image/png"}
+	if format == "jpeg" {
+		res.Ext = "jpg"
+		res.ContentType = "image/jpeg"
+	}
+	if res.Original, err = encodeImage(src, format); err != nil {
+		return nil, err
+	}
+	if res.Thumbnail, err = encodeImage(Thumbnail(src, thumbnailSize), format); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func encodeImage(img image.Image, format string) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	var err error
+	if format == "jpeg" {
+		err = jpeg.Encode(buf, img, &jpeg.Options{Quality: 85})
+	} else {
+		err = png.Encode(buf, img)
+	}
+	return buf.Bytes(), err
+}
+
+// 長辺がsizeに収まるように縮小（各画素は元画像の範囲の平均）
+func Thumbnail(src image.Image, size int) image.Image {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	tw, th := w, h
+	if w > size || h > size {
+		if w >= h {
+			tw, th = size, h*size/w
+		} else {
+			tw, th = w*size/h, size
+		}
+	}
+	if tw < 1 {
+		tw = 1
+	}
+	if th < 1 {
+		th = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, tw, th))
+	for y := 0; y < th; y++ {
+		sy0, sy1 := b.Min.Y+y*h/th, b.Min.Y+(y+1)*h/th
+		if sy1 <= sy0 {
+			sy1 = sy0 + 1
+		}
+		for x := 0; x < tw; x++ {
+			sx0, sx1 := b.Min.X+x*w/tw, b.Min.X+(x+1)*w/tw
+			if sx1 <= sx0 {
+				sx1 = sx0 + 1
+			}
+			var rs, gs, bs, as, n uint64
+			for sy := sy0; sy < sy1; sy++ {
+				for sx := sx0; sx < sx1; sx++ {
+					r, g, b, a := src.At(sx, sy).RGBA()
+					rs, gs, bs, as = rs+uint64(r), gs+uint64(g), bs+uint64(b), as+uint64(a)
+					n++
+				}
+			}
+			i := dst.PixOffset(x, y)
+			dst.Pix[i+0] = uint8(rs / n >> 8)
+			dst.Pix[i+1] = uint8(gs / n >> 8)
+			dst.Pix[i+2] = uint8(bs / n >> 8)
+			dst.Pix[i+3] = uint8(as / n >> 8)
+		}
+	}
+	return dst
+}
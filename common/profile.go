@@ -0,0 +1,125 @@
+package common
+
+import (
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// ==================== Profile ====================
+// 公開範囲
+const (
+	VisibilityPublic  = "public"
+	VisibilityPrivate = "private"
+)
+
+// 公開範囲を切り替えられる項目
+var VisibilityFields = map[string]bool{
+	"bio":          true,
+	"skills":       true,
+	"positions":    true,
+	"githubUrl":    true,
+	"portfolioUrl": true,
+}
+
+// 退会したユーザーのボードのmembers上のuid
+const DeletedUserUid = "deleted-user"
+
+// スキルタグ
+type Skill struct {
+	Name  *string `json:"name,omitempty" dynamodbav:"name,omitempty"`
+	Level *int    `json:"level,omitempty" dynamodbav:"level,omitempty"`
+}
+
+// EndUsersの項目のうち、他のユーザーに公開できる項目と公開範囲
+//
+// EndUserAPIのプロフィールとRecruitAPIのメンバーのプロフィールで共有する
+type Profile struct {
+	Uid                *string           `json:"uid,omitempty" dynamodbav:"uid,omitempty"`
+	Name               *string           `json:"name,omitempty" dynamodbav:"name,omitempty"`
+	DisplayName        *string           `json:"displayName,omitempty" dynamodbav:"displayName,omitempty"`
+	Bio                *string           `json:"bio,omitempty" dynamodbav:"bio,omitempty"`
+	Skills             []Skill           `json:"skills,omitempty" dynamodbav:"skills,omitempty"`
+	Positions          []string          `json:"positions,omitempty" dynamodbav:"positions,omitempty"`
+	GithubUrl          *string           `json:"githubUrl,omitempty" dynamodbav:"githubUrl,omitempty"`
+	PortfolioUrl       *string           `json:"portfolioUrl,omitempty" dynamodbav:"portfolioUrl,omitempty"`
+	AvatarUrl          *string           `json:"avatarUrl,omitempty" dynamodbav:"avatarUrl,omitempty"`
+	AvatarThumbnailUrl *string           `json:"avatarThumbnailUrl,omitempty" dynamodbav:"avatarThumbnailUrl,omitempty"`
+	Visibility         map[string]string `json:"visibility,omitempty" dynamodbav:"visibility,omitempty"`
+}
+
+// 他のユーザーに公開するプロフィール
+type PublicProfile struct {
+	Uid                *string  `json:"uid,omitempty"`
+	Name               *string  `json:"name,omitempty"`
+	DisplayName        *string  `json:"displayName,omitempty"`
+	Bio                *string  `json:"bio,omitempty"`
+	Skills             []Skill  `json:"skills,omitempty"`
+	Positions          []string `json:"positions,omitempty"`
+	GithubUrl          *string  `json:"githubUrl,omitempty"`
+	PortfolioUrl       *string  `json:"portfolioUrl,omitempty"`
+	AvatarUrl          *string  `json:"avatarUrl,omitempty"`
+	AvatarThumbnailUrl *string  `json:"avatarThumbnailUrl,omitempty"`
+}
+
+// 公開プロフィールの作成に必要な項目
+var publicProfileAttributes = []string{
+	"uid",
+	"name",
+	"displayName",
+	"bio",
+	"skills",
+	"positions",
+	"githubUrl",
+	"portfolioUrl",
+	"avatarUrl",
+	"avatarThumbnailUrl",
+	"visibility",
+}
+
+// 公開プロフィールの項目だけを読み込むProjectionExpressionと属性名（extraの項目も読み込む）
+func PublicProfileProjection(extra ...string) (string, map[string]*string) {
+	names := map[string]*string{}
+	projection := ""
+	for i, attr := range append(append([]string{}, publicProfileAttributes...), extra...) {
+		name := "#p" + strconv.Itoa(i)
+		names[name] = aws.String(attr)
+		if projection != "" {
+			projection += ", "
+		}
+		projection += name
+	}
+	return projection, names
+}
+
+// 項目が公開設定か（未設定は公開）
+func (p *Profile) IsPublic(field string) bool {
+	return p.Visibility[field] != VisibilityPrivate
+}
+
+// 公開範囲を適用したプロフィールを返す
+func (p *Profile) Public() PublicProfile {
+	pub := PublicProfile{
+		Uid:                p.Uid,
+		Name:               p.Name,
+		DisplayName:        p.DisplayName,
+		AvatarUrl:          p.AvatarUrl,
+		AvatarThumbnailUrl: p.AvatarThumbnailUrl,
+	}
+	if p.IsPublic("bio") {
+		pub.Bio = p.Bio
+	}
+	if p.IsPublic("skills") {
+		pub.Skills = p.Skills
+	}
+	if p.IsPublic("positions") {
+		pub.Positions = p.Positions
+	}
+	if p.IsPublic("githubUrl") {
+		pub.GithubUrl = p.GithubUrl
+	}
+	if p.IsPublic("portfolioUrl") {
+		pub.PortfolioUrl = p.PortfolioUrl
+	}
+	return pub
+}
@@ -0,0 +1,99 @@
+// プロフィールを返すルートのテスト用のデータ
+//
+// EndUserAPIとRecruitAPIのテストで、EndUsersに保存される形のユーザーと、
+// 他のユーザーに返してはいけない項目を共有する
+package profiletest
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/hew-team1/all-api-dev/common"
+)
+
+// 非公開にする項目
+var privateFields = []string{"bio", "githubUrl"}
+
+// EndUsersの項目のうち、退会・停止したユーザーにのみあるためStoredUserに含めない項目
+var inactiveUserKeys = []string{"deletedAt", "deletedBy", "purgeAt", "suspendedUntil"}
+
+// EndUsersに保存される形のユーザー（公開プロフィール以外の項目も含み、privateFieldsは非公開）
+func StoredUser(uid string) map[string]interface{} {
+	visibility := map[string]string{}
+	for _, field := range privateFields {
+		visibility[field] = common.VisibilityPrivate
+	}
+	return map[string]interface{}{
+		"uid":                uid,
+		"name":               "山田 太郎",
+		"displayName":        uid + "_name",
+		"bio":                "private bio of " + uid,
+		"githubUrl":          "https://github.com/" + uid,
+		"portfolioUrl":       "https://example.com/" + uid,
+		"visibility":         visibility,
+		"email":              uid + "@example.com",
+		"avatarKey":          "avatars/" + uid + ".png",
+		"avatarThumbnailKey": "avatars/" + uid + "_thumb.png",
+		"created":            "2021-01-01 00:00",
+		"updated":            "2021-01-02 00:00",
+		"isActive":           true,
+		"isLogin":            true,
+		"sessionId":          "session-" + uid,
+		"moderationReason":   "mistake",
+		"moderationNote":     "note about " + uid,
+		"moderated":          "2021-01-03 00:00",
+		"version":            3,
+	}
+}
+
+// Recruitsに保存される形のボード（ownerが作成し、membersが参加した）
+func StoredRecruit(id int, owner string, members ...string) map[string]interface{} {
+	list := []map[string]string{{"uid": owner, "position": "backend"}}
+	for _, uid := range members {
+		list = append(list, map[string]string{"uid": uid, "position": "frontend"})
+	}
+	return map[string]interface{}{
+		"id":          id,
+		"masterId":    owner,
+		"title":       "hackathon",
+		"totalMember": "3",
+		"isActive":    true,
+		"members":     list,
+		"version":     1,
+	}
+}
+
+// StoredUserのうち、他のユーザーに返してはいけない項目
+//
+// common.PublicProfileのjsonタグに無い項目と、非公開にした項目（inactiveUserKeysも含む）
+func PrivateKeys() []string {
+	public := map[string]bool{}
+	t := reflect.TypeOf(common.PublicProfile{})
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		public[name] = true
+	}
+
+	keys := append(append([]string{}, privateFields...), inactiveUserKeys...)
+	for key := range StoredUser("") {
+		if !public[key] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// StoredUser(uid)の返してはいけない文字列の値（レスポンスのどこにも含まれてはいけない）
+func PrivateValues(uid string) []string {
+	user := StoredUser(uid)
+	var values []string
+	for _, key := range PrivateKeys() {
+		if v, ok := user[key].(string); ok && strings.Contains(v, uid) {
+			values = append(values, v)
+		}
+	}
+	sort.Strings(values)
+	return values
+}
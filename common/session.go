@@ -0,0 +1,129 @@
+package common
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// ==================== Session ====================
+// EndUserAPIのログインと、管理画面の強制ログアウト・一覧で共有する
+//
+// セッションはDynamoDBのTTL（expiresAt）で削除されるため、EndUsersのisLoginは期限切れを反映しない。
+// ログイン中かを表示する場合はLoggedInUidsで判定する
+
+// uidの有効なセッションの数
+func countActiveSessions(db *dynamodb.DynamoDB, tables Tables, uid string) (int, error) {
+	count := 0
+	err := db.QueryPages(&dynamodb.QueryInput{
+		TableName:              aws.String(tables.Sessions),
+		IndexName:              aws.String("uid-index"),
+		KeyConditionExpression: aws.String("#uid = :uid"),
+		FilterExpression:       aws.String("#expires > :now"),
+		Select:                 aws.String(dynamodb.SelectCount),
+		ExpressionAttributeNames: map[string]*string{
+			"#uid":     aws.String("uid"),
+			"#expires": aws.String("expiresAt"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":uid": {S: aws.String(uid)},
+			":now": {N: aws.String(strconv.FormatInt(time.Now().Unix(), 10))},
+		},
+	}, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+		count += int(aws.Int64Value(page.Count))
+		return true
+	})
+	return count, err
+}
+
+// 有効なセッションの有無をEndUsersのisLoginに反映（ユーザーが無い場合は何もしない）
+func RefreshLoginState(db *dynamodb.DynamoDB, tables Tables, uid string) error {
+	count, err := countActiveSessions(db, tables, uid)
+	if err != nil {
+		return err
+	}
+	_, err = db.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName: aws.String(tables.EndUsers),
+		Key: map[string]*dynamodb.AttributeValue{
+			"uid": {
+				S: aws.String(uid),
+			},
+		},
+		ConditionExpression: aws.String("attribute_exists(#uid)"),
+		UpdateExpression:    aws.String("set #L = :l"),
+		ExpressionAttributeNames: map[string]*string{
+			"#uid": aws.String("uid"),
+			"#L":   aws.String("isLogin"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":l": {BOOL: aws.Bool(count > 0)},
+		},
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return nil
+	}
+	return err
+}
+
+// uidのセッションを期限切れのものも含めて全て削除し、isLoginに反映する（削除した数を返す）
+func RevokeAllSessions(db *dynamodb.DynamoDB, tables Tables, uid string) (int, error) {
+	var keys []map[string]*dynamodb.AttributeValue
+	err := db.QueryPages(&dynamodb.QueryInput{
+		TableName:              aws.String(tables.Sessions),
+		IndexName:              aws.String("uid-index"),
+		KeyConditionExpression: aws.String("#uid = :uid"),
+		ProjectionExpression:   aws.String("#sid"),
+		ExpressionAttributeNames: map[string]*string{
+			"#uid": aws.String("uid"),
+			"#sid": aws.String("sessionId"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":uid": {S: aws.String(uid)},
+		},
+	}, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+		keys = append(keys, page.Items...)
+		return true
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, key := range keys {
+		_, err := db.DeleteItem(&dynamodb.DeleteItemInput{
+			TableName: aws.String(tables.Sessions),
+			Key:       key,
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(keys), RefreshLoginState(db, tables, uid)
+}
+
+// 有効なセッションがあるユーザー（Sessionsを1回走査する）
+func LoggedInUids(db *dynamodb.DynamoDB, tables Tables) (map[string]bool, error) {
+	uids := map[string]bool{}
+	err := db.ScanPages(&dynamodb.ScanInput{
+		TableName:            aws.String(tables.Sessions),
+		ProjectionExpression: aws.String("#uid"),
+		FilterExpression:     aws.String("#expires > :now"),
+		ExpressionAttributeNames: map[string]*string{
+			"#uid":     aws.String("uid"),
+			"#expires": aws.String("expiresAt"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":now": {N: aws.String(strconv.FormatInt(time.Now().Unix(), 10))},
+		},
+	}, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+		for _, item := range page.Items {
+			if item["uid"] != nil {
+				uids[aws.StringValue(item["uid"].S)] = true
+			}
+		}
+		return true
+	})
+	return uids, err
+}
@@ -0,0 +1,102 @@
+package common
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// ==================== Stats ====================
+// 管理画面の統計に使うカウンター（AtomicCounterの "stats:" で始まる項目）
+//
+// 末尾が ":" のキーは日別（DailyStatで日付を付ける）
+const (
+	StatUsers            = "users"
+	StatUsersSuspended   = "users:suspended"
+	StatUsersDeleted     = "users:deleted"
+	StatUsersNew         = "users:new:"
+	StatRecruits         = "recruits"
+	StatRecruitsOff      = "recruits:inactive"
+	StatRecruitsClosed   = "recruits:closed"
+	StatRecruitsDeleted  = "recruits:deleted"
+	StatRecruitsNew      = "recruits:new:"
+	StatRecruitsCapacity = "recruits:capacity"
+	StatRecruitsMembers  = "recruits:members"
+	StatPosition         = "recruits:position:"
+	StatJoins            = "joins:"
+	StatMailSent         = "mail:sent"
+	StatMailFailed       = "mail:failed"
+	// workerのstatsハンドラーが数える日別の停止数
+	StatUsersSuspendedOn    = "users:suspended:"
+	StatRecruitsSuspendedOn = "recruits:suspended:"
+)
+
+// 集計するポジション（それ以外は other にまとめる）
+var StatPositions = []string{"frontend", "backend", "infra", "other"}
+
+// positionを数えるカウンターのキー
+func PositionStat(position string) string {
+	for _, p := range StatPositions {
+		if p == position {
+			return StatPosition + position
+		}
+	}
+	return StatPosition + "other"
+}
+
+// 統計の日付（日本時間）
+func StatDate(t time.Time) string {
+	return t.UTC().In(time.FixedZone("Asia/Tokyo", 9*60*60)).Format("2006-01-02")
+}
+
+// 日別のカウンターのキー
+func DailyStat(prefix string, t time.Time) string {
+	return prefix + StatDate(t)
+}
+
+// カウンターを加算するUpdate（トランザクションに含める場合）
+func StatUpdate(table, key string, n int) *dynamodb.TransactWriteItem {
+	return &dynamodb.TransactWriteItem{
+		Update: &dynamodb.Update{
+			TableName: aws.String(table),
+			Key: map[string]*dynamodb.AttributeValue{
+				"countKey": {
+					S: aws.String("stats:" + key),
+				},
+			},
+			UpdateExpression: aws.String("add #col :incr"),
+			ExpressionAttributeNames: map[string]*string{
+				"#col": aws.String("countNumber"),
+			},
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":incr": {
+					N: aws.String(strconv.Itoa(n)),
+				},
+			},
+		},
+	}
+}
+
+// tableのカウンターを加算する（統計のみのため、失敗しても処理は止めない）
+func AddStats(db *dynamodb.DynamoDB, table string, deltas map[string]int) {
+	for key, n := range deltas {
+		if n == 0 {
+			continue
+		}
+		update := StatUpdate(table, key, n).Update
+		_, err := db.UpdateItem(&dynamodb.UpdateItemInput{
+			TableName:                 update.TableName,
+			Key:                       update.Key,
+			UpdateExpression:          update.UpdateExpression,
+			ExpressionAttributeNames:  update.ExpressionAttributeNames,
+			ExpressionAttributeValues: update.ExpressionAttributeValues,
+		})
+		if err != nil {
+			fmt.Println("Got error updating stats:")
+			fmt.Println(err.Error())
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package common
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// ==================== Token ====================
+// nバイトの乱数の16進数（id・トークン用）
+func RandomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// 保存するトークンのハッシュ（SHA-256の16進数）
+func HashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// ==================== Impersonation ====================
+// Impersonationsの項目（トークンはハッシュのみを保存する）
+//
+// Admin EndUserAPIが発行し、EndUserAPIが検証する
+type Impersonation struct {
+	Id         string `json:"id" dynamodbav:"id"`
+	SecretHash string `json:"-" dynamodbav:"secretHash"`
+	Uid        string `json:"uid" dynamodbav:"uid"`
+	Operator   string `json:"operator" dynamodbav:"operator"`
+	Reason     string `json:"reason" dynamodbav:"reason"`
+	// trueの場合のみ GET・HEAD 以外のリクエストを許可する
+	AllowWrite bool   `json:"allowWrite" dynamodbav:"allowWrite"`
+	Created    string `json:"created" dynamodbav:"created"`
+	// 有効期限（UNIX秒、DynamoDBのTTLにも使う）
+	ExpiresAt int64 `json:"expiresAt" dynamodbav:"expiresAt"`
+}
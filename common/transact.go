@@ -0,0 +1,39 @@
+package common
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// ==================== Transaction ====================
+// トランザクション（n件）が条件不一致で取り消された項目の位置
+func CanceledItems(err error, n int) ([]bool, bool) {
+	canceled, ok := err.(*dynamodb.TransactionCanceledException)
+	if !ok {
+		return nil, false
+	}
+	res := make([]bool, n)
+	for i, reason := range canceled.CancellationReasons {
+		if i < n {
+			res[i] = aws.StringValue(reason.Code) == "ConditionalCheckFailed"
+		}
+	}
+	return res, true
+}
+
+// 同じ項目への他の書き込みと衝突して取り消されたか（条件は満たしているため、再試行すれば通る）
+func TransactionConflict(err error) bool {
+	if _, ok := err.(*dynamodb.TransactionInProgressException); ok {
+		return true
+	}
+	canceled, ok := err.(*dynamodb.TransactionCanceledException)
+	if !ok {
+		return false
+	}
+	for _, reason := range canceled.CancellationReasons {
+		if aws.StringValue(reason.Code) == "TransactionConflict" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,61 @@
+package common
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// ==================== Version ====================
+// 楽観的ロックに使う項目（書き込みのたびに1増やす。無い項目は0として扱う）
+const VersionAttr = "version"
+
+// versionのETag
+func ETag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// If-Matchヘッダーのversion（ヘッダーが無い場合と * の場合はok=false）
+func IfMatch(r *http.Request) (version int, ok bool, err error) {
+	v := strings.TrimSpace(r.Header.Get("If-Match"))
+	if v == "" || v == "*" {
+		return 0, false, nil
+	}
+	v = strings.Trim(strings.TrimPrefix(v, "W/"), `"`)
+	version, err = strconv.Atoi(v)
+	if err != nil || version < 0 {
+		return 0, false, fmt.Errorf("If-Match must be an ETag returned by GET")
+	}
+	return version, true, nil
+}
+
+// itemのversion
+func ItemVersion(item map[string]*dynamodb.AttributeValue) int {
+	if item[VersionAttr] == nil {
+		return 0
+	}
+	version, _ := strconv.Atoi(aws.StringValue(item[VersionAttr].N))
+	return version
+}
+
+// versionが一致する場合のみ書き込むConditionExpression（names・valuesに #version・:version を追加する）
+func VersionCondition(version int, names map[string]*string, values map[string]*dynamodb.AttributeValue) string {
+	names["#version"] = aws.String(VersionAttr)
+	values[":version"] = &dynamodb.AttributeValue{N: aws.String(strconv.Itoa(version))}
+	if version == 0 {
+		// versionを追加する前のボード
+		return "(attribute_not_exists(#version) OR #version = :version)"
+	}
+	return "#version = :version"
+}
+
+// versionを1増やすUpdateExpressionの句（names・valuesに #version・:one を追加する）
+func VersionIncrement(names map[string]*string, values map[string]*dynamodb.AttributeValue) string {
+	names["#version"] = aws.String(VersionAttr)
+	values[":one"] = &dynamodb.AttributeValue{N: aws.String("1")}
+	return "add #version :one"
+}
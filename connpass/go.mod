@@ -1,8 +0,0 @@
-module main
-
-go 1.15
-
-require (
-	github.com/gorilla/mux v1.8.0
-	github.com/rs/cors v1.7.0
-)
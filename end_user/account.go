@@ -0,0 +1,630 @@
+package enduser
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/hew-team1/all-api-dev/common"
+)
+
+// Recruitのmembersの構造体
+type RecruitMember struct {
+	Uid      *string `json:"uid,omitempty" dynamodbav:"uid,omitempty"`
+	Position *string `json:"position,omitempty" dynamodbav:"position,omitempty"`
+}
+
+// エクスポート・退会処理で扱うボード
+type AccountRecruit struct {
+	Id          *int            `json:"id,omitempty" dynamodbav:"id,omitempty"`
+	MasterId    *string         `json:"masterId,omitempty" dynamodbav:"masterId,omitempty"`
+	Title       *string         `json:"title,omitempty" dynamodbav:"title,omitempty"`
+	EventDay    *string         `json:"eventDay,omitempty" dynamodbav:"eventDay,omitempty"`
+	Day         *string         `json:"day,omitempty" dynamodbav:"day,omitempty"`
+	Organizer   *string         `json:"organizer,omitempty" dynamodbav:"organizer,omitempty"`
+	Commit      *string         `json:"commit,omitempty" dynamodbav:"commit,omitempty"`
+	Beginner    *string         `json:"beginner,omitempty" dynamodbav:"beginner,omitempty"`
+	Message     *string         `json:"message,omitempty" dynamodbav:"message,omitempty"`
+	SlackUrl    *string         `json:"slackUrl,omitempty" dynamodbav:"slackUrl,omitempty"`
+	TotalMember *string         `json:"totalMember,omitempty" dynamodbav:"totalMember,omitempty"`
+	Position    *string         `json:"position,omitempty" dynamodbav:"position,omitempty"`
+	Reword      *string         `json:"reword,omitempty" dynamodbav:"reword,omitempty"`
+	ImageUrl    *string         `json:"imageUrl,omitempty" dynamodbav:"imageUrl,omitempty"`
+	Members     []RecruitMember `json:"members,omitempty" dynamodbav:"members,omitempty"`
+	Created     *string         `json:"created,omitempty" dynamodbav:"created,omitempty"`
+	Updated     *string         `json:"updated,omitempty" dynamodbav:"updated,omitempty"`
+	IsActive    bool            `json:"isActive" dynamodbav:"isActive"`
+	Closed      *string         `json:"closed,omitempty" dynamodbav:"closed,omitempty"`
+	DeletedAt   *string         `json:"deletedAt,omitempty" dynamodbav:"deletedAt,omitempty"`
+	// 楽観的ロックのversion（退会処理の競合の検出に使う）
+	Version int `json:"-" dynamodbav:"version"`
+}
+
+// uidがmembersに含まれるか
+func (r *AccountRecruit) HasMember(uid string) bool {
+	for _, member := range r.Members {
+		if aws.StringValue(member.Uid) == uid {
+			return true
+		}
+	}
+	return false
+}
+
+// uidが投稿・参加しているボードを取得（停止中・削除済みのボードも含む）
+//
+// RecruitOwnersとMembershipsのuid-indexからidを取得し、ボードをまとめて取得する
+func (s *Server) AccountRecruits(uid string) (posts []AccountRecruit, joins []AccountRecruit, err error) {
+	posts = make([]AccountRecruit, 0)
+	joins = make([]AccountRecruit, 0)
+	owned, err := s.OwnedRecruitIds(uid)
+	if err != nil {
+		return posts, joins, err
+	}
+	joined, err := s.JoinedRecruitIds(uid)
+	if err != nil {
+		return posts, joins, err
+	}
+	keys := make([]map[string]*dynamodb.AttributeValue, 0, len(owned)+len(joined))
+	for _, id := range append(owned, joined...) {
+		keys = append(keys, map[string]*dynamodb.AttributeValue{"id": {N: aws.String(strconv.Itoa(id))}})
+	}
+	items, err := common.BatchGet(s.db, s.tables.Recruits, keys, "", nil)
+	if err != nil {
+		return posts, joins, err
+	}
+
+	var recruits []AccountRecruit
+	if err := dynamodbattribute.UnmarshalListOfMaps(items, &recruits); err != nil {
+		return posts, joins, err
+	}
+	for _, recruit := range recruits {
+		if aws.StringValue(recruit.MasterId) == uid {
+			posts = append(posts, recruit)
+		} else if recruit.HasMember(uid) {
+			joins = append(joins, recruit)
+		}
+	}
+	// BatchGetItemの順序は決まらないため、新しい順にそろえる
+	for _, list := range [][]AccountRecruit{posts, joins} {
+		sort.Slice(list, func(i, j int) bool {
+			return aws.IntValue(list[i].Id) > aws.IntValue(list[j].Id)
+		})
+	}
+	return posts, joins, nil
+}
+
+// ==================== Export ====================
+type UserExport struct {
+	ExportedAt string           `json:"exportedAt"`
+	Profile    *UserProfile     `json:"profile"`
+	Posts      []AccountRecruit `json:"posts"`
+	Joins      []AccountRecruit `json:"joins"`
+}
+
+func (s *Server) UserExport(w http.ResponseWriter, r *http.Request) {
+	nowTime := time.Now().UTC().In(
+		time.FixedZone("Asia/Tokyo", 9*60*60),
+	).Format("2006-01-02 15:04")
+
+	uid := r.Header.Get("uid")
+	if uid == "" {
+		common.WriteError(w, http.StatusUnauthorized, "uid header is required")
+		return
+	}
+
+	profile, err := s.FindProfile(uid)
+	if err != nil {
+		common.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if profile == nil || profile.DeletedAt != nil {
+		common.WriteError(w, http.StatusNotFound, "user not found")
+		return
+	}
+	posts, joins, err := s.AccountRecruits(uid)
+	if err != nil {
+		common.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	export := UserExport{
+		ExportedAt: nowTime,
+		Profile:    profile,
+		Posts:      posts,
+		Joins:      joins,
+	}
+
+	switch r.URL.Query().Get("format") {
+	case "", "json":
+		j, _ := json.MarshalIndent(export, "", "  ")
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", "attachment; filename=\"guildhack-export.json\"")
+		w.Write(j)
+	case "zip":
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", "attachment; filename=\"guildhack-export.zip\"")
+		zw := zip.NewWriter(w)
+		for name, value := range map[string]interface{}{
+			"profile.json": export.Profile,
+			"posts.json":   export.Posts,
+			"joins.json":   export.Joins,
+		} {
+			f, err := zw.Create(name)
+			if err != nil {
+				fmt.Println(err.Error())
+				return
+			}
+			j, _ := json.MarshalIndent(value, "", "  ")
+			f.Write(j)
+		}
+		if err := zw.Close(); err != nil {
+			fmt.Println(err.Error())
+		}
+	default:
+		common.WriteError(w, http.StatusBadRequest, "format must be json or zip")
+		return
+	}
+
+	// エクスポートのログ
+	fmt.Println("export", uid, len(posts), len(joins))
+}
+
+// ==================== Delete ====================
+type UserDeleteResponse struct {
+	Uid         string `json:"uid"`
+	PurgeAt     string `json:"purgeAt"`
+	Transferred []int  `json:"transferred"`
+	Closed      []int  `json:"closed"`
+	Anonymized  []int  `json:"anonymized"`
+}
+
+// 最初にログインできないように退会中（deleting）として記録し、ボードの処理とログインの取り消しの後にpurgeAtを設定する
+// 途中で失敗した場合は、もう一度DELETEすると続きから処理する
+func (s *Server) UserDelete(w http.ResponseWriter, r *http.Request) {
+	now := time.Now().UTC().In(
+		time.FixedZone("Asia/Tokyo", 9*60*60),
+	)
+	nowTime := now.Format("2006-01-02 15:04")
+
+	uid := r.Header.Get("uid")
+	if uid == "" {
+		common.WriteError(w, http.StatusUnauthorized, "uid header is required")
+		return
+	}
+
+	profile, err := s.FindProfile(uid)
+	if err != nil {
+		common.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if profile == nil || (profile.DeletedAt != nil && !profile.Deleting) {
+		common.WriteError(w, http.StatusNotFound, "user not found")
+		return
+	}
+	if profile.DeletedAt == nil {
+		if err := s.markDeleting(uid, profile.IsActive, nowTime); err != nil {
+			if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+				common.WriteError(w, http.StatusNotFound, "user not found")
+				return
+			}
+			common.WriteError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		deleted := map[string]int{common.StatUsers: -1, common.StatUsersDeleted: 1}
+		if !profile.IsActive {
+			deleted[common.StatUsersSuspended] = -1
+		}
+		s.AddStats(deleted)
+	}
+
+	posts, joins, err := s.AccountRecruits(uid)
+	if err != nil {
+		common.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	res := UserDeleteResponse{
+		Uid:         uid,
+		Transferred: make([]int, 0),
+		Closed:      make([]int, 0),
+		Anonymized:  make([]int, 0),
+	}
+
+	// 投稿したボードは他のメンバーに引き継ぎ、いなければ募集を終了する
+	for _, recruit := range posts {
+		// 前回の処理で募集を終了したボード
+		if recruit.Closed != nil && !recruit.HasMember(uid) {
+			res.Closed = append(res.Closed, *recruit.Id)
+			continue
+		}
+		updated, newMaster, err := s.leaveRecruit(recruit, uid, nowTime)
+		if err != nil {
+			common.WriteError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		// 処理中にTTLで削除されたボード
+		if updated == nil {
+			continue
+		}
+		if newMaster != nil {
+			res.Transferred = append(res.Transferred, *recruit.Id)
+		} else {
+			res.Closed = append(res.Closed, *recruit.Id)
+			// 削除済みのボードは統計に含まれていない
+			if updated.DeletedAt == nil {
+				closed := map[string]int{common.StatRecruitsClosed: 1}
+				if updated.IsActive {
+					closed[common.StatRecruitsOff] = 1
+				}
+				s.AddStats(closed)
+			}
+		}
+	}
+
+	// 参加したボードのmembersは匿名化する
+	for _, recruit := range joins {
+		updated, _, err := s.leaveRecruit(recruit, uid, nowTime)
+		if err != nil {
+			common.WriteError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if updated != nil {
+			res.Anonymized = append(res.Anonymized, *recruit.Id)
+		}
+	}
+
+	if err := s.RevokeAllSessions(uid); err != nil {
+		common.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// 猶予期間後に行を削除する（猶予期間中は管理画面から復元できる）
+	purgeAt := now.Add(s.deleteGrace)
+	res.PurgeAt = purgeAt.Format("2006-01-02 15:04")
+	_, err = s.db.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName: aws.String(s.tables.EndUsers),
+		Key: map[string]*dynamodb.AttributeValue{
+			"uid": {
+				S: aws.String(uid),
+			},
+		},
+		ConditionExpression: aws.String("attribute_exists(#deleting)"),
+		UpdateExpression:    aws.String("set #purge = :purge, #updated = :updated remove #deleting"),
+		ExpressionAttributeNames: map[string]*string{
+			"#deleting": aws.String("deleting"),
+			"#purge":    aws.String("purgeAt"),
+			"#updated":  aws.String("updated"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":purge":   {N: aws.String(strconv.FormatInt(purgeAt.Unix(), 10))},
+			":updated": {S: aws.String(nowTime)},
+		},
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			common.WriteError(w, http.StatusNotFound, "user not found")
+			return
+		}
+		common.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	j, _ := json.Marshal(res)
+	w.Write(j)
+
+	// 退会のログ
+	fmt.Println(string(j))
+}
+
+// ログインできないようにし、退会中として記録する（退会済みの場合はConditionalCheckFailed）
+func (s *Server) markDeleting(uid string, isActive bool, nowTime string) error {
+	_, err := s.db.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName: aws.String(s.tables.EndUsers),
+		Key: map[string]*dynamodb.AttributeValue{
+			"uid": {
+				S: aws.String(uid),
+			},
+		},
+		ConditionExpression: aws.String("attribute_exists(#uid) AND attribute_not_exists(#deleted)"),
+		UpdateExpression: aws.String(
+			"set #A = :a, #L = :l, #deleted = :deleted, #by = :by, #before = :before, #deleting = :deleting, #updated = :updated",
+		),
+		ExpressionAttributeNames: map[string]*string{
+			"#uid":      aws.String("uid"),
+			"#A":        aws.String("isActive"),
+			"#L":        aws.String("isLogin"),
+			"#deleted":  aws.String("deletedAt"),
+			"#by":       aws.String("deletedBy"),
+			"#before":   aws.String("activeBeforeDelete"),
+			"#deleting": aws.String("deleting"),
+			"#updated":  aws.String("updated"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":a":       {BOOL: aws.Bool(false)},
+			":l":       {BOOL: aws.Bool(false)},
+			":deleted": {S: aws.String(nowTime)},
+			":by":      {S: aws.String(uid)},
+			// 復元時に停止中だったかを戻すため
+			":before":   {BOOL: aws.Bool(isActive)},
+			":deleting": {BOOL: aws.Bool(true)},
+			":updated":  {S: aws.String(nowTime)},
+		},
+	})
+	return err
+}
+
+// membersのuidを退会ユーザーに置き換える
+func anonymizeMembers(members []RecruitMember, uid string) []RecruitMember {
+	res := make([]RecruitMember, 0, len(members))
+	for _, member := range members {
+		if aws.StringValue(member.Uid) == uid {
+			member.Uid = aws.String(common.DeletedUserUid)
+		}
+		res = append(res, member)
+	}
+	return res
+}
+
+// 退会に伴うボードの更新で競合した（読み込んだ後にボードが変更された）
+var errAccountRecruitModified = fmt.Errorf("recruit was modified")
+
+// uidの退会に合わせてrecruitを更新する（作成者の場合は他のメンバーに引き継ぎ、いなければ募集を終了する）
+//
+// 読み込んだversionのままの場合のみ書き込み、参加などと競合した場合は読み直して3回まで再試行する。
+// 書き込んだ時点のボード（更新前）と引き継ぎ先を返す（ボードが無くなっていた場合はnil）
+func (s *Server) leaveRecruit(recruit AccountRecruit, uid, nowTime string) (*AccountRecruit, *string, error) {
+	for attempt := 0; ; attempt++ {
+		members := anonymizeMembers(recruit.Members, uid)
+		masterId := recruit.MasterId
+		if aws.StringValue(recruit.MasterId) == uid {
+			masterId = nil
+			for _, member := range recruit.Members {
+				if member.Uid != nil && *member.Uid != uid && *member.Uid != common.DeletedUserUid {
+					masterId = member.Uid
+					break
+				}
+			}
+		}
+		err := s.updateAccountRecruit(*recruit.Id, uid, members, masterId, recruit.Version, nowTime)
+		if err != errAccountRecruitModified {
+			if err != nil {
+				return nil, nil, err
+			}
+			return &recruit, masterId, nil
+		}
+		if attempt == 2 {
+			return nil, nil, err
+		}
+
+		current, err := s.findAccountRecruit(*recruit.Id)
+		if err != nil {
+			return nil, nil, err
+		}
+		if current == nil {
+			return nil, nil, nil
+		}
+		recruit = *current
+	}
+}
+
+// idのボード（存在しない場合はnil）
+func (s *Server) findAccountRecruit(id int) (*AccountRecruit, error) {
+	result, err := s.db.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String(s.tables.Recruits),
+		Key: map[string]*dynamodb.AttributeValue{
+			"id": {
+				N: aws.String(strconv.Itoa(id)),
+			},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.Item == nil {
+		return nil, nil
+	}
+	var recruit AccountRecruit
+	if err := dynamodbattribute.UnmarshalMap(result.Item, &recruit); err != nil {
+		return nil, err
+	}
+	return &recruit, nil
+}
+
+// 退会に伴うボードの更新（masterIdがnilの場合は募集を終了する）
+// RecruitOwnersもmasterIdに合わせ、退会するuidのMembershipsの項目は削除する
+// versionが変わっていた場合はerrAccountRecruitModified
+func (s *Server) updateAccountRecruit(id int, uid string, members []RecruitMember, masterId *string, version int, nowTime string) error {
+	av, err := dynamodbattribute.Marshal(members)
+	if err != nil {
+		return err
+	}
+	names := map[string]*string{
+		"#members": aws.String("members"),
+		"#updated": aws.String("updated"),
+	}
+	values := map[string]*dynamodb.AttributeValue{
+		":members": av,
+		":updated": {S: aws.String(nowTime)},
+	}
+	expr := "set #members = :members, #updated = :updated"
+	if masterId != nil {
+		names["#M"] = aws.String("masterId")
+		values[":m"] = &dynamodb.AttributeValue{S: masterId}
+		expr += ", #M = :m"
+	} else {
+		names["#A"] = aws.String("isActive")
+		names["#closed"] = aws.String("closed")
+		values[":a"] = &dynamodb.AttributeValue{BOOL: aws.Bool(false)}
+		expr += ", #A = :a, #closed = :updated"
+	}
+	expr += " " + common.VersionIncrement(names, values)
+	names["#id"] = aws.String("id")
+	cond := "attribute_exists(#id) AND " + common.VersionCondition(version, names, values)
+
+	items := []*dynamodb.TransactWriteItem{
+		{
+			Update: &dynamodb.Update{
+				TableName: aws.String(s.tables.Recruits),
+				Key: map[string]*dynamodb.AttributeValue{
+					"id": {
+						N: aws.String(strconv.Itoa(id)),
+					},
+				},
+				ConditionExpression:       aws.String(cond),
+				UpdateExpression:          aws.String(expr),
+				ExpressionAttributeNames:  names,
+				ExpressionAttributeValues: values,
+			},
+		},
+		{
+			Delete: &dynamodb.Delete{
+				TableName: aws.String(s.tables.Memberships),
+				Key: map[string]*dynamodb.AttributeValue{
+					"recruitId": {
+						N: aws.String(strconv.Itoa(id)),
+					},
+					"uid": {
+						S: aws.String(uid),
+					},
+				},
+			},
+		},
+	}
+	// 引き継いだ場合はボードの作成者も同じトランザクションで更新する
+	if masterId != nil {
+		items = append(items, &dynamodb.TransactWriteItem{
+			Update: &dynamodb.Update{
+				TableName: aws.String(s.tables.RecruitOwners),
+				Key: map[string]*dynamodb.AttributeValue{
+					"recruitId": {
+						N: aws.String(strconv.Itoa(id)),
+					},
+				},
+				UpdateExpression: aws.String("set #uid = :m"),
+				ExpressionAttributeNames: map[string]*string{
+					"#uid": aws.String("uid"),
+				},
+				ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+					":m": {S: masterId},
+				},
+			},
+		})
+	}
+	_, err = s.db.TransactWriteItems(&dynamodb.TransactWriteItemsInput{TransactItems: items})
+	if failed, ok := common.CanceledItems(err, len(items)); ok && failed[0] {
+		return errAccountRecruitModified
+	}
+	return err
+}
+
+// ==================== Purge ====================
+// 猶予期間を過ぎた退会ユーザーを定期的に削除する
+func (s *Server) PurgeDeletedUsers(interval time.Duration) {
+	for {
+		if err := s.purgeDeletedUsers(time.Now()); err != nil {
+			fmt.Println("Got error purging deleted users:")
+			fmt.Println(err.Error())
+		}
+		time.Sleep(interval)
+	}
+}
+
+func (s *Server) purgeDeletedUsers(now time.Time) error {
+	var expired []UserProfile
+	err := s.db.ScanPages(&dynamodb.ScanInput{
+		TableName:        aws.String(s.tables.EndUsers),
+		FilterExpression: aws.String("#purge <= :now"),
+		ExpressionAttributeNames: map[string]*string{
+			"#purge": aws.String("purgeAt"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":now": {N: aws.String(strconv.FormatInt(now.Unix(), 10))},
+		},
+	}, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+		var profiles []UserProfile
+		dynamodbattribute.UnmarshalListOfMaps(page.Items, &profiles)
+		expired = append(expired, profiles...)
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, profile := range expired {
+		purged, err := s.purgeUser(&profile, now)
+		if err != nil {
+			return err
+		}
+		// 他のインスタンスが削除した・復元されたユーザー
+		if !purged {
+			continue
+		}
+		for _, key := range []*string{profile.AvatarKey, profile.AvatarThumbnailKey} {
+			if key != nil {
+				s.blob.Delete(*key)
+			}
+		}
+		s.AddStats(map[string]int{common.StatUsersDeleted: -1})
+
+		// 削除のログ
+		fmt.Println("purged", *profile.Uid)
+	}
+	return nil
+}
+
+// 猶予期間を過ぎた行を削除し、メールアドレスを解放する（削除した場合はtrue）
+//
+// 複数のインスタンスが同時に削除しても統計を二重に減らさないように、行が残っていてpurgeAtを過ぎている場合のみ削除する
+func (s *Server) purgeUser(profile *UserProfile, now time.Time) (bool, error) {
+	items := []*dynamodb.TransactWriteItem{
+		{
+			Delete: &dynamodb.Delete{
+				TableName: aws.String(s.tables.EndUsers),
+				Key: map[string]*dynamodb.AttributeValue{
+					"uid": {
+						S: profile.Uid,
+					},
+				},
+				ConditionExpression: aws.String("attribute_exists(#uid) AND #purge <= :now"),
+				ExpressionAttributeNames: map[string]*string{
+					"#uid":   aws.String("uid"),
+					"#purge": aws.String("purgeAt"),
+				},
+				ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+					":now": {N: aws.String(strconv.FormatInt(now.Unix(), 10))},
+				},
+			},
+		},
+	}
+	if profile.Email != nil {
+		items = append(items, s.emailRelease(NormalizeEmail(*profile.Email), *profile.Uid))
+	}
+	for {
+		_, err := s.db.TransactWriteItems(&dynamodb.TransactWriteItemsInput{TransactItems: items})
+		if err == nil {
+			return true, nil
+		}
+		failed, ok := common.CanceledItems(err, len(items))
+		if !ok {
+			return false, err
+		}
+		if failed[0] {
+			return false, nil
+		}
+		// メールアドレスを別のユーザーが使っている場合は行のみ削除する
+		if len(items) > 1 && failed[1] {
+			items = items[:1]
+			continue
+		}
+		return false, err
+	}
+}
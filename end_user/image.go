@@ -0,0 +1,129 @@
+package enduser
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/hew-team1/all-api-dev/common"
+)
+
+// ==================== Avatar Upload ====================
+type AvatarUploadResponse struct {
+	AvatarUrl          *string `json:"avatarUrl,omitempty"`
+	AvatarThumbnailUrl *string `json:"avatarThumbnailUrl,omitempty"`
+}
+
+func (s *Server) AvatarUpload(w http.ResponseWriter, r *http.Request) {
+	nowTime := time.Now().UTC().In(
+		time.FixedZone("Asia/Tokyo", 9*60*60),
+	).Format("2006-01-02 15:04")
+
+	uid := r.Header.Get("uid")
+	if uid == "" {
+		common.WriteError(w, http.StatusUnauthorized, "uid header is required")
+		return
+	}
+
+	profile, err := s.FindProfile(uid)
+	if err != nil {
+		common.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := profile.CheckActive(); err != nil {
+		WriteUserCheckError(w, err)
+		return
+	}
+
+	body, status, err := common.ReadUploadedImage(w, r)
+	if err != nil {
+		common.WriteError(w, status, err.Error())
+		return
+	}
+	img, err := common.ProcessImage(body)
+	if err != nil {
+		common.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	prefix := "avatars/" + url.PathEscape(uid) + "/" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	key := prefix + "." + img.Ext
+	thumbKey := prefix + "_thumb." + img.Ext
+	avatarUrl, err := s.blob.Put(key, img.Original, img.ContentType)
+	if err != nil {
+		common.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	thumbUrl, err := s.blob.Put(thumbKey, img.Thumbnail, img.ContentType)
+	if err != nil {
+		s.blob.Delete(key)
+		common.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	_, err = s.db.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName: aws.String(s.tables.EndUsers),
+		Key: map[string]*dynamodb.AttributeValue{
+			"uid": {
+				S: aws.String(uid),
+			},
+		},
+		ConditionExpression: aws.String("attribute_exists(#uid)"),
+		UpdateExpression: aws.String(
+			"set #url = :url, #thumbUrl = :thumbUrl, #key = :key, #thumbKey = :thumbKey, #updated = :updated",
+		),
+		ExpressionAttributeNames: map[string]*string{
+			"#uid":      aws.String("uid"),
+			"#url":      aws.String("avatarUrl"),
+			"#thumbUrl": aws.String("avatarThumbnailUrl"),
+			"#key":      aws.String("avatarKey"),
+			"#thumbKey": aws.String("avatarThumbnailKey"),
+			"#updated":  aws.String("updated"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":url":      {S: aws.String(avatarUrl)},
+			":thumbUrl": {S: aws.String(thumbUrl)},
+			":key":      {S: aws.String(key)},
+			":thumbKey": {S: aws.String(thumbKey)},
+			":updated":  {S: aws.String(nowTime)},
+		},
+	})
+	if err != nil {
+		s.blob.Delete(key)
+		s.blob.Delete(thumbKey)
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			common.WriteError(w, http.StatusNotFound, "user not found")
+			return
+		}
+		common.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// 以前の画像を削除
+	for _, old := range []*string{profile.AvatarKey, profile.AvatarThumbnailKey} {
+		if old == nil {
+			continue
+		}
+		if err := s.blob.Delete(*old); err != nil {
+			fmt.Println("Got error deleting blob:")
+			fmt.Println(err.Error())
+		}
+	}
+
+	res := AvatarUploadResponse{
+		AvatarUrl:          &avatarUrl,
+		AvatarThumbnailUrl: &thumbUrl,
+	}
+	j, _ := json.Marshal(res)
+	w.WriteHeader(http.StatusCreated)
+	w.Write(j)
+
+	// 保存先のログ
+	fmt.Println(string(j))
+}
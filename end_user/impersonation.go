@@ -0,0 +1,122 @@
+package enduser
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/hew-team1/all-api-dev/common"
+)
+
+// 管理サービスが発行した「ユーザーとして表示」用のトークン
+const impersonationHeader = "Impersonation-Token"
+
+// なりすまし中のレスポンスに付けるヘッダー
+const (
+	impersonatedUidHeader = "Impersonated-Uid"
+	impersonatedByHeader  = "Impersonated-By"
+)
+
+// allowWrite でも許可しない操作（本人以外が行うべきでないもの）
+// /users/me/sessions 以下も全て許可しない
+var impersonationDenied = map[string]bool{
+	"POST /users":          true,
+	"POST /users/login":    true,
+	"POST /users/logout":   true,
+	"PUT /users/me":        true,
+	"DELETE /users/me":     true,
+	"GET /users/me/export": true,
+}
+
+// "{id}.{secret}" のトークンを検証する（無効な場合はnil）
+func (s *Server) FindImpersonation(token string) (*common.Impersonation, error) {
+	parts := strings.SplitN(token, ".", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return nil, nil
+	}
+	result, err := s.db.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String(s.tables.Impersonations),
+		Key: map[string]*dynamodb.AttributeValue{
+			"id": {
+				S: aws.String(parts[0]),
+			},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.Item == nil {
+		return nil, nil
+	}
+
+	var imp common.Impersonation
+	if err := dynamodbattribute.UnmarshalMap(result.Item, &imp); err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(common.HashSecret(parts[1])), []byte(imp.SecretHash)) != 1 {
+		return nil, nil
+	}
+	// TTLの削除は遅れることがあるため期限も確認する
+	if imp.ExpiresAt <= time.Now().Unix() {
+		return nil, nil
+	}
+	return &imp, nil
+}
+
+// Impersonation-Tokenヘッダーがあれば、対象ユーザーのuidでリクエストを処理するミドルウェア
+//
+//	既定では GET・HEAD のみ許可し、レスポンスと監査ログに印を付ける
+func (s *Server) Impersonate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.Header.Get(impersonationHeader)
+		if token == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		imp, err := s.FindImpersonation(token)
+		if err != nil {
+			common.WriteError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if imp == nil {
+			common.WriteError(w, http.StatusUnauthorized, "invalid or expired impersonation token")
+			return
+		}
+
+		readOnly := r.Method == http.MethodGet || r.Method == http.MethodHead
+		if !readOnly && !imp.AllowWrite {
+			common.WriteError(w, http.StatusForbidden, "impersonation token is read-only")
+			return
+		}
+		if impersonationDenied[r.Method+" "+r.URL.Path] || strings.HasPrefix(r.URL.Path, "/users/me/sessions") {
+			common.WriteError(w, http.StatusForbidden, "not allowed while impersonating")
+			return
+		}
+
+		// 本人のセッションとして扱わない
+		r.Header.Del(sessionHeader)
+		r.Header.Set("uid", imp.Uid)
+		w.Header().Set(impersonatedUidHeader, imp.Uid)
+		w.Header().Set(impersonatedByHeader, imp.Operator)
+
+		// 監査ログ
+		j, _ := json.Marshal(map[string]string{
+			"id":       imp.Id,
+			"uid":      imp.Uid,
+			"operator": imp.Operator,
+			"method":   r.Method,
+			"path":     r.URL.RequestURI(),
+		})
+		fmt.Println("[impersonation]", string(j))
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -1,100 +1,109 @@
-package main
+package enduser
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
-	"io"
-	"log"
 	"net/http"
-	"os"
+	"sort"
+	"strconv"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/credentials"
-	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
 	"github.com/gorilla/mux"
-	"github.com/rs/cors"
+	"github.com/hew-team1/all-api-dev/common"
 )
 
-func main() {
-	sess, _ := session.NewSession(&aws.Config{
-		Region:      aws.String(os.Getenv("REGION")),
-		Endpoint:    aws.String(os.Getenv("ENDPOINT_DB")),
-		Credentials: credentials.NewStaticCredentials(os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY"), ""),
-	})
+// EndUserAPIのルートをrに登録し、退会ユーザーの削除を開始する
+func Mount(r *mux.Router, cfg *common.Config) error {
+	sess, err := cfg.Session(cfg.Endpoints.DB)
+	if err != nil {
+		return err
+	}
 	db := dynamodb.New(sess)
-	server := NewServer(db)
 
-	r := mux.NewRouter()
+	blob, err := common.NewBlobStore(cfg)
+	if err != nil {
+		return err
+	}
+	server := NewServer(db, blob, cfg)
+
+	// ミドルウェアはこのサービスのルートのみに適用する
+	r = r.NewRoute().Subrouter()
 	r.HandleFunc("/users", server.UserAllGet).Methods("GET")
-	r.HandleFunc("/users", server.UserCreate).Methods("POST")
+	r.HandleFunc("/users", server.Idempotent(server.UserCreate)).Methods("POST")
 	r.HandleFunc("/users/in-posts", server.InPostsGet).Methods("GET")
 	r.HandleFunc("/users/in-join", server.InJoin).Methods("GET")
-	c := cors.New(cors.Options{
-		AllowedOrigins: []string{"*"},
-		AllowedHeaders: []string{"*"},
-		AllowedMethods: []string{
-			http.MethodHead,
-			http.MethodGet,
-			http.MethodPost,
-			http.MethodPatch,
-			http.MethodPut,
-			http.MethodDelete,
-		},
-	}).Handler(r)
-
-	fmt.Println("サーバー起動 :80 port で受信")
-
-	// log.Fatal は、異常を検知すると処理の実行を止めてくれる
-	log.Fatal(http.ListenAndServe(":80", c))
-}
-
-// io.Readerをbyteのスライスに変換
-func StreamToByte(stream io.Reader) []byte {
-	buf := new(bytes.Buffer)
-	buf.ReadFrom(stream)
-	return buf.Bytes()
+	r.HandleFunc("/users/login", server.Login).Methods("POST")
+	r.HandleFunc("/users/logout", server.Logout).Methods("POST")
+	r.HandleFunc("/users/me/sessions", server.SessionAllGet).Methods("GET")
+	r.HandleFunc("/users/me/sessions/{sessionId}", server.SessionRevoke).Methods("DELETE")
+	r.HandleFunc("/users/me", server.ProfileMeGet).Methods("GET")
+	r.HandleFunc("/users/me", server.Idempotent(server.UserUpsert)).Methods("PUT")
+	r.HandleFunc("/users/me", server.ProfileMeUpdate).Methods("PATCH")
+	r.HandleFunc("/users/me", server.UserDelete).Methods("DELETE")
+	r.HandleFunc("/users/me/export", server.UserExport).Methods("GET")
+	r.HandleFunc("/users/me/avatar", server.AvatarUpload).Methods("POST")
+	r.HandleFunc("/users/{uid}", server.ProfileGet).Methods("GET")
+	r.HandleFunc("/users/{uid}/reports", server.UserReport).Methods("POST")
+	r.Use(server.Impersonate)
+	r.Use(server.TouchSession)
+
+	// 退会ユーザーの削除
+	go server.PurgeDeletedUsers(time.Hour)
+	return nil
 }
 
-func NewServer(db *dynamodb.DynamoDB) *Server {
+func NewServer(db *dynamodb.DynamoDB, blob common.BlobStore, cfg *common.Config) *Server {
 	return &Server{
-		db: db,
+		db:          db,
+		blob:        blob,
+		tables:      cfg.Tables,
+		deleteGrace: time.Duration(cfg.DeleteGraceDays) * 24 * time.Hour,
 	}
 }
 
 type Server struct {
-	db *dynamodb.DynamoDB
+	db     *dynamodb.DynamoDB
+	blob   common.BlobStore
+	tables common.Tables
+	// 退会からEndUsersの行を完全に削除するまでの期間
+	deleteGrace time.Duration
 }
 
 // ==================== ALLGet ====================
-type UserAllGetResponse struct {
-	Uid   *string `json:"uid,omitempty" dynamodbav:"uid,omitempty"`
-	Name  *string `json:"name,omitempty" dynamodbav:"name,omitempty"`
-	Email *string `json:"email,omitempty" dynamodbav:"email,omitempty"`
-}
-
+// 誰でも取得できるため、公開プロフィールのみを返す（emailは返さない）
 func (s *Server) UserAllGet(w http.ResponseWriter, r *http.Request) {
-	tableName := "EndUsers"
+	tableName := s.tables.EndUsers
 	active := true
+	projection, names := common.PublicProfileProjection()
+	names["#A"] = aws.String("isActive")
 	param := &dynamodb.ScanInput{
-		TableName:        aws.String(tableName),
-		FilterExpression: aws.String("#A = :a"),
-		ExpressionAttributeNames: map[string]*string{
-			"#A": aws.String("isActive"),
-		},
+		TableName:                aws.String(tableName),
+		FilterExpression:         aws.String("#A = :a"),
+		ProjectionExpression:     aws.String(projection),
+		ExpressionAttributeNames: names,
 		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
 			":a": {
 				BOOL: &active,
 			},
 		},
 	}
-	result, _ := s.db.Scan(param)
 
-	var resUser = make([]UserAllGetResponse, 0)
-	dynamodbattribute.UnmarshalListOfMaps(result.Items, &resUser)
+	var resUser = make([]common.PublicProfile, 0)
+	err := s.db.ScanPages(param, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+		var profiles []UserProfile
+		dynamodbattribute.UnmarshalListOfMaps(page.Items, &profiles)
+		for i := range profiles {
+			resUser = append(resUser, profiles[i].Public())
+		}
+		return true
+	})
+	if err != nil {
+		common.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
 	j, _ := json.Marshal(resUser)
 	w.Write(j)
 
@@ -113,33 +122,46 @@ type UserCreateRequest struct {
 	IsActive bool    `json:"isActive" dynamodbav:"isActive"`
 }
 
+// uidかemailが登録済みの場合は409を返す（既存のユーザーは上書きしない）
 func (s *Server) UserCreate(w http.ResponseWriter, r *http.Request) {
 	nowTime := time.Now().UTC().In(
 		time.FixedZone("Asia/Tokyo", 9*60*60),
 	).Format("2006-01-02 15:04")
 
 	var reqUser UserCreateRequest
-	json.Unmarshal(StreamToByte(r.Body), &reqUser)
+	if err := json.Unmarshal(common.StreamToByte(r.Body), &reqUser); err != nil {
+		common.WriteError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if reqUser.Uid == nil || *reqUser.Uid == "" {
+		common.WriteError(w, http.StatusBadRequest, "uid is required")
+		return
+	}
+	if err := ValidateAccount(reqUser.Name, reqUser.Email); err != nil {
+		common.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	email := NormalizeEmail(*reqUser.Email)
 
+	reqUser.Email = &email
 	reqUser.Created = &nowTime
 	reqUser.Updated = &nowTime
 	reqUser.IsActive = true
-	reqUser.IsLogin = true
+	// ログイン状態はSessionsから決まる
+	reqUser.IsLogin = false
 
-	av, err := dynamodbattribute.MarshalMap(reqUser)
-	tableName := "EndUsers"
-	input := &dynamodb.PutItemInput{
-		Item:      av,
-		TableName: aws.String(tableName),
+	err := s.CreateUser(&reqUser)
+	if err == errUidTaken || err == errEmailTaken {
+		common.WriteError(w, http.StatusConflict, err.Error())
+		return
 	}
-
-	_, err = s.db.PutItem(input)
 	if err != nil {
-		fmt.Println("Got error calling PutItem:")
-		fmt.Println(err.Error())
-		os.Exit(1)
+		common.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
 	}
 	j, _ := json.Marshal(reqUser)
+	w.WriteHeader(http.StatusCreated)
+	w.Write(j)
 
 	// 作成値のログ
 	fmt.Println(string(j))
@@ -147,19 +169,21 @@ func (s *Server) UserCreate(w http.ResponseWriter, r *http.Request) {
 
 // ==================== inPosts ====================
 type InPostsGetResponse struct {
-	Id          *int    `json:"id,omitempty" dynamodbav:"id,omitempty"`
-	MasterId    *string `json:"masterId,omitempty" dynamodbav:"masterId,omitempty"`
-	Title       *string `json:"title,omitempty" dynamodbav:"title,omitempty"`
-	EventDay    *string `json:"eventDay,omitempty" dynamodbav:"eventDay,omitempty"`
-	Day         *string `json:"day,omitempty" dynamodbav:"day,omitempty"`
-	Organizer   *string `json:"organizer,omitempty" dynamodbav:"organizer,omitempty"`
-	Commit      *string `json:"commit,omitempty" dynamodbav:"commit,omitempty"`
-	Beginner    *string `json:"beginner,omitempty" dynamodbav:"beginner,omitempty"`
-	Message     *string `json:"message,omitempty" dynamodbav:"message,omitempty"`
-	SlackUrl    *string `json:"slackUrl,omitempty" dynamodbav:"slackUrl,omitempty"`
-	TotalMember *string `json:"totalMember,omitempty" dynamodbav:"totalMember,omitempty"`
-	Position    *string `json:"position,omitempty" dynamodbav:"position,omitempty"`
-	Members     *[]struct {
+	Id                *int    `json:"id,omitempty" dynamodbav:"id,omitempty"`
+	MasterId          *string `json:"masterId,omitempty" dynamodbav:"masterId,omitempty"`
+	Title             *string `json:"title,omitempty" dynamodbav:"title,omitempty"`
+	EventDay          *string `json:"eventDay,omitempty" dynamodbav:"eventDay,omitempty"`
+	Day               *string `json:"day,omitempty" dynamodbav:"day,omitempty"`
+	Organizer         *string `json:"organizer,omitempty" dynamodbav:"organizer,omitempty"`
+	Commit            *string `json:"commit,omitempty" dynamodbav:"commit,omitempty"`
+	Beginner          *string `json:"beginner,omitempty" dynamodbav:"beginner,omitempty"`
+	Message           *string `json:"message,omitempty" dynamodbav:"message,omitempty"`
+	SlackUrl          *string `json:"slackUrl,omitempty" dynamodbav:"slackUrl,omitempty"`
+	TotalMember       *string `json:"totalMember,omitempty" dynamodbav:"totalMember,omitempty"`
+	Position          *string `json:"position,omitempty" dynamodbav:"position,omitempty"`
+	ImageUrl          *string `json:"imageUrl,omitempty" dynamodbav:"imageUrl,omitempty"`
+	ImageThumbnailUrl *string `json:"imageThumbnailUrl,omitempty" dynamodbav:"imageThumbnailUrl,omitempty"`
+	Members           *[]struct {
 		Uid      *string `json:"uid,omitempty" dynamodbav:"uid,omitempty"`
 		Position *string `json:"position,omitempty" dynamodbav:"position,omitempty"`
 	} `json:"members,omitempty" dynamodbav:"members,omitempty"`
@@ -170,28 +194,31 @@ type InPostsGetResponse struct {
 func (s *Server) InPostsGet(w http.ResponseWriter, r *http.Request) {
 	uid := r.Header.Get("uid")
 
-	tableName := "Recruits"
-	active := true
-	param := &dynamodb.ScanInput{
-		TableName:        aws.String(tableName),
-		FilterExpression: aws.String("#M = :m AND #A = :a"),
-		ExpressionAttributeNames: map[string]*string{
-			"#M": aws.String("masterId"),
-			"#A": aws.String("isActive"),
-		},
-		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
-			":m": {
-				S: aws.String(uid),
-			},
-			":a": {
-				BOOL: &active,
-			},
-		},
+	// 作成したボードのidをRecruitOwnersから取得し、ボードをまとめて取得する
+	ids, err := s.OwnedRecruitIds(uid)
+	if err != nil {
+		common.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	items, err := s.RecruitsByIds(ids)
+	if err != nil {
+		common.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
 	}
-	result, _ := s.db.Scan(param)
 
-	var resInPosts = make([]InPostsGetResponse, 0)
-	dynamodbattribute.UnmarshalListOfMaps(result.Items, &resInPosts)
+	var allRecruit = make([]InPostsGetResponse, 0)
+	dynamodbattribute.UnmarshalListOfMaps(items, &allRecruit)
+	var resInPosts = make([]InPostsGetResponse, 0, len(allRecruit))
+	for i, item := range items {
+		// 引き継ぎの直後などで作成者が変わっている場合と、募集を終了したボードは含めない
+		active := item["isActive"] != nil && aws.BoolValue(item["isActive"].BOOL)
+		if active && aws.StringValue(allRecruit[i].MasterId) == uid {
+			resInPosts = append(resInPosts, allRecruit[i])
+		}
+	}
+	sort.Slice(resInPosts, func(i, j int) bool {
+		return *resInPosts[i].Id > *resInPosts[j].Id
+	})
 	j, _ := json.Marshal(resInPosts)
 	w.Write(j)
 
@@ -199,21 +226,75 @@ func (s *Server) InPostsGet(w http.ResponseWriter, r *http.Request) {
 	fmt.Println(string(j))
 }
 
+// uidが作成したボードのid（RecruitOwnersのuid-index）
+func (s *Server) OwnedRecruitIds(uid string) ([]int, error) {
+	return s.recruitIdsByUid(s.tables.RecruitOwners, uid)
+}
+
+// uidが参加したボードのid（Membershipsのuid-index、作成したボードも含む）
+func (s *Server) JoinedRecruitIds(uid string) ([]int, error) {
+	return s.recruitIdsByUid(s.tables.Memberships, uid)
+}
+
+func (s *Server) recruitIdsByUid(table, uid string) ([]int, error) {
+	ids := make([]int, 0)
+	err := s.db.QueryPages(&dynamodb.QueryInput{
+		TableName:              aws.String(table),
+		IndexName:              aws.String("uid-index"),
+		KeyConditionExpression: aws.String("#uid = :uid"),
+		ExpressionAttributeNames: map[string]*string{
+			"#uid": aws.String("uid"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":uid": {S: aws.String(uid)},
+		},
+	}, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+		for _, item := range page.Items {
+			if id, err := strconv.Atoi(aws.StringValue(item["recruitId"].N)); err == nil {
+				ids = append(ids, id)
+			}
+		}
+		return true
+	})
+	return ids, err
+}
+
+// idsのボードを取得（存在しないidと削除済みのボードは含めない）
+func (s *Server) RecruitsByIds(ids []int) ([]map[string]*dynamodb.AttributeValue, error) {
+	keys := make([]map[string]*dynamodb.AttributeValue, 0, len(ids))
+	for _, id := range ids {
+		keys = append(keys, map[string]*dynamodb.AttributeValue{"id": {N: aws.String(strconv.Itoa(id))}})
+	}
+	found, err := common.BatchGet(s.db, s.tables.Recruits, keys, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]map[string]*dynamodb.AttributeValue, 0, len(found))
+	for _, item := range found {
+		if item["deletedAt"] == nil {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
 // ====================InJoin ====================
 type InJoinGetResponse struct {
-	Id          *int    `json:"id,omitempty" dynamodbav:"id,omitempty"`
-	MasterId    *string `json:"masterId,omitempty" dynamodbav:"masterId,omitempty"`
-	Title       *string `json:"title,omitempty" dynamodbav:"title,omitempty"`
-	EventDay    *string `json:"eventDay,omitempty" dynamodbav:"eventDay,omitempty"`
-	Day         *string `json:"day,omitempty" dynamodbav:"day,omitempty"`
-	Organizer   *string `json:"organizer,omitempty" dynamodbav:"organizer,omitempty"`
-	Commit      *string `json:"commit,omitempty" dynamodbav:"commit,omitempty"`
-	Beginner    *string `json:"beginner,omitempty" dynamodbav:"beginner,omitempty"`
-	Message     *string `json:"message,omitempty" dynamodbav:"message,omitempty"`
-	SlackUrl    *string `json:"slackUrl,omitempty" dynamodbav:"slackUrl,omitempty"`
-	TotalMember *string `json:"totalMember,omitempty" dynamodbav:"totalMember,omitempty"`
-	Position    *string `json:"position,omitempty" dynamodbav:"position,omitempty"`
-	Members     *[]struct {
+	Id                *int    `json:"id,omitempty" dynamodbav:"id,omitempty"`
+	MasterId          *string `json:"masterId,omitempty" dynamodbav:"masterId,omitempty"`
+	Title             *string `json:"title,omitempty" dynamodbav:"title,omitempty"`
+	EventDay          *string `json:"eventDay,omitempty" dynamodbav:"eventDay,omitempty"`
+	Day               *string `json:"day,omitempty" dynamodbav:"day,omitempty"`
+	Organizer         *string `json:"organizer,omitempty" dynamodbav:"organizer,omitempty"`
+	Commit            *string `json:"commit,omitempty" dynamodbav:"commit,omitempty"`
+	Beginner          *string `json:"beginner,omitempty" dynamodbav:"beginner,omitempty"`
+	Message           *string `json:"message,omitempty" dynamodbav:"message,omitempty"`
+	SlackUrl          *string `json:"slackUrl,omitempty" dynamodbav:"slackUrl,omitempty"`
+	TotalMember       *string `json:"totalMember,omitempty" dynamodbav:"totalMember,omitempty"`
+	Position          *string `json:"position,omitempty" dynamodbav:"position,omitempty"`
+	ImageUrl          *string `json:"imageUrl,omitempty" dynamodbav:"imageUrl,omitempty"`
+	ImageThumbnailUrl *string `json:"imageThumbnailUrl,omitempty" dynamodbav:"imageThumbnailUrl,omitempty"`
+	Members           *[]struct {
 		Uid      *string `json:"uid,omitempty" dynamodbav:"uid,omitempty"`
 		Position *string `json:"position,omitempty" dynamodbav:"position,omitempty"`
 	} `json:"members,omitempty" dynamodbav:"members,omitempty"`
@@ -224,36 +305,45 @@ type InJoinGetResponse struct {
 func (s *Server) InJoin(w http.ResponseWriter, r *http.Request) {
 	uid := r.Header.Get("uid")
 
-	tableName := "Recruits"
-	active := true
-
-	param := &dynamodb.ScanInput{
-		TableName:        aws.String(tableName),
-		FilterExpression: aws.String("#A = :a"),
-		ExpressionAttributeNames: map[string]*string{
-			"#A": aws.String("isActive"),
-		},
-		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
-			":a": {
-				BOOL: &active,
-			},
-		},
+	// 参加したボードのidをMembershipsから取得し、ボードをまとめて取得する
+	ids, err := s.JoinedRecruitIds(uid)
+	if err != nil {
+		common.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	items, err := s.RecruitsByIds(ids)
+	if err != nil {
+		common.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
 	}
-	result, _ := s.db.Scan(param)
 
-	var resInJoin = make([]InJoinGetResponse, 0)
 	var allRecruit = make([]InJoinGetResponse, 0)
-	dynamodbattribute.UnmarshalListOfMaps(result.Items, &allRecruit)
-
-	// membersにuidがある場合はresInJoinに追加
-	for _, row := range allRecruit {
-		members := *row.Members
-		for _, member := range members {
-			if uid == *member.Uid {
-				resInJoin = append(resInJoin, row)
-			}
+	dynamodbattribute.UnmarshalListOfMaps(items, &allRecruit)
+
+	// 停止中のユーザーのボードは表示しない（ボードの作成者のみ取得する）
+	masterIds := make([]string, 0, len(allRecruit))
+	for _, recruit := range allRecruit {
+		if recruit.MasterId != nil {
+			masterIds = append(masterIds, *recruit.MasterId)
+		}
+	}
+	suspended, err := common.SuspendedUids(s.db, s.tables.EndUsers, masterIds)
+	if err != nil {
+		common.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var resInJoin = make([]InJoinGetResponse, 0, len(allRecruit))
+	for i, item := range items {
+		active := item["isActive"] != nil && aws.BoolValue(item["isActive"].BOOL)
+		if !active || (allRecruit[i].MasterId != nil && suspended[*allRecruit[i].MasterId]) {
+			continue
 		}
+		resInJoin = append(resInJoin, allRecruit[i])
 	}
+	sort.Slice(resInJoin, func(i, j int) bool {
+		return *resInJoin[i].Id > *resInJoin[j].Id
+	})
 
 	j, _ := json.Marshal(resInJoin)
 	w.Write(j)
@@ -0,0 +1,346 @@
+package enduser
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/gorilla/mux"
+	"github.com/hew-team1/all-api-dev/common"
+)
+
+// 希望ポジション
+var positionList = map[string]string{
+	"frontend": "フロントエンド",
+	"backend":  "バックエンド",
+	"infra":    "インフラ",
+}
+
+const (
+	maxDisplayNameLength = 50
+	maxBioLength         = 1000
+	maxSkills            = 30
+	maxSkillNameLength   = 30
+	minSkillLevel        = 1
+	maxSkillLevel        = 5
+)
+
+// EndUsersに保存されるプロフィール（公開できる項目はcommon.Profile）
+type UserProfile struct {
+	common.Profile
+	Email              *string `json:"email,omitempty" dynamodbav:"email,omitempty"`
+	AvatarKey          *string `json:"-" dynamodbav:"avatarKey,omitempty"`
+	AvatarThumbnailKey *string `json:"-" dynamodbav:"avatarThumbnailKey,omitempty"`
+	Created            *string `json:"created,omitempty" dynamodbav:"created,omitempty"`
+	Updated            *string `json:"updated,omitempty" dynamodbav:"updated,omitempty"`
+	IsActive           bool    `json:"isActive" dynamodbav:"isActive"`
+	DeletedAt          *string `json:"deletedAt,omitempty" dynamodbav:"deletedAt,omitempty"`
+	// 退会の処理中（ボードの処理が終わるまでpurgeAtは設定しない）
+	Deleting bool   `json:"-" dynamodbav:"deleting,omitempty"`
+	PurgeAt  *int64 `json:"-" dynamodbav:"purgeAt,omitempty"`
+}
+
+// uidのプロフィールを取得（存在しない場合はnil）
+func (s *Server) FindProfile(uid string) (*UserProfile, error) {
+	result, err := s.db.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String(s.tables.EndUsers),
+		Key: map[string]*dynamodb.AttributeValue{
+			"uid": {
+				S: aws.String(uid),
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.Item == nil {
+		return nil, nil
+	}
+
+	var profile UserProfile
+	if err := dynamodbattribute.UnmarshalMap(result.Item, &profile); err != nil {
+		return nil, err
+	}
+	return &profile, nil
+}
+
+// 書き込みを拒否した理由
+var (
+	errUserNotFound  = fmt.Errorf("user not found")
+	errUserSuspended = fmt.Errorf("user is suspended")
+)
+
+// 書き込みできるユーザーか（停止中・退会済みはエラー）
+func (p *UserProfile) CheckActive() error {
+	if p == nil || p.DeletedAt != nil {
+		return errUserNotFound
+	}
+	if !p.IsActive {
+		return errUserSuspended
+	}
+	return nil
+}
+
+// CheckActiveのエラーをレスポンスに変換
+func WriteUserCheckError(w http.ResponseWriter, err error) {
+	switch err {
+	case errUserNotFound:
+		common.WriteError(w, http.StatusNotFound, err.Error())
+	case errUserSuspended:
+		common.WriteError(w, http.StatusForbidden, err.Error())
+	default:
+		common.WriteError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// ==================== Me Get ====================
+func (s *Server) ProfileMeGet(w http.ResponseWriter, r *http.Request) {
+	uid := r.Header.Get("uid")
+	if uid == "" {
+		common.WriteError(w, http.StatusUnauthorized, "uid header is required")
+		return
+	}
+
+	profile, err := s.FindProfile(uid)
+	if err != nil {
+		common.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if profile == nil {
+		common.WriteError(w, http.StatusNotFound, "user not found")
+		return
+	}
+
+	j, _ := json.Marshal(profile)
+	w.Write(j)
+
+	// 取得値のログ
+	fmt.Println(string(j))
+}
+
+// ==================== Get ====================
+func (s *Server) ProfileGet(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	profile, err := s.FindProfile(vars["uid"])
+	if err != nil {
+		common.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	// 停止中のユーザーは存在しないものとして扱う
+	if profile == nil || !profile.IsActive {
+		common.WriteError(w, http.StatusNotFound, "user not found")
+		return
+	}
+
+	j, _ := json.Marshal(profile.Public())
+	w.Write(j)
+
+	// 取得値のログ
+	fmt.Println(string(j))
+}
+
+// ==================== Me Update ====================
+type ProfileUpdateRequest struct {
+	DisplayName  *string            `json:"displayName"`
+	Bio          *string            `json:"bio"`
+	Skills       *[]common.Skill    `json:"skills"`
+	Positions    *[]string          `json:"positions"`
+	GithubUrl    *string            `json:"githubUrl"`
+	PortfolioUrl *string            `json:"portfolioUrl"`
+	Visibility   *map[string]string `json:"visibility"`
+}
+
+// リクエスト値の検証
+func (req *ProfileUpdateRequest) Validate() error {
+	if req.DisplayName != nil && utf8.RuneCountInString(*req.DisplayName) > maxDisplayNameLength {
+		return fmt.Errorf("displayName must be at most %d characters", maxDisplayNameLength)
+	}
+	if req.Bio != nil && utf8.RuneCountInString(*req.Bio) > maxBioLength {
+		return fmt.Errorf("bio must be at most %d characters", maxBioLength)
+	}
+	if req.Skills != nil {
+		if len(*req.Skills) > maxSkills {
+			return fmt.Errorf("skills must be at most %d items", maxSkills)
+		}
+		for _, skill := range *req.Skills {
+			if skill.Name == nil || *skill.Name == "" || utf8.RuneCountInString(*skill.Name) > maxSkillNameLength {
+				return fmt.Errorf("skill name must be 1 to %d characters", maxSkillNameLength)
+			}
+			if skill.Level == nil || *skill.Level < minSkillLevel || *skill.Level > maxSkillLevel {
+				return fmt.Errorf("skill level must be between %d and %d", minSkillLevel, maxSkillLevel)
+			}
+		}
+	}
+	if req.Positions != nil {
+		for _, position := range *req.Positions {
+			if _, ok := positionList[position]; !ok {
+				return fmt.Errorf("unknown position: %s", position)
+			}
+		}
+	}
+	for field, value := range map[string]*string{
+		"githubUrl":    req.GithubUrl,
+		"portfolioUrl": req.PortfolioUrl,
+	} {
+		if value == nil || *value == "" {
+			continue
+		}
+		u, err := url.Parse(*value)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("%s must be an http(s) URL", field)
+		}
+	}
+	if req.Visibility != nil {
+		for field, value := range *req.Visibility {
+			if !common.VisibilityFields[field] {
+				return fmt.Errorf("visibility cannot be set for %s", field)
+			}
+			if value != common.VisibilityPublic && value != common.VisibilityPrivate {
+				return fmt.Errorf("visibility must be %s or %s", common.VisibilityPublic, common.VisibilityPrivate)
+			}
+		}
+	}
+	return nil
+}
+
+// 重複を除いたポジション
+func uniquePositions(positions []string) []string {
+	seen := map[string]bool{}
+	res := make([]string, 0, len(positions))
+	for _, position := range positions {
+		if !seen[position] {
+			seen[position] = true
+			res = append(res, position)
+		}
+	}
+	return res
+}
+
+func (s *Server) ProfileMeUpdate(w http.ResponseWriter, r *http.Request) {
+	nowTime := time.Now().UTC().In(
+		time.FixedZone("Asia/Tokyo", 9*60*60),
+	).Format("2006-01-02 15:04")
+
+	uid := r.Header.Get("uid")
+	if uid == "" {
+		common.WriteError(w, http.StatusUnauthorized, "uid header is required")
+		return
+	}
+
+	// 停止中のユーザーは更新できない
+	profile, err := s.FindProfile(uid)
+	if err != nil {
+		common.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := profile.CheckActive(); err != nil {
+		WriteUserCheckError(w, err)
+		return
+	}
+
+	var reqProfile ProfileUpdateRequest
+	if err := json.Unmarshal(common.StreamToByte(r.Body), &reqProfile); err != nil {
+		common.WriteError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if err := reqProfile.Validate(); err != nil {
+		common.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if reqProfile.Positions != nil {
+		positions := uniquePositions(*reqProfile.Positions)
+		reqProfile.Positions = &positions
+	}
+
+	// 指定された項目だけを更新し、空文字の項目は削除する
+	values := map[string]interface{}{
+		"displayName":  reqProfile.DisplayName,
+		"bio":          reqProfile.Bio,
+		"githubUrl":    reqProfile.GithubUrl,
+		"portfolioUrl": reqProfile.PortfolioUrl,
+	}
+	if reqProfile.Skills != nil {
+		values["skills"] = *reqProfile.Skills
+	}
+	if reqProfile.Positions != nil {
+		values["positions"] = *reqProfile.Positions
+	}
+	if reqProfile.Visibility != nil {
+		values["visibility"] = *reqProfile.Visibility
+	}
+
+	names := map[string]*string{"#updated": aws.String("updated")}
+	attrValues := map[string]*dynamodb.AttributeValue{":updated": {S: aws.String(nowTime)}}
+	setExpr := "#updated = :updated"
+	removeExpr := ""
+	i := 0
+	for field, value := range values {
+		if str, ok := value.(*string); ok && str == nil {
+			continue
+		}
+		i++
+		name := "#f" + strconv.Itoa(i)
+		names[name] = aws.String(field)
+
+		av, err := dynamodbattribute.Marshal(value)
+		if err != nil {
+			common.WriteError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		// 空の値はDynamoDBに保存できないので属性ごと削除
+		if av.NULL != nil || (av.S != nil && *av.S == "") || (av.L != nil && len(av.L) == 0) || (av.M != nil && len(av.M) == 0) {
+			if removeExpr != "" {
+				removeExpr += ", "
+			}
+			removeExpr += name
+			continue
+		}
+		attrValues[":f"+strconv.Itoa(i)] = av
+		setExpr += ", " + name + " = :f" + strconv.Itoa(i)
+	}
+	updateExpr := "set " + setExpr
+	if removeExpr != "" {
+		updateExpr += " remove " + removeExpr
+	}
+	names["#uid"] = aws.String("uid")
+	names["#deleted"] = aws.String("deletedAt")
+
+	result, err := s.db.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName: aws.String(s.tables.EndUsers),
+		Key: map[string]*dynamodb.AttributeValue{
+			"uid": {
+				S: aws.String(uid),
+			},
+		},
+		ConditionExpression:       aws.String("attribute_exists(#uid) AND attribute_not_exists(#deleted)"),
+		UpdateExpression:          aws.String(updateExpr),
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: attrValues,
+		ReturnValues:              aws.String("ALL_NEW"),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			common.WriteError(w, http.StatusNotFound, "user not found")
+			return
+		}
+		common.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var resProfile UserProfile
+	dynamodbattribute.UnmarshalMap(result.Attributes, &resProfile)
+	j, _ := json.Marshal(resProfile)
+	w.Write(j)
+
+	// 更新値のログ
+	fmt.Println(string(j))
+}
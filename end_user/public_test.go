@@ -0,0 +1,157 @@
+package enduser
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/gorilla/mux"
+	"github.com/hew-team1/all-api-dev/common"
+	"github.com/hew-team1/all-api-dev/common/dynamotest"
+	"github.com/hew-team1/all-api-dev/common/profiletest"
+)
+
+func newPublicServer(t *testing.T) *mux.Router {
+	cfg := common.DefaultConfig()
+	db := dynamotest.New()
+	t.Cleanup(db.Close)
+	db.Table(cfg.Tables.EndUsers, "uid")
+	db.Table(cfg.Tables.Sessions, "sessionId")
+	db.Table(cfg.Tables.Recruits, "id")
+	db.Table(cfg.Tables.RecruitOwners, "recruitId")
+	db.Table(cfg.Tables.Memberships, "recruitId", "uid")
+
+	// EndUsersにはUserProfile以外の項目（isLoginなど）もあるため、保存される形のまま登録する
+	db.Put(cfg.Tables.EndUsers, profiletest.StoredUser("u1"))
+	db.Put(cfg.Tables.EndUsers, profiletest.StoredUser("u2"))
+	db.Put(cfg.Tables.Sessions, Session{
+		SessionId: aws.String("session-u1"),
+		Uid:       aws.String("u1"),
+		Ip:        aws.String("192.0.2.1"),
+	})
+
+	// u1が作成し、u2が参加したボード
+	db.Put(cfg.Tables.Recruits, profiletest.StoredRecruit(1, "u1", "u2"))
+	db.Put(cfg.Tables.RecruitOwners, map[string]interface{}{"recruitId": 1, "uid": "u1"})
+	db.Put(cfg.Tables.Memberships, map[string]interface{}{"recruitId": 1, "uid": "u1", "position": "backend"})
+	db.Put(cfg.Tables.Memberships, map[string]interface{}{"recruitId": 1, "uid": "u2", "position": "frontend"})
+
+	s := NewServer(db.Client(), nil, cfg)
+	r := mux.NewRouter()
+	r.HandleFunc("/users", s.UserAllGet).Methods("GET")
+	r.HandleFunc("/users/in-posts", s.InPostsGet).Methods("GET")
+	r.HandleFunc("/users/in-join", s.InJoin).Methods("GET")
+	r.HandleFunc("/users/{uid}", s.ProfileGet).Methods("GET")
+	return r
+}
+
+// ボードの一覧のmembers
+func recruitMembers(body []byte) ([]map[string]interface{}, error) {
+	var res []struct {
+		Members []map[string]interface{} `json:"members"`
+	}
+	if err := json.Unmarshal(body, &res); err != nil {
+		return nil, err
+	}
+	var members []map[string]interface{}
+	for _, recruit := range res {
+		members = append(members, recruit.Members...)
+	}
+	return members, nil
+}
+
+func TestPublicRoutesOmitPrivateFields(t *testing.T) {
+	r := newPublicServer(t)
+
+	tests := []struct {
+		name string
+		path string
+		uid  string
+		// レスポンスの中のプロフィール（ボードの場合はmembers）
+		profiles func(body []byte) ([]map[string]interface{}, error)
+		want     int
+		// プロフィールに必ず含まれる項目
+		wantKeys []string
+	}{
+		{
+			name: "user list",
+			path: "/users",
+			profiles: func(body []byte) ([]map[string]interface{}, error) {
+				var res []map[string]interface{}
+				err := json.Unmarshal(body, &res)
+				return res, err
+			},
+			want:     2,
+			wantKeys: []string{"uid", "displayName", "portfolioUrl"},
+		},
+		{
+			name: "user detail",
+			path: "/users/u1",
+			profiles: func(body []byte) ([]map[string]interface{}, error) {
+				var res map[string]interface{}
+				err := json.Unmarshal(body, &res)
+				return []map[string]interface{}{res}, err
+			},
+			want:     1,
+			wantKeys: []string{"uid", "displayName", "portfolioUrl"},
+		},
+		{
+			name:     "recruits in posts",
+			path:     "/users/in-posts",
+			uid:      "u1",
+			profiles: recruitMembers,
+			want:     2,
+			wantKeys: []string{"uid"},
+		},
+		{
+			name:     "recruits in join",
+			path:     "/users/in-join",
+			uid:      "u2",
+			profiles: recruitMembers,
+			want:     2,
+			wantKeys: []string{"uid"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.uid != "" {
+				req.Header.Set("uid", tt.uid)
+			}
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+			}
+			profiles, err := tt.profiles(rec.Body.Bytes())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(profiles) != tt.want {
+				t.Fatalf("got %d profiles, want %d: %s", len(profiles), tt.want, rec.Body.String())
+			}
+			for _, profile := range profiles {
+				for _, key := range profiletest.PrivateKeys() {
+					if _, ok := profile[key]; ok {
+						t.Errorf("%s is returned: %s", key, rec.Body.String())
+					}
+				}
+				for _, key := range tt.wantKeys {
+					if _, ok := profile[key]; !ok {
+						t.Errorf("%s is missing: %s", key, rec.Body.String())
+					}
+				}
+			}
+			for _, uid := range []string{"u1", "u2"} {
+				for _, value := range profiletest.PrivateValues(uid) {
+					if strings.Contains(rec.Body.String(), value) {
+						t.Errorf("%q is returned: %s", value, rec.Body.String())
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,399 @@
+package enduser
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/hew-team1/all-api-dev/common"
+)
+
+const (
+	maxNameLength     = 50
+	idempotencyHeader = "Idempotency-Key"
+	idempotencyTTL    = 24 * time.Hour // Idempotency-Keyを覚えておく期間
+)
+
+// 登録・更新を拒否した理由
+var (
+	errUidTaken   = fmt.Errorf("uid is already registered")
+	errEmailTaken = fmt.Errorf("email is already registered")
+)
+
+// 比較用にメールアドレスを正規化
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// 登録・更新時のnameとemailの検証
+func ValidateAccount(name, email *string) error {
+	if name == nil || strings.TrimSpace(*name) == "" {
+		return fmt.Errorf("name is required")
+	}
+	if utf8.RuneCountInString(*name) > maxNameLength {
+		return fmt.Errorf("name must be at most %d characters", maxNameLength)
+	}
+	if email == nil || *email == "" {
+		return fmt.Errorf("email is required")
+	}
+	if _, err := mail.ParseAddress(*email); err != nil {
+		return fmt.Errorf("email is invalid")
+	}
+	return nil
+}
+
+// メールアドレスの使用者を登録する（本人が使用中の場合はそのまま）
+func (s *Server) emailClaim(email, uid string) *dynamodb.TransactWriteItem {
+	return &dynamodb.TransactWriteItem{
+		Put: &dynamodb.Put{
+			TableName: aws.String(s.tables.UserEmails),
+			Item: map[string]*dynamodb.AttributeValue{
+				"email": {S: aws.String(email)},
+				"uid":   {S: aws.String(uid)},
+			},
+			ConditionExpression: aws.String("attribute_not_exists(#email) OR #uid = :uid"),
+			ExpressionAttributeNames: map[string]*string{
+				"#email": aws.String("email"),
+				"#uid":   aws.String("uid"),
+			},
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":uid": {S: aws.String(uid)},
+			},
+		},
+	}
+}
+
+// 本人が使用していたメールアドレスを解放する
+func (s *Server) emailRelease(email, uid string) *dynamodb.TransactWriteItem {
+	return &dynamodb.TransactWriteItem{
+		Delete: &dynamodb.Delete{
+			TableName: aws.String(s.tables.UserEmails),
+			Key: map[string]*dynamodb.AttributeValue{
+				"email": {S: aws.String(email)},
+			},
+			ConditionExpression: aws.String("attribute_not_exists(#email) OR #uid = :uid"),
+			ExpressionAttributeNames: map[string]*string{
+				"#email": aws.String("email"),
+				"#uid":   aws.String("uid"),
+			},
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":uid": {S: aws.String(uid)},
+			},
+		},
+	}
+}
+
+// EndUsersとUserEmailsに新規登録する（uidとemailが未使用の場合のみ）
+// 統計のカウンターも同じトランザクションで加算する
+func (s *Server) CreateUser(user *UserCreateRequest) error {
+	av, err := dynamodbattribute.MarshalMap(user)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.TransactWriteItems(&dynamodb.TransactWriteItemsInput{
+		TransactItems: []*dynamodb.TransactWriteItem{
+			{
+				Put: &dynamodb.Put{
+					TableName:           aws.String(s.tables.EndUsers),
+					Item:                av,
+					ConditionExpression: aws.String("attribute_not_exists(#uid)"),
+					ExpressionAttributeNames: map[string]*string{
+						"#uid": aws.String("uid"),
+					},
+				},
+			},
+			s.emailClaim(*user.Email, *user.Uid),
+			s.statUpdate(common.StatUsers, 1),
+			s.statUpdate(common.DailyStat(common.StatUsersNew, time.Now()), 1),
+		},
+	})
+	if failed, ok := common.CanceledItems(err, 4); ok {
+		if failed[0] {
+			return errUidTaken
+		}
+		if failed[1] {
+			return errEmailTaken
+		}
+	}
+	return err
+}
+
+// ==================== Upsert ====================
+type UserUpsertRequest struct {
+	Name  *string `json:"name,omitempty"`
+	Email *string `json:"email,omitempty"`
+}
+
+// 未登録なら登録し、登録済みならnameとemailのみを更新する
+// （created・isActive・isLoginは変更しない）
+func (s *Server) UserUpsert(w http.ResponseWriter, r *http.Request) {
+	nowTime := time.Now().UTC().In(
+		time.FixedZone("Asia/Tokyo", 9*60*60),
+	).Format("2006-01-02 15:04")
+
+	uid := r.Header.Get("uid")
+	if uid == "" {
+		common.WriteError(w, http.StatusUnauthorized, "uid header is required")
+		return
+	}
+
+	var reqUser UserUpsertRequest
+	if err := json.Unmarshal(common.StreamToByte(r.Body), &reqUser); err != nil {
+		common.WriteError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if err := ValidateAccount(reqUser.Name, reqUser.Email); err != nil {
+		common.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	email := NormalizeEmail(*reqUser.Email)
+
+	profile, err := s.FindProfile(uid)
+	if err != nil {
+		common.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	status := http.StatusOK
+	if profile == nil {
+		status = http.StatusCreated
+		err = s.CreateUser(&UserCreateRequest{
+			Uid:      &uid,
+			Name:     reqUser.Name,
+			Email:    &email,
+			Created:  &nowTime,
+			Updated:  &nowTime,
+			IsActive: true,
+			IsLogin:  false,
+		})
+	} else {
+		if profile.DeletedAt != nil {
+			common.WriteError(w, http.StatusConflict, "user is being deleted")
+			return
+		}
+		if !profile.IsActive {
+			WriteUserCheckError(w, errUserSuspended)
+			return
+		}
+		items := []*dynamodb.TransactWriteItem{
+			{
+				Update: &dynamodb.Update{
+					TableName: aws.String(s.tables.EndUsers),
+					Key: map[string]*dynamodb.AttributeValue{
+						"uid": {S: aws.String(uid)},
+					},
+					ConditionExpression: aws.String("attribute_exists(#uid) AND attribute_not_exists(#deleted)"),
+					UpdateExpression:    aws.String("set #name = :name, #email = :email, #updated = :updated"),
+					ExpressionAttributeNames: map[string]*string{
+						"#uid":     aws.String("uid"),
+						"#deleted": aws.String("deletedAt"),
+						"#name":    aws.String("name"),
+						"#email":   aws.String("email"),
+						"#updated": aws.String("updated"),
+					},
+					ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+						":name":    {S: reqUser.Name},
+						":email":   {S: aws.String(email)},
+						":updated": {S: aws.String(nowTime)},
+					},
+				},
+			},
+			s.emailClaim(email, uid),
+		}
+		if old := NormalizeEmail(aws.StringValue(profile.Email)); old != "" && old != email {
+			items = append(items, s.emailRelease(old, uid))
+		}
+		_, err = s.db.TransactWriteItems(&dynamodb.TransactWriteItemsInput{TransactItems: items})
+		if failed, ok := common.CanceledItems(err, len(items)); ok {
+			if failed[0] {
+				common.WriteError(w, http.StatusConflict, "user was modified, retry the request")
+				return
+			}
+			if failed[1] {
+				err = errEmailTaken
+			}
+		}
+	}
+	if err == errUidTaken || err == errEmailTaken {
+		common.WriteError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		common.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	profile, err = s.FindProfile(uid)
+	if err != nil {
+		common.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	j, _ := json.Marshal(profile)
+	w.WriteHeader(status)
+	w.Write(j)
+
+	// 登録値のログ
+	fmt.Println(string(j))
+}
+
+// ==================== Idempotency ====================
+// IdempotencyKeysに保存される処理結果
+type IdempotencyRecord struct {
+	IdempotencyKey *string `dynamodbav:"idempotencyKey,omitempty"`
+	RequestHash    *string `dynamodbav:"requestHash,omitempty"`
+	Status         int     `dynamodbav:"status"` // 0は処理中
+	Body           []byte  `dynamodbav:"body,omitempty"`
+	ContentType    *string `dynamodbav:"contentType,omitempty"`
+	ExpiresAt      *int64  `dynamodbav:"expiresAt,omitempty"`
+}
+
+// ステータスとレスポンスを記録するResponseWriter
+type recordingWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rw *recordingWriter) WriteHeader(status int) {
+	if rw.status == 0 {
+		rw.status = status
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *recordingWriter) Write(b []byte) (int, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	rw.body.Write(b)
+	return rw.ResponseWriter.Write(b)
+}
+
+// Idempotency-Keyヘッダーがあれば、同じキーでの再送に前回と同じレスポンスを返す
+func (s *Server) Idempotent(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(idempotencyHeader)
+		if key == "" {
+			next(w, r)
+			return
+		}
+
+		body := common.StreamToByte(r.Body)
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		sum := sha256.Sum256(append([]byte(r.Header.Get("uid")+"\n"), body...))
+		hash := hex.EncodeToString(sum[:])
+		recordKey := r.Method + " " + r.URL.Path + " " + key
+		expiresAt := time.Now().Add(idempotencyTTL).Unix()
+
+		// 処理中として登録（既にあれば前回の結果を使う）
+		_, err := s.db.PutItem(&dynamodb.PutItemInput{
+			TableName: aws.String(s.tables.IdempotencyKeys),
+			Item: map[string]*dynamodb.AttributeValue{
+				"idempotencyKey": {S: aws.String(recordKey)},
+				"requestHash":    {S: aws.String(hash)},
+				"status":         {N: aws.String("0")},
+				"expiresAt":      {N: aws.String(strconv.FormatInt(expiresAt, 10))},
+			},
+			ConditionExpression: aws.String("attribute_not_exists(#key) OR #expires < :now"),
+			ExpressionAttributeNames: map[string]*string{
+				"#key":     aws.String("idempotencyKey"),
+				"#expires": aws.String("expiresAt"),
+			},
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":now": {N: aws.String(strconv.FormatInt(time.Now().Unix(), 10))},
+			},
+		})
+		if err != nil {
+			if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != dynamodb.ErrCodeConditionalCheckFailedException {
+				common.WriteError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			s.replayIdempotent(w, recordKey, hash)
+			return
+		}
+
+		rw := &recordingWriter{ResponseWriter: w}
+		next(rw, r)
+
+		// サーバーエラーは再送で再実行できるように記録しない
+		if rw.status == 0 || rw.status >= 500 {
+			s.db.DeleteItem(&dynamodb.DeleteItemInput{
+				TableName: aws.String(s.tables.IdempotencyKeys),
+				Key: map[string]*dynamodb.AttributeValue{
+					"idempotencyKey": {S: aws.String(recordKey)},
+				},
+			})
+			return
+		}
+		record := IdempotencyRecord{
+			IdempotencyKey: &recordKey,
+			RequestHash:    &hash,
+			Status:         rw.status,
+			Body:           rw.body.Bytes(),
+			ExpiresAt:      &expiresAt,
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "" {
+			record.ContentType = &ct
+		}
+		av, _ := dynamodbattribute.MarshalMap(record)
+		if _, err := s.db.PutItem(&dynamodb.PutItemInput{
+			TableName: aws.String(s.tables.IdempotencyKeys),
+			Item:      av,
+		}); err != nil {
+			fmt.Println("Got error saving idempotency key:")
+			fmt.Println(err.Error())
+		}
+	}
+}
+
+// 記録済みのレスポンスを返す
+func (s *Server) replayIdempotent(w http.ResponseWriter, recordKey, hash string) {
+	result, err := s.db.GetItem(&dynamodb.GetItemInput{
+		TableName:      aws.String(s.tables.IdempotencyKeys),
+		ConsistentRead: aws.Bool(true),
+		Key: map[string]*dynamodb.AttributeValue{
+			"idempotencyKey": {S: aws.String(recordKey)},
+		},
+	})
+	if err != nil {
+		common.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if result.Item == nil {
+		common.WriteError(w, http.StatusConflict, idempotencyHeader+" expired during the request, retry the request")
+		return
+	}
+	var record IdempotencyRecord
+	dynamodbattribute.UnmarshalMap(result.Item, &record)
+
+	if aws.StringValue(record.RequestHash) != hash {
+		common.WriteError(w, http.StatusUnprocessableEntity, idempotencyHeader+" was already used for a different request")
+		return
+	}
+	if record.Status == 0 {
+		common.WriteError(w, http.StatusConflict, "a request with this "+idempotencyHeader+" is still in progress")
+		return
+	}
+	if record.ContentType != nil {
+		w.Header().Set("Content-Type", *record.ContentType)
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(record.Status)
+	w.Write(record.Body)
+
+	// 再送のログ
+	fmt.Println("idempotent replay", recordKey)
+}
@@ -0,0 +1,165 @@
+package enduser
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/gorilla/mux"
+	"github.com/hew-team1/all-api-dev/common"
+)
+
+const maxReportDetail = 1000
+
+// 通報の対象
+const (
+	ReportTargetRecruit = "recruit"
+	ReportTargetUser    = "user"
+)
+
+// 管理者が対応する前の通報の状態
+const ReportStatusOpen = "open"
+
+// 通報のカテゴリ
+var reportCategories = map[string]string{
+	"spam":          "スパム",
+	"harassment":    "嫌がらせ",
+	"inappropriate": "不適切な内容",
+	"impersonation": "なりすまし",
+	"other":         "その他",
+}
+
+// Reportsの項目
+type Report struct {
+	Id          string  `json:"id" dynamodbav:"id"`
+	TargetType  string  `json:"targetType" dynamodbav:"targetType"`
+	TargetId    string  `json:"targetId" dynamodbav:"targetId"`
+	ReporterUid string  `json:"reporterUid" dynamodbav:"reporterUid"`
+	Category    string  `json:"category" dynamodbav:"category"`
+	Detail      *string `json:"detail,omitempty" dynamodbav:"detail,omitempty"`
+	Status      string  `json:"status" dynamodbav:"status"`
+	Created     string  `json:"created" dynamodbav:"created"`
+	Updated     string  `json:"updated" dynamodbav:"updated"`
+}
+
+type ReportCreateRequest struct {
+	Category *string `json:"category"`
+	Detail   *string `json:"detail"`
+}
+
+func (req *ReportCreateRequest) Validate() error {
+	if req.Category == nil {
+		return fmt.Errorf("category is required")
+	}
+	if _, ok := reportCategories[*req.Category]; !ok {
+		return fmt.Errorf("unknown category %q", *req.Category)
+	}
+	if req.Detail != nil && utf8.RuneCountInString(*req.Detail) > maxReportDetail {
+		return fmt.Errorf("detail must be at most %d characters", maxReportDetail)
+	}
+	return nil
+}
+
+// 通報を登録する
+func (s *Server) CreateReport(targetType, targetId, reporterUid string, req *ReportCreateRequest) (*Report, error) {
+	nowTime := time.Now().UTC().In(
+		time.FixedZone("Asia/Tokyo", 9*60*60),
+	).Format("2006-01-02 15:04")
+
+	id, err := common.RandomHex(16)
+	if err != nil {
+		return nil, err
+	}
+	report := &Report{
+		Id:          id,
+		TargetType:  targetType,
+		TargetId:    targetId,
+		ReporterUid: reporterUid,
+		Category:    *req.Category,
+		Detail:      req.Detail,
+		Status:      ReportStatusOpen,
+		Created:     nowTime,
+		Updated:     nowTime,
+	}
+	av, err := dynamodbattribute.MarshalMap(report)
+	if err != nil {
+		return nil, err
+	}
+	_, err = s.db.PutItem(&dynamodb.PutItemInput{
+		TableName:           aws.String(s.tables.Reports),
+		Item:                av,
+		ConditionExpression: aws.String("attribute_not_exists(#id)"),
+		ExpressionAttributeNames: map[string]*string{
+			"#id": aws.String("id"),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// ==================== Report ====================
+func (s *Server) UserReport(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	uid := r.Header.Get("uid")
+	if uid == "" {
+		common.WriteError(w, http.StatusUnauthorized, "uid header is required")
+		return
+	}
+	if uid == vars["uid"] {
+		common.WriteError(w, http.StatusBadRequest, "cannot report yourself")
+		return
+	}
+
+	// 停止中のユーザーは通報できない
+	reporter, err := s.FindProfile(uid)
+	if err != nil {
+		common.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := reporter.CheckActive(); err != nil {
+		WriteUserCheckError(w, err)
+		return
+	}
+
+	var reqReport ReportCreateRequest
+	if err := json.Unmarshal(common.StreamToByte(r.Body), &reqReport); err != nil {
+		common.WriteError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if err := reqReport.Validate(); err != nil {
+		common.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// 停止中のユーザーも通報できる（退会済みは不可）
+	target, err := s.FindProfile(vars["uid"])
+	if err != nil {
+		common.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if target == nil || target.DeletedAt != nil {
+		common.WriteError(w, http.StatusNotFound, "user not found")
+		return
+	}
+
+	report, err := s.CreateReport(ReportTargetUser, vars["uid"], uid, &reqReport)
+	if err != nil {
+		common.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	j, _ := json.Marshal(report)
+	w.WriteHeader(http.StatusCreated)
+	w.Write(j)
+
+	// 作成値のログ
+	fmt.Println(string(j))
+}
@@ -0,0 +1,323 @@
+package enduser
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/gorilla/mux"
+	"github.com/hew-team1/all-api-dev/common"
+)
+
+const (
+	sessionHeader      = "Session-Id"
+	sessionTTL         = 30 * 24 * time.Hour // ログインの有効期間
+	sessionTouchPeriod = 5 * time.Minute     // lastSeenを更新する間隔
+	maxDeviceLength    = 100
+)
+
+// Sessionsに保存されるログイン情報
+type Session struct {
+	SessionId *string `json:"sessionId,omitempty" dynamodbav:"sessionId,omitempty"`
+	Uid       *string `json:"uid,omitempty" dynamodbav:"uid,omitempty"`
+	Device    *string `json:"device,omitempty" dynamodbav:"device,omitempty"`
+	Ip        *string `json:"ip,omitempty" dynamodbav:"ip,omitempty"`
+	UserAgent *string `json:"userAgent,omitempty" dynamodbav:"userAgent,omitempty"`
+	Created   *string `json:"created,omitempty" dynamodbav:"created,omitempty"`
+	LastSeen  *string `json:"lastSeen,omitempty" dynamodbav:"lastSeen,omitempty"`
+	// 最終アクセスの時刻（UNIX秒）
+	LastSeenAt *int64 `json:"-" dynamodbav:"lastSeenAt,omitempty"`
+	// 有効期限（UNIX秒、DynamoDBのTTLにも使う）
+	ExpiresAt *int64 `json:"-" dynamodbav:"expiresAt,omitempty"`
+}
+
+// リクエスト元のIPアドレス
+func clientIp(r *http.Request) string {
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		return strings.TrimSpace(strings.Split(forwarded, ",")[0])
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// uidの有効なセッションを取得
+func (s *Server) ActiveSessions(uid string) ([]Session, error) {
+	sessions := make([]Session, 0)
+	err := s.db.QueryPages(&dynamodb.QueryInput{
+		TableName:              aws.String(s.tables.Sessions),
+		IndexName:              aws.String("uid-index"),
+		KeyConditionExpression: aws.String("#uid = :uid"),
+		FilterExpression:       aws.String("#expires > :now"),
+		ExpressionAttributeNames: map[string]*string{
+			"#uid":     aws.String("uid"),
+			"#expires": aws.String("expiresAt"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":uid": {S: aws.String(uid)},
+			":now": {N: aws.String(strconv.FormatInt(time.Now().Unix(), 10))},
+		},
+	}, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+		var items []Session
+		dynamodbattribute.UnmarshalListOfMaps(page.Items, &items)
+		sessions = append(sessions, items...)
+		return true
+	})
+	return sessions, err
+}
+
+// 有効なセッションの有無をEndUsersのisLoginに反映
+func (s *Server) RefreshLoginState(uid string) error {
+	return common.RefreshLoginState(s.db, s.tables, uid)
+}
+
+// セッションを削除（uidが一致する場合のみ）
+func (s *Server) RevokeSession(uid, sessionId string) (bool, error) {
+	_, err := s.db.DeleteItem(&dynamodb.DeleteItemInput{
+		TableName: aws.String(s.tables.Sessions),
+		Key: map[string]*dynamodb.AttributeValue{
+			"sessionId": {
+				S: aws.String(sessionId),
+			},
+		},
+		ConditionExpression: aws.String("#uid = :uid"),
+		ExpressionAttributeNames: map[string]*string{
+			"#uid": aws.String("uid"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":uid": {S: aws.String(uid)},
+		},
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, s.RefreshLoginState(uid)
+}
+
+// uidのセッションを全て削除
+func (s *Server) RevokeAllSessions(uid string) error {
+	_, err := common.RevokeAllSessions(s.db, s.tables, uid)
+	return err
+}
+
+// Session-Idヘッダーがあれば最終アクセス日時を更新するミドルウェア
+func (s *Server) TouchSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sessionId := r.Header.Get(sessionHeader)
+		uid := r.Header.Get("uid")
+		if sessionId != "" && uid != "" {
+			now := time.Now()
+			nowTime := now.UTC().In(
+				time.FixedZone("Asia/Tokyo", 9*60*60),
+			).Format("2006-01-02 15:04")
+
+			// 直近に更新済みの場合は書き込まない
+			_, err := s.db.UpdateItem(&dynamodb.UpdateItemInput{
+				TableName: aws.String(s.tables.Sessions),
+				Key: map[string]*dynamodb.AttributeValue{
+					"sessionId": {
+						S: aws.String(sessionId),
+					},
+				},
+				ConditionExpression: aws.String("#uid = :uid AND #expires > :now AND #seenAt < :threshold"),
+				UpdateExpression:    aws.String("set #seen = :seen, #seenAt = :now, #ip = :ip"),
+				ExpressionAttributeNames: map[string]*string{
+					"#uid":     aws.String("uid"),
+					"#expires": aws.String("expiresAt"),
+					"#seen":    aws.String("lastSeen"),
+					"#seenAt":  aws.String("lastSeenAt"),
+					"#ip":      aws.String("ip"),
+				},
+				ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+					":uid":       {S: aws.String(uid)},
+					":now":       {N: aws.String(strconv.FormatInt(now.Unix(), 10))},
+					":threshold": {N: aws.String(strconv.FormatInt(now.Add(-sessionTouchPeriod).Unix(), 10))},
+					":seen":      {S: aws.String(nowTime)},
+					":ip":        {S: aws.String(clientIp(r))},
+				},
+			})
+			if aerr, ok := err.(awserr.Error); err != nil && !(ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException) {
+				fmt.Println("Got error updating session:")
+				fmt.Println(err.Error())
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ==================== Login ====================
+type LoginRequest struct {
+	Device *string `json:"device,omitempty"`
+}
+
+func (s *Server) Login(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	nowTime := now.UTC().In(
+		time.FixedZone("Asia/Tokyo", 9*60*60),
+	).Format("2006-01-02 15:04")
+
+	uid := r.Header.Get("uid")
+	if uid == "" {
+		common.WriteError(w, http.StatusUnauthorized, "uid header is required")
+		return
+	}
+
+	var reqLogin LoginRequest
+	json.Unmarshal(common.StreamToByte(r.Body), &reqLogin)
+	if reqLogin.Device != nil && utf8.RuneCountInString(*reqLogin.Device) > maxDeviceLength {
+		common.WriteError(w, http.StatusBadRequest, fmt.Sprintf("device must be at most %d characters", maxDeviceLength))
+		return
+	}
+
+	profile, err := s.FindProfile(uid)
+	if err != nil {
+		common.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if profile == nil || profile.DeletedAt != nil {
+		common.WriteError(w, http.StatusNotFound, "user not found")
+		return
+	}
+	if !profile.IsActive {
+		common.WriteError(w, http.StatusForbidden, "user is suspended")
+		return
+	}
+
+	sessionId, err := common.RandomHex(32)
+	if err != nil {
+		common.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	seenAt := now.Unix()
+	expiresAt := now.Add(sessionTTL).Unix()
+	session := Session{
+		SessionId:  &sessionId,
+		Uid:        &uid,
+		Device:     reqLogin.Device,
+		Ip:         aws.String(clientIp(r)),
+		Created:    &nowTime,
+		LastSeen:   &nowTime,
+		LastSeenAt: &seenAt,
+		ExpiresAt:  &expiresAt,
+	}
+	if ua := r.UserAgent(); ua != "" {
+		session.UserAgent = &ua
+	}
+
+	av, _ := dynamodbattribute.MarshalMap(session)
+	_, err = s.db.PutItem(&dynamodb.PutItemInput{
+		TableName: aws.String(s.tables.Sessions),
+		Item:      av,
+	})
+	if err != nil {
+		common.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := s.RefreshLoginState(uid); err != nil {
+		common.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	j, _ := json.Marshal(session)
+	w.WriteHeader(http.StatusCreated)
+	w.Write(j)
+
+	// ログインのログ
+	fmt.Println("login", uid, clientIp(r))
+}
+
+// ==================== Logout ====================
+func (s *Server) Logout(w http.ResponseWriter, r *http.Request) {
+	uid := r.Header.Get("uid")
+	sessionId := r.Header.Get(sessionHeader)
+	if uid == "" || sessionId == "" {
+		common.WriteError(w, http.StatusUnauthorized, "uid and "+sessionHeader+" headers are required")
+		return
+	}
+
+	revoked, err := s.RevokeSession(uid, sessionId)
+	if err != nil {
+		common.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !revoked {
+		common.WriteError(w, http.StatusNotFound, "session not found")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+
+	// ログアウトのログ
+	fmt.Println("logout", uid)
+}
+
+// ==================== Sessions Get ====================
+type SessionGetResponse struct {
+	Session
+	Current bool `json:"current"`
+}
+
+func (s *Server) SessionAllGet(w http.ResponseWriter, r *http.Request) {
+	uid := r.Header.Get("uid")
+	if uid == "" {
+		common.WriteError(w, http.StatusUnauthorized, "uid header is required")
+		return
+	}
+
+	sessions, err := s.ActiveSessions(uid)
+	if err != nil {
+		common.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	current := r.Header.Get(sessionHeader)
+	resSessions := make([]SessionGetResponse, 0, len(sessions))
+	for _, session := range sessions {
+		resSessions = append(resSessions, SessionGetResponse{
+			Session: session,
+			Current: aws.StringValue(session.SessionId) == current,
+		})
+	}
+
+	j, _ := json.Marshal(resSessions)
+	w.Write(j)
+
+	// 取得値のログ
+	fmt.Println(string(j))
+}
+
+// ==================== Session Revoke ====================
+func (s *Server) SessionRevoke(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	uid := r.Header.Get("uid")
+	if uid == "" {
+		common.WriteError(w, http.StatusUnauthorized, "uid header is required")
+		return
+	}
+
+	revoked, err := s.RevokeSession(uid, vars["sessionId"])
+	if err != nil {
+		common.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !revoked {
+		common.WriteError(w, http.StatusNotFound, "session not found")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+
+	// 削除のログ
+	fmt.Println("revoke", uid, vars["sessionId"])
+}
@@ -0,0 +1,16 @@
+package enduser
+
+import (
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/hew-team1/all-api-dev/common"
+)
+
+// カウンターを加算するUpdate（トランザクションに含める場合）
+func (s *Server) statUpdate(key string, n int) *dynamodb.TransactWriteItem {
+	return common.StatUpdate(s.tables.AtomicCounter, key, n)
+}
+
+// カウンターを加算する（統計のみのため、失敗しても処理は止めない）
+func (s *Server) AddStats(deltas map[string]int) {
+	common.AddStats(s.db, s.tables.AtomicCounter, deltas)
+}
@@ -0,0 +1,285 @@
+package events
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodbstreams"
+	"github.com/hew-team1/all-api-dev/common"
+)
+
+const (
+	// ハンドラーの試行回数（全て失敗した場合はログに残して次のイベントに進む）
+	handlerAttempts = 3
+	// 1回の読み込みでシャードごとに読むGetRecordsの回数の上限
+	maxBatchesPerShard = 10
+)
+
+// ストリームを読み、イベントをハンドラーに渡す
+type Consumer struct {
+	db       *dynamodb.DynamoDB
+	streams  *dynamodbstreams.DynamoDBStreams
+	tables   common.Tables
+	decoders map[string]decoder
+	handlers []Handler
+	interval time.Duration
+}
+
+func NewConsumer(db *dynamodb.DynamoDB, streams *dynamodbstreams.DynamoDBStreams, cfg *common.Config, handlers []Handler) *Consumer {
+	return &Consumer{
+		db:      db,
+		streams: streams,
+		tables:  cfg.Tables,
+		decoders: map[string]decoder{
+			cfg.Tables.Recruits: decodeRecruit,
+			cfg.Tables.EndUsers: decodeUser,
+		},
+		handlers: handlers,
+		interval: time.Duration(cfg.Events.PollSeconds) * time.Second,
+	}
+}
+
+// stopが閉じられるまでintervalごとに読み込む（失敗した場合は次の読み込みで保存した位置から読み直す）
+func (c *Consumer) Run(stop <-chan struct{}) {
+	for {
+		if _, err := c.Poll(); err != nil {
+			fmt.Println("Got error polling streams:")
+			fmt.Println(err.Error())
+		}
+		select {
+		case <-stop:
+			return
+		case <-time.After(c.interval):
+		}
+	}
+}
+
+// 全てのテーブルのストリームを1回読み込み、処理したレコード数を返す
+func (c *Consumer) Poll() (int, error) {
+	total := 0
+	for table, decode := range c.decoders {
+		n, err := c.pollTable(table, decode)
+		if err != nil {
+			return total, fmt.Errorf("%s: %v", table, err)
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// ==================== Shards ====================
+// シャードごとの読み終えた位置
+type checkpoint struct {
+	ShardId        string `dynamodbav:"shardId"`
+	StreamArn      string `dynamodbav:"streamArn"`
+	SequenceNumber string `dynamodbav:"sequenceNumber,omitempty"`
+	// 閉じたシャードを最後まで読んだか
+	Done bool `dynamodbav:"done"`
+}
+
+func (c *Consumer) pollTable(table string, decode decoder) (int, error) {
+	result, err := c.db.DescribeTable(&dynamodb.DescribeTableInput{
+		TableName: aws.String(table),
+	})
+	if err != nil {
+		return 0, err
+	}
+	streamArn := aws.StringValue(result.Table.LatestStreamArn)
+	if streamArn == "" {
+		return 0, fmt.Errorf("stream is not enabled (run migrate)")
+	}
+
+	var shards []*dynamodbstreams.Shard
+	var start *string
+	for {
+		desc, err := c.streams.DescribeStream(&dynamodbstreams.DescribeStreamInput{
+			StreamArn:             aws.String(streamArn),
+			ExclusiveStartShardId: start,
+		})
+		if err != nil {
+			return 0, err
+		}
+		shards = append(shards, desc.StreamDescription.Shards...)
+		start = desc.StreamDescription.LastEvaluatedShardId
+		if start == nil {
+			break
+		}
+	}
+
+	checkpoints := map[string]*checkpoint{}
+	for _, shard := range shards {
+		cp, err := c.loadCheckpoint(streamArn, aws.StringValue(shard.ShardId))
+		if err != nil {
+			return 0, err
+		}
+		checkpoints[aws.StringValue(shard.ShardId)] = cp
+	}
+
+	// 順序を保つため、親のシャードを読み終えてから子のシャードを読む
+	total := 0
+	for _, shard := range shards {
+		cp := checkpoints[aws.StringValue(shard.ShardId)]
+		if cp.Done {
+			continue
+		}
+		if parent, ok := checkpoints[aws.StringValue(shard.ParentShardId)]; ok && !parent.Done {
+			continue
+		}
+		n, err := c.pollShard(cp, decode)
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// 保存した位置（無い場合は先頭から読む）
+func (c *Consumer) loadCheckpoint(streamArn, shardId string) (*checkpoint, error) {
+	result, err := c.db.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String(c.tables.StreamCheckpoints),
+		Key: map[string]*dynamodb.AttributeValue{
+			"shardId": {S: aws.String(shardId)},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+	cp := &checkpoint{ShardId: shardId, StreamArn: streamArn}
+	if result.Item != nil {
+		if err := dynamodbattribute.UnmarshalMap(result.Item, cp); err != nil {
+			return nil, err
+		}
+	}
+	return cp, nil
+}
+
+func (c *Consumer) saveCheckpoint(cp *checkpoint) error {
+	item, err := dynamodbattribute.MarshalMap(cp)
+	if err != nil {
+		return err
+	}
+	item["updated"] = &dynamodb.AttributeValue{S: aws.String(time.Now().UTC().In(
+		time.FixedZone("Asia/Tokyo", 9*60*60),
+	).Format("2006-01-02 15:04"))}
+	_, err = c.db.PutItem(&dynamodb.PutItemInput{
+		TableName: aws.String(c.tables.StreamCheckpoints),
+		Item:      item,
+	})
+	return err
+}
+
+// 保存した位置の次から読むイテレーター（位置が期限切れで削除されている場合は残っている先頭から読む）
+func (c *Consumer) iterator(cp *checkpoint) (*string, error) {
+	input := &dynamodbstreams.GetShardIteratorInput{
+		StreamArn:         aws.String(cp.StreamArn),
+		ShardId:           aws.String(cp.ShardId),
+		ShardIteratorType: aws.String(dynamodbstreams.ShardIteratorTypeTrimHorizon),
+	}
+	if cp.SequenceNumber != "" {
+		input.ShardIteratorType = aws.String(dynamodbstreams.ShardIteratorTypeAfterSequenceNumber)
+		input.SequenceNumber = aws.String(cp.SequenceNumber)
+	}
+	result, err := c.streams.GetShardIterator(input)
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodbstreams.ErrCodeTrimmedDataAccessException {
+		fmt.Println("checkpoint trimmed, reading from the oldest record:", cp.ShardId)
+		input.ShardIteratorType = aws.String(dynamodbstreams.ShardIteratorTypeTrimHorizon)
+		input.SequenceNumber = nil
+		result, err = c.streams.GetShardIterator(input)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result.ShardIterator, nil
+}
+
+// シャードを読めるところまで読み、ページごとに位置を保存する
+func (c *Consumer) pollShard(cp *checkpoint, decode decoder) (int, error) {
+	iter, err := c.iterator(cp)
+	if err != nil {
+		return 0, err
+	}
+
+	total := 0
+	for batch := 0; batch < maxBatchesPerShard; batch++ {
+		result, err := c.streams.GetRecords(&dynamodbstreams.GetRecordsInput{
+			ShardIterator: iter,
+		})
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodbstreams.ErrCodeExpiredIteratorException {
+			if iter, err = c.iterator(cp); err != nil {
+				return total, err
+			}
+			continue
+		}
+		if err != nil {
+			return total, err
+		}
+
+		for _, record := range result.Records {
+			c.dispatch(decode, record)
+			cp.SequenceNumber = aws.StringValue(record.Dynamodb.SequenceNumber)
+		}
+		total += len(result.Records)
+
+		// 次のイテレーターが無い場合はシャードが閉じ、最後まで読んだ
+		iter = result.NextShardIterator
+		cp.Done = iter == nil
+		if len(result.Records) > 0 || cp.Done {
+			if err := c.saveCheckpoint(cp); err != nil {
+				return total, err
+			}
+		}
+		if cp.Done || len(result.Records) == 0 {
+			break
+		}
+	}
+	return total, nil
+}
+
+// ==================== Dispatch ====================
+func (c *Consumer) dispatch(decode decoder, record *dynamodbstreams.Record) {
+	events, err := decode(recordMeta(record), record)
+	if err != nil {
+		// 変換できないレコードは再試行しても変わらないため飛ばす
+		fmt.Println("Got error decoding record", aws.StringValue(record.EventID))
+		fmt.Println(err.Error())
+		return
+	}
+	for _, e := range events {
+		for _, h := range c.handlers {
+			if err := handle(h, e); err != nil {
+				fmt.Printf("handler %s failed on %s %s\n", h.Name(), e.Type(), e.Metadata().ID)
+				fmt.Println(err.Error())
+			}
+		}
+	}
+}
+
+// 失敗した場合は間隔を空けて再試行する
+func handle(h Handler, e Event) error {
+	var err error
+	for attempt := 1; attempt <= handlerAttempts; attempt++ {
+		if err = safeHandle(h, e); err == nil {
+			return nil
+		}
+		if attempt < handlerAttempts {
+			time.Sleep(time.Duration(attempt) * time.Second)
+		}
+	}
+	return err
+}
+
+// ハンドラーのpanicで他のイベントの処理を止めない
+func safeHandle(h Handler, e Event) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return h.Handle(e)
+}
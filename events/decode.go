@@ -0,0 +1,182 @@
+package events
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodbstreams"
+	"github.com/hew-team1/all-api-dev/common"
+)
+
+// テーブルのレコードをイベントに変換する（イベントにならない変更は空）
+type decoder func(meta Meta, record *dynamodbstreams.Record) ([]Event, error)
+
+func recordMeta(record *dynamodbstreams.Record) Meta {
+	meta := Meta{ID: aws.StringValue(record.EventID)}
+	if record.Dynamodb != nil && record.Dynamodb.ApproximateCreationDateTime != nil {
+		meta.At = *record.Dynamodb.ApproximateCreationDateTime
+	}
+	return meta
+}
+
+// 変更前と変更後の項目（無い場合はnilのまま）
+func images(record *dynamodbstreams.Record, old, new interface{}) (bool, bool, error) {
+	var hasOld, hasNew bool
+	if record.Dynamodb == nil {
+		return false, false, nil
+	}
+	if item := record.Dynamodb.OldImage; len(item) > 0 {
+		if err := dynamodbattribute.UnmarshalMap(item, old); err != nil {
+			return false, false, err
+		}
+		hasOld = true
+	}
+	if item := record.Dynamodb.NewImage; len(item) > 0 {
+		if err := dynamodbattribute.UnmarshalMap(item, new); err != nil {
+			return false, false, err
+		}
+		hasNew = true
+	}
+	return hasOld, hasNew, nil
+}
+
+// 停止の期限（suspendedUntil、UNIX時間）
+func until(item map[string]*dynamodb.AttributeValue) *time.Time {
+	if item["suspendedUntil"] == nil || item["suspendedUntil"].N == nil {
+		return nil
+	}
+	sec, err := strconv.ParseInt(aws.StringValue(item["suspendedUntil"].N), 10, 64)
+	if err != nil {
+		return nil
+	}
+	t := time.Unix(sec, 0).In(time.FixedZone("Asia/Tokyo", 9*60*60))
+	return &t
+}
+
+// ==================== Recruits ====================
+type recruitImage struct {
+	Id          int    `dynamodbav:"id"`
+	MasterId    string `dynamodbav:"masterId"`
+	Title       string `dynamodbav:"title"`
+	TotalMember string `dynamodbav:"totalMember"`
+	Members     []struct {
+		Uid      string `dynamodbav:"uid"`
+		Position string `dynamodbav:"position"`
+	} `dynamodbav:"members"`
+	IsActive         bool    `dynamodbav:"isActive"`
+	Closed           *string `dynamodbav:"closed"`
+	DeletedAt        *string `dynamodbav:"deletedAt"`
+	ModerationReason string  `dynamodbav:"moderationReason"`
+}
+
+func decodeRecruit(meta Meta, record *dynamodbstreams.Record) ([]Event, error) {
+	var old, new recruitImage
+	hasOld, hasNew, err := images(record, &old, &new)
+	if err != nil || !hasNew {
+		return nil, err
+	}
+	totalMember, _ := strconv.Atoi(new.TotalMember)
+
+	if new.DeletedAt != nil {
+		if hasOld && old.DeletedAt == nil {
+			return []Event{BoardClosed{
+				Meta:      meta,
+				RecruitId: new.Id,
+				MasterId:  new.MasterId,
+				Reason:    ClosedByDelete,
+			}}, nil
+		}
+		return nil, nil
+	}
+
+	if !hasOld {
+		return []Event{BoardCreated{
+			Meta:        meta,
+			RecruitId:   new.Id,
+			MasterId:    new.MasterId,
+			Title:       new.Title,
+			TotalMember: totalMember,
+		}}, nil
+	}
+
+	res := []Event{}
+	joined := map[string]bool{}
+	for _, member := range old.Members {
+		joined[member.Uid] = true
+	}
+	for _, member := range new.Members {
+		// 退会したユーザーの匿名化は参加ではない
+		if joined[member.Uid] || member.Uid == common.DeletedUserUid {
+			continue
+		}
+		joined[member.Uid] = true
+		res = append(res, MemberJoined{
+			Meta:        meta,
+			RecruitId:   new.Id,
+			MasterId:    new.MasterId,
+			Uid:         member.Uid,
+			Position:    member.Position,
+			Members:     len(new.Members),
+			TotalMember: totalMember,
+		})
+	}
+
+	if totalMember > 0 && len(old.Members) < totalMember && len(new.Members) >= totalMember {
+		res = append(res, BoardFull{
+			Meta:        meta,
+			RecruitId:   new.Id,
+			MasterId:    new.MasterId,
+			Members:     len(new.Members),
+			TotalMember: totalMember,
+		})
+	}
+
+	// 作成者の退会による締め切り（closedを同時に設定する）は停止ではない
+	if old.Closed == nil && new.Closed != nil {
+		res = append(res, BoardClosed{
+			Meta:      meta,
+			RecruitId: new.Id,
+			MasterId:  new.MasterId,
+			Reason:    ClosedByOwnerLeft,
+		})
+	} else if old.IsActive && !new.IsActive && new.Closed == nil {
+		res = append(res, BoardSuspended{
+			Meta:      meta,
+			RecruitId: new.Id,
+			MasterId:  new.MasterId,
+			Reason:    new.ModerationReason,
+			Until:     until(record.Dynamodb.NewImage),
+		})
+	}
+	return res, nil
+}
+
+// ==================== EndUsers ====================
+type userImage struct {
+	Uid              string  `dynamodbav:"uid"`
+	IsActive         bool    `dynamodbav:"isActive"`
+	DeletedAt        *string `dynamodbav:"deletedAt"`
+	ModerationReason string  `dynamodbav:"moderationReason"`
+}
+
+func decodeUser(meta Meta, record *dynamodbstreams.Record) ([]Event, error) {
+	var old, new userImage
+	hasOld, hasNew, err := images(record, &old, &new)
+	if err != nil || !hasOld || !hasNew {
+		return nil, err
+	}
+
+	// 退会（deletedAtを設定する）は停止ではない
+	if old.IsActive && !new.IsActive && new.DeletedAt == nil {
+		return []Event{UserSuspended{
+			Meta:   meta,
+			Uid:    new.Uid,
+			Reason: new.ModerationReason,
+			Until:  until(record.Dynamodb.NewImage),
+		}}, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,115 @@
+// RecruitsとEndUsersのストリームの変更を型付きのイベントに変換し、ハンドラーに渡す
+//
+// APIは書き込みのみ行い、メール送信などの副作用はworkerのハンドラーで行う。
+// 同じイベントが2回以上渡される場合があるため（少なくとも1回）、ハンドラーは重複に耐えるようにする
+package events
+
+import (
+	"time"
+)
+
+// イベントの種類
+const (
+	TypeBoardCreated   = "BoardCreated"
+	TypeMemberJoined   = "MemberJoined"
+	TypeBoardFull      = "BoardFull"
+	TypeBoardClosed    = "BoardClosed"
+	TypeBoardSuspended = "BoardSuspended"
+	TypeUserSuspended  = "UserSuspended"
+)
+
+type Event interface {
+	Type() string
+	// 元になったストリームのレコード
+	Metadata() Meta
+}
+
+// ストリームのレコードのID（重複の判定に使う）と変更日時
+type Meta struct {
+	ID string    `json:"id"`
+	At time.Time `json:"at"`
+}
+
+func (m Meta) Metadata() Meta {
+	return m
+}
+
+// ボードの作成
+type BoardCreated struct {
+	Meta
+	RecruitId   int    `json:"recruitId"`
+	MasterId    string `json:"masterId"`
+	Title       string `json:"title"`
+	TotalMember int    `json:"totalMember"`
+}
+
+func (BoardCreated) Type() string { return TypeBoardCreated }
+
+// ボードへの参加（Membersは参加後の人数）
+type MemberJoined struct {
+	Meta
+	RecruitId   int    `json:"recruitId"`
+	MasterId    string `json:"masterId"`
+	Uid         string `json:"uid"`
+	Position    string `json:"position"`
+	Members     int    `json:"members"`
+	TotalMember int    `json:"totalMember"`
+}
+
+func (MemberJoined) Type() string { return TypeMemberJoined }
+
+// 参加で定員に達した
+type BoardFull struct {
+	Meta
+	RecruitId   int    `json:"recruitId"`
+	MasterId    string `json:"masterId"`
+	Members     int    `json:"members"`
+	TotalMember int    `json:"totalMember"`
+}
+
+func (BoardFull) Type() string { return TypeBoardFull }
+
+// ボードの募集の終了の理由
+const (
+	// 作成者が削除した
+	ClosedByDelete = "deleted"
+	// 作成者が退会した
+	ClosedByOwnerLeft = "ownerLeft"
+)
+
+// 作成者の削除・退会による募集の終了
+type BoardClosed struct {
+	Meta
+	RecruitId int    `json:"recruitId"`
+	MasterId  string `json:"masterId"`
+	Reason    string `json:"reason"`
+}
+
+func (BoardClosed) Type() string { return TypeBoardClosed }
+
+// 管理者・作成者の停止によるボードの停止（Untilは期限が無い場合nil）
+type BoardSuspended struct {
+	Meta
+	RecruitId int        `json:"recruitId"`
+	MasterId  string     `json:"masterId"`
+	Reason    string     `json:"reason,omitempty"`
+	Until     *time.Time `json:"until,omitempty"`
+}
+
+func (BoardSuspended) Type() string { return TypeBoardSuspended }
+
+// ユーザーの停止（退会は含まない）
+type UserSuspended struct {
+	Meta
+	Uid    string     `json:"uid"`
+	Reason string     `json:"reason,omitempty"`
+	Until  *time.Time `json:"until,omitempty"`
+}
+
+func (UserSuspended) Type() string { return TypeUserSuspended }
+
+// イベントを処理するハンドラー（エラーを返すと再試行する）
+type Handler interface {
+	Name() string
+	Handle(e Event) error
+}
@@ -0,0 +1,189 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/hew-team1/all-api-dev/common"
+	"github.com/hew-team1/all-api-dev/recruit"
+	"github.com/hew-team1/all-api-dev/webhook"
+)
+
+// namesのハンドラーを作る（名前はcommon.EventHandlerNames）
+//
+// 検索のインデックスなどを追加する場合は、Handlerを実装してここに名前を追加する
+func NewHandlers(names []string, db *dynamodb.DynamoDB, tables common.Tables, recruits *recruit.Server, hooks *webhook.Hooks) ([]Handler, error) {
+	processed := &processedLog{db: db, table: tables.IdempotencyKeys}
+	handlers := make([]Handler, 0, len(names))
+	for _, name := range names {
+		switch name {
+		case "mail":
+			handlers = append(handlers, &MailHandler{recruits: recruits, processed: processed})
+		case "stats":
+			handlers = append(handlers, &StatsHandler{db: db, tables: tables, processed: processed})
+		case "webhook":
+			handlers = append(handlers, &WebhookHandler{hooks: hooks})
+		case "log":
+			handlers = append(handlers, LogHandler{})
+		default:
+			return nil, fmt.Errorf("unknown handler %q", name)
+		}
+	}
+	return handlers, nil
+}
+
+// ==================== mail ====================
+// 参加時に募集者と参加者にメールを送る（MemberAddが送っていたメール）
+//
+// 宛先ごとに送信済みを記録し、再試行や同じイベントの再配送では送っていない宛先にのみ送る
+type MailHandler struct {
+	recruits  *recruit.Server
+	processed *processedLog
+}
+
+func (h *MailHandler) Name() string { return "mail" }
+
+func (h *MailHandler) Handle(e Event) error {
+	joined, ok := e.(MemberJoined)
+	if !ok {
+		return nil
+	}
+	id := strconv.Itoa(joined.RecruitId)
+
+	// 募集者にメール送信
+	if err := h.send(processedKey(h.Name(), e, "owner"), func() (*recruit.MailInfo, error) {
+		return h.recruits.RecruitMailInfo(id, joined.Position)
+	}); err != nil {
+		return fmt.Errorf("recruit mail: %v", err)
+	}
+
+	// 参加者にメール送信
+	if err := h.send(processedKey(h.Name(), e, "member"), func() (*recruit.MailInfo, error) {
+		return h.recruits.JoinMailInfo(joined.Uid, joined.Position, id)
+	}); err != nil {
+		return fmt.Errorf("join mail: %v", err)
+	}
+	return nil
+}
+
+// keyが送信済みでなければ送る（失敗した場合は記録を取り消す）
+func (h *MailHandler) send(key string, info func() (*recruit.MailInfo, error)) error {
+	claimed, err := h.processed.claim(key)
+	if err != nil || !claimed {
+		return err
+	}
+	mail, err := info()
+	if err == nil {
+		err = h.recruits.MailSend(mail)
+	}
+	if err != nil {
+		if rerr := h.processed.release(key); rerr != nil {
+			fmt.Println("Got error releasing", key)
+			fmt.Println(rerr.Error())
+		}
+		return err
+	}
+	return nil
+}
+
+// ==================== stats ====================
+// 管理画面の統計の日別の停止数（common.StatUsersSuspendedOn・common.StatRecruitsSuspendedOn）
+//
+// 処理済みの記録とカウンターを1つのトランザクションで書き込み、同じイベントを2回数えない
+type StatsHandler struct {
+	db        *dynamodb.DynamoDB
+	tables    common.Tables
+	processed *processedLog
+}
+
+func (h *StatsHandler) Name() string { return "stats" }
+
+func (h *StatsHandler) Handle(e Event) error {
+	date := statDate(e.Metadata().At)
+	var key string
+	switch e.(type) {
+	case BoardSuspended:
+		key = common.StatRecruitsSuspendedOn + date
+	case UserSuspended:
+		key = common.StatUsersSuspendedOn + date
+	default:
+		return nil
+	}
+	items := []*dynamodb.TransactWriteItem{
+		h.processed.put(processedKey(h.Name(), e, e.Type())),
+		common.StatUpdate(h.tables.AtomicCounter, key, 1),
+	}
+	_, err := h.db.TransactWriteItems(&dynamodb.TransactWriteItemsInput{TransactItems: items})
+	if failed, ok := common.CanceledItems(err, len(items)); ok && failed[0] {
+		// 数え済み
+		return nil
+	}
+	return err
+}
+
+// 変更日時の日付（日本時間、無い場合は今日）
+func statDate(t time.Time) string {
+	if t.IsZero() {
+		t = time.Now()
+	}
+	return common.StatDate(t)
+}
+
+// ==================== webhook ====================
+// ボードのイベントを、ボードと作成者のユーザーに登録されたWebhookに送る
+type WebhookHandler struct {
+	hooks *webhook.Hooks
+}
+
+func (h *WebhookHandler) Name() string { return "webhook" }
+
+func (h *WebhookHandler) Handle(e Event) error {
+	var recruitId int
+	var masterId string
+	switch ev := e.(type) {
+	case MemberJoined:
+		recruitId, masterId = ev.RecruitId, ev.MasterId
+	case BoardFull:
+		recruitId, masterId = ev.RecruitId, ev.MasterId
+	case BoardClosed:
+		recruitId, masterId = ev.RecruitId, ev.MasterId
+	default:
+		return nil
+	}
+
+	hooks, err := h.hooks.Subscribers(recruitId, masterId, e.Type())
+	if err != nil {
+		return err
+	}
+	// 送信先ごとに再送するため、失敗しても他の送信先やイベント全体は再試行しない（結果は送信結果に残る）
+	for i := range hooks {
+		d, err := h.hooks.Deliver(&hooks[i], e.Type(), e.Metadata().ID, e)
+		if err != nil {
+			fmt.Println("Got error delivering webhook", hooks[i].Id)
+			fmt.Println(err.Error())
+			continue
+		}
+		if !d.Success {
+			fmt.Printf("webhook %s failed after %d attempts: %s\n", hooks[i].Id, d.Attempts, d.Error)
+		}
+	}
+	return nil
+}
+
+// ==================== log ====================
+// イベントをJSONで表示する（ローカル開発の確認用）
+type LogHandler struct{}
+
+func (LogHandler) Name() string { return "log" }
+
+func (LogHandler) Handle(e Event) error {
+	j, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	fmt.Println(e.Type(), string(j))
+	return nil
+}
@@ -0,0 +1,69 @@
+package events
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// 処理済みの記録を残す期間（ストリームのレコードは24時間で消えるため、それより長くする）
+const processedTTL = 7 * 24 * time.Hour
+
+// 処理済みのイベントの記録
+//
+// APIの冪等キーと同じIdempotencyKeysに "event <ハンドラー> <レコードのID> <処理>" のキーで保存し、TTLで削除する
+// （APIのキーは "<メソッド> <パス> <キー>" のため重ならない）
+type processedLog struct {
+	db    *dynamodb.DynamoDB
+	table string
+}
+
+func processedKey(handler string, e Event, part string) string {
+	return "event " + handler + " " + e.Metadata().ID + " " + part
+}
+
+// keyを処理済みとして登録するPut（登録済みの場合は取り消される）
+func (p *processedLog) put(key string) *dynamodb.TransactWriteItem {
+	return &dynamodb.TransactWriteItem{
+		Put: &dynamodb.Put{
+			TableName: aws.String(p.table),
+			Item: map[string]*dynamodb.AttributeValue{
+				"idempotencyKey": {S: aws.String(key)},
+				"expiresAt":      {N: aws.String(strconv.FormatInt(time.Now().Add(processedTTL).Unix(), 10))},
+			},
+			ConditionExpression: aws.String("attribute_not_exists(#key)"),
+			ExpressionAttributeNames: map[string]*string{
+				"#key": aws.String("idempotencyKey"),
+			},
+		},
+	}
+}
+
+// keyを処理済みとして登録する（登録済みの場合はfalse）
+func (p *processedLog) claim(key string) (bool, error) {
+	put := p.put(key).Put
+	_, err := p.db.PutItem(&dynamodb.PutItemInput{
+		TableName:                put.TableName,
+		Item:                     put.Item,
+		ConditionExpression:      put.ConditionExpression,
+		ExpressionAttributeNames: put.ExpressionAttributeNames,
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// 処理に失敗したkeyの登録を取り消す（再試行で処理し直せるようにする）
+func (p *processedLog) release(key string) error {
+	_, err := p.db.DeleteItem(&dynamodb.DeleteItemInput{
+		TableName: aws.String(p.table),
+		Key: map[string]*dynamodb.AttributeValue{
+			"idempotencyKey": {S: aws.String(key)},
+		},
+	})
+	return err
+}
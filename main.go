@@ -0,0 +1,369 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodbstreams"
+	"github.com/aws/aws-sdk-go/service/ses"
+	"github.com/gorilla/mux"
+	adminuser "github.com/hew-team1/all-api-dev/admin/end_user"
+	adminrecruit "github.com/hew-team1/all-api-dev/admin/recruit"
+	"github.com/hew-team1/all-api-dev/backup"
+	"github.com/hew-team1/all-api-dev/common"
+	"github.com/hew-team1/all-api-dev/connpass"
+	enduser "github.com/hew-team1/all-api-dev/end_user"
+	"github.com/hew-team1/all-api-dev/events"
+	"github.com/hew-team1/all-api-dev/migrate"
+	"github.com/hew-team1/all-api-dev/recruit"
+	"github.com/hew-team1/all-api-dev/seed"
+	"github.com/hew-team1/all-api-dev/webhook"
+)
+
+// 1つのサーバーに登録できるルートのまとまり（名前はdocker-composeのサービス名）
+type service struct {
+	name  string
+	mount func(r *mux.Router, cfg *common.Config) error
+	// 画像をアップロードするサービス（ローカル保存の場合は /images/ も配信する）
+	images bool
+}
+
+var services = []service{
+	{"end_user", enduser.Mount, true},
+	{"recruit", recruit.Mount, true},
+	{"connpass", connpass.Mount, false},
+	{"admin_end_user", adminuser.Mount, false},
+	{"admin_recruit", adminrecruit.Mount, false},
+}
+
+func serviceNames() []string {
+	names := make([]string, 0, len(services))
+	for _, svc := range services {
+		names = append(names, svc.name)
+	}
+	return names
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: app <command> [flags]")
+	fmt.Fprintln(os.Stderr, "")
+	fmt.Fprintln(os.Stderr, "commands:")
+	fmt.Fprintln(os.Stderr, "  serve    APIサーバーを起動する")
+	fmt.Fprintln(os.Stderr, "  migrate  テーブルを作成し、未適用の移行を行う")
+	fmt.Fprintln(os.Stderr, "  seed     ローカル開発用のデータを生成して登録する")
+	fmt.Fprintln(os.Stderr, "  backup   テーブルをJSONLファイルに書き出す")
+	fmt.Fprintln(os.Stderr, "  restore  backupのファイルをテーブルに書き込む")
+	fmt.Fprintln(os.Stderr, "  worker   テーブルの変更を読み、メール送信などのハンドラーを実行する")
+}
+
+func main() {
+	// 引数が無い場合は全てのサービスを起動する
+	args := os.Args[1:]
+	if len(args) == 0 {
+		args = []string{"serve"}
+	}
+
+	switch args[0] {
+	case "serve":
+		serve(args[1:])
+	case "migrate":
+		migrateCmd(args[1:])
+	case "seed":
+		seedCmd(args[1:])
+	case "backup":
+		backupCmd(args[1:])
+	case "restore":
+		restoreCmd(args[1:])
+	case "worker":
+		workerCmd(args[1:])
+	default:
+		usage()
+		os.Exit(2)
+	}
+}
+
+func configFlag(fs *flag.FlagSet) *string {
+	return fs.String("config", os.Getenv("CONFIG_FILE"), "設定ファイル（YAML）")
+}
+
+// 設定に誤りがある場合は起動しない
+func mustLoadConfig(path string) *common.Config {
+	cfg, err := common.LoadConfig(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return cfg
+}
+
+func mustDynamoDB(cfg *common.Config) *dynamodb.DynamoDB {
+	sess, err := cfg.Session(cfg.Endpoints.DB)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return dynamodb.New(sess)
+}
+
+// ==================== serve ====================
+func serve(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	names := fs.String("services", "all", "起動するサービス（カンマ区切り） : all, "+strings.Join(serviceNames(), ", "))
+	addr := fs.String("addr", "", "待ち受けアドレス（省略時は1つのサービスなら設定の addrs の値、複数なら :8080）")
+	configFile := configFlag(fs)
+	fs.Parse(args)
+
+	cfg := mustLoadConfig(*configFile)
+
+	selected := []service{}
+	if *names == "all" {
+		selected = services
+	} else {
+		for _, name := range strings.Split(*names, ",") {
+			found := false
+			for _, svc := range services {
+				if svc.name == strings.TrimSpace(name) {
+					selected = append(selected, svc)
+					found = true
+					break
+				}
+			}
+			if !found {
+				log.Fatalf("unknown service %q (available: %s)", name, strings.Join(serviceNames(), ", "))
+			}
+		}
+	}
+
+	r := mux.NewRouter()
+	images := false
+	for _, svc := range selected {
+		if err := svc.mount(r, cfg); err != nil {
+			log.Fatalf("%s: %v", svc.name, err)
+		}
+		images = images || svc.images
+	}
+	// 画像の配信は複数のサービスを起動しても1回だけ登録する
+	if images {
+		if err := mountImages(r, cfg); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *addr == "" {
+		*addr = ":8080"
+		if len(selected) == 1 {
+			*addr = cfg.Addrs[selected[0].name]
+		}
+	}
+
+	fmt.Printf("サーバー起動 : %s で受信 (%s)\n", *addr, *names)
+
+	// log.Fatal は、異常を検知すると処理の実行を止めてくれる
+	log.Fatal(http.ListenAndServe(*addr, common.CORS(r)))
+}
+
+// ローカル保存の場合は保存した画像を /images/ で配信する
+func mountImages(r *mux.Router, cfg *common.Config) error {
+	blob, err := common.NewBlobStore(cfg)
+	if err != nil {
+		return err
+	}
+	if local, ok := blob.(*common.LocalBlobStore); ok {
+		r.PathPrefix("/images/").Handler(http.StripPrefix("/images/", local.Handler()))
+	}
+	return nil
+}
+
+// ==================== migrate ====================
+func migrateCmd(args []string) {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	status := fs.Bool("status", false, "適用状況を表示するのみ")
+	to := fs.Int("to", 0, "このバージョンまで適用する（0の場合は全て）")
+	configFile := configFlag(fs)
+	fs.Parse(args)
+
+	cfg := mustLoadConfig(*configFile)
+	m := migrate.NewMigrator(mustDynamoDB(cfg), cfg)
+
+	if *status {
+		if err := m.Status(migrate.Migrations); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	count, err := m.Up(migrate.Migrations, *to)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("migrate: %d applied\n", count)
+}
+
+// ==================== seed ====================
+func seedCmd(args []string) {
+	fs := flag.NewFlagSet("seed", flag.ExitOnError)
+	opts := seed.Options{}
+	fs.Int64Var(&opts.Seed, "seed", 1, "乱数のシード（同じ値からは同じデータが生成される）")
+	fs.IntVar(&opts.Users, "users", 100, "ユーザー数")
+	fs.IntVar(&opts.Recruits, "recruits", 30, "ボード数")
+	fs.IntVar(&opts.Events, "events", 20, "イベント数")
+	base := fs.String("base", "", "日付の基準日 2006-01-02（省略時は今日）")
+	workers := fs.Int("workers", 8, "並列に書き込む数")
+	eventsFile := fs.String("events-file", "", "イベントをconnpassのAPIと同じ形で書き込むファイル")
+	dryRun := fs.Bool("dry-run", false, "登録せずに生成したデータをJSONで表示する")
+	configFile := configFlag(fs)
+	fs.Parse(args)
+
+	jst := time.FixedZone("Asia/Tokyo", 9*60*60)
+	opts.Base = time.Now().In(jst)
+	if *base != "" {
+		t, err := time.ParseInLocation("2006-01-02", *base, jst)
+		if err != nil {
+			log.Fatal("base must be formatted as 2006-01-02")
+		}
+		opts.Base = t
+	}
+	data := seed.Generate(opts)
+
+	if *eventsFile != "" {
+		if err := seed.WriteEvents(*eventsFile, data.Events); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println("seed: events", len(data.Events), "->", *eventsFile)
+	}
+	if *dryRun {
+		j, _ := json.MarshalIndent(data, "", "  ")
+		fmt.Println(string(j))
+		return
+	}
+
+	cfg := mustLoadConfig(*configFile)
+	if err := seed.NewLoader(mustDynamoDB(cfg), cfg, *workers).Load(data); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// ==================== backup / restore ====================
+// 対象のテーブル（設定ファイルのキーのカンマ区切り）
+func tablesFlag(fs *flag.FlagSet) *string {
+	return fs.String("tables", "", "対象のテーブル（endUsers,recruits など、省略時は全て）")
+}
+
+func splitTables(s string) []string {
+	keys := []string{}
+	for _, key := range strings.Split(s, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func printResults(command string, results []backup.Result) {
+	for _, r := range results {
+		if r.Skipped {
+			fmt.Printf("%s: %-18s %s skipped\n", command, r.Table, r.Name)
+			continue
+		}
+		fmt.Printf("%s: %-18s %s %d items\n", command, r.Table, r.Name, r.Count)
+	}
+}
+
+func backupCmd(args []string) {
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	dir := fs.String("dir", "", "書き出し先のディレクトリ（省略時は backups/<日時>）")
+	tables := tablesFlag(fs)
+	workers := fs.Int("workers", 4, "並列にScanするセグメント数")
+	configFile := configFlag(fs)
+	fs.Parse(args)
+
+	if *dir == "" {
+		*dir = "backups/" + time.Now().In(time.FixedZone("Asia/Tokyo", 9*60*60)).Format("20060102-150405")
+	}
+	cfg := mustLoadConfig(*configFile)
+	results, err := backup.NewArchiver(mustDynamoDB(cfg), cfg, *workers).Backup(*dir, splitTables(*tables))
+	printResults("backup", results)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("backup:", *dir)
+}
+
+func restoreCmd(args []string) {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	dir := fs.String("dir", "", "backupで書き出したディレクトリ（必須）")
+	tables := tablesFlag(fs)
+	workers := fs.Int("workers", 4, "並列に書き込む数")
+	configFile := configFlag(fs)
+	fs.Parse(args)
+
+	if *dir == "" {
+		log.Fatal("restore: -dir is required")
+	}
+	cfg := mustLoadConfig(*configFile)
+	results, err := backup.NewArchiver(mustDynamoDB(cfg), cfg, *workers).Restore(*dir, splitTables(*tables))
+	printResults("restore", results)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// ==================== worker ====================
+func workerCmd(args []string) {
+	fs := flag.NewFlagSet("worker", flag.ExitOnError)
+	handlers := fs.String("handlers", "", "実行するハンドラー（カンマ区切り : "+strings.Join(common.EventHandlerNames, ", ")+"、省略時は設定の events.handlers）")
+	once := fs.Bool("once", false, "1回だけ読み込んで終了する")
+	configFile := configFlag(fs)
+	fs.Parse(args)
+
+	cfg := mustLoadConfig(*configFile)
+	if *handlers != "" {
+		cfg.Events.Handlers = nil
+		for _, name := range strings.Split(*handlers, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				cfg.Events.Handlers = append(cfg.Events.Handlers, name)
+			}
+		}
+		if err := cfg.Validate(); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	sess, err := cfg.Session(cfg.Endpoints.SES)
+	if err != nil {
+		log.Fatal(err)
+	}
+	mail := ses.New(sess)
+	sess, err = cfg.Session(cfg.Endpoints.DB)
+	if err != nil {
+		log.Fatal(err)
+	}
+	db := dynamodb.New(sess)
+
+	if cfg.Events.Enabled("mail") && !cfg.Mail.ViaWorker {
+		// RecruitAPIもメールを送るため、参加時のメールが2通になる
+		log.Println("warning: the mail handler is enabled but MAIL_VIA_WORKER is not set, the recruit API also sends join mails")
+	}
+
+	// メールと統計はRecruitAPIと同じ処理を使う（画像は扱わない）
+	list, err := events.NewHandlers(cfg.Events.Handlers, db, cfg.Tables, recruit.NewServer(db, mail, nil, cfg), webhook.New(db, cfg))
+	if err != nil {
+		log.Fatal(err)
+	}
+	consumer := events.NewConsumer(db, dynamodbstreams.New(sess), cfg, list)
+
+	if *once {
+		n, err := consumer.Poll()
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("worker: %d records\n", n)
+		return
+	}
+	fmt.Printf("worker: %s (%ds)\n", strings.Join(cfg.Events.Handlers, ", "), cfg.Events.PollSeconds)
+	consumer.Run(nil)
+}
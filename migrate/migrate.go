@@ -0,0 +1,414 @@
+// テーブルの作成とデータの移行
+//
+// テーブル・GSI・TTL・初期データはmigrations.goにバージョンごとに定義し、
+// 適用済みのバージョンはSchemaMigrationsに記録する。
+// 各バージョンは何度実行しても同じ結果になるように書く
+package migrate
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/hew-team1/all-api-dev/common"
+)
+
+// 1つのバージョンの移行
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(m *Migrator) error
+}
+
+// SchemaMigrationsの項目
+type Applied struct {
+	Version int
+	Name    string
+	Applied string
+}
+
+type Migrator struct {
+	db     *dynamodb.DynamoDB
+	cfg    *common.Config
+	tables common.Tables
+}
+
+func NewMigrator(db *dynamodb.DynamoDB, cfg *common.Config) *Migrator {
+	return &Migrator{
+		db:     db,
+		cfg:    cfg,
+		tables: cfg.Tables,
+	}
+}
+
+// ==================== Table ====================
+// テーブルの定義（課金はオンデマンド）
+type Table struct {
+	Name string
+	// パーティションキーと型（S・N）
+	HashKey  string
+	HashType string
+	// ソートキーと型（空の場合はパーティションキーのみ）
+	RangeKey  string
+	RangeType string
+	Indexes   []Index
+	// TTLに使う項目（空の場合はTTLを使わない）
+	TTL string
+}
+
+// GSIの定義（全ての項目を射影する）
+type Index struct {
+	Name      string
+	HashKey   string
+	HashType  string
+	RangeKey  string
+	RangeType string
+}
+
+// パーティションキーとソートキーのKeySchema
+func keySchema(hashKey, rangeKey string) []*dynamodb.KeySchemaElement {
+	schema := []*dynamodb.KeySchemaElement{
+		{AttributeName: aws.String(hashKey), KeyType: aws.String(dynamodb.KeyTypeHash)},
+	}
+	if rangeKey != "" {
+		schema = append(schema, &dynamodb.KeySchemaElement{
+			AttributeName: aws.String(rangeKey), KeyType: aws.String(dynamodb.KeyTypeRange),
+		})
+	}
+	return schema
+}
+
+// KeySchemaに使う項目の型
+func (i Index) attributes(attrs map[string]string) {
+	attrs[i.HashKey] = i.HashType
+	if i.RangeKey != "" {
+		attrs[i.RangeKey] = i.RangeType
+	}
+}
+
+// テーブル・GSI・TTLが無ければ作成し、使える状態になるまで待つ
+func (m *Migrator) EnsureTable(t Table) error {
+	desc, err := m.describe(t.Name)
+	if err != nil {
+		return err
+	}
+	if desc == nil {
+		if err := m.createTable(t); err != nil {
+			return err
+		}
+		fmt.Println("  created table", t.Name)
+	} else {
+		// 後から追加したGSIのみ作成する
+		existing := map[string]bool{}
+		for _, gsi := range desc.GlobalSecondaryIndexes {
+			existing[aws.StringValue(gsi.IndexName)] = true
+		}
+		for _, index := range t.Indexes {
+			if existing[index.Name] {
+				continue
+			}
+			if err := m.createIndex(t.Name, index); err != nil {
+				return err
+			}
+			fmt.Println("  created index", t.Name+"."+index.Name)
+		}
+	}
+	if err := m.waitActive(t.Name); err != nil {
+		return err
+	}
+
+	if t.TTL != "" {
+		return m.ensureTTL(t.Name, t.TTL)
+	}
+	return nil
+}
+
+// テーブルの情報（存在しない場合はnil）
+func (m *Migrator) describe(name string) (*dynamodb.TableDescription, error) {
+	result, err := m.db.DescribeTable(&dynamodb.DescribeTableInput{
+		TableName: aws.String(name),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeResourceNotFoundException {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return result.Table, nil
+}
+
+func (m *Migrator) createTable(t Table) error {
+	attrs := map[string]string{}
+	Index{HashKey: t.HashKey, HashType: t.HashType, RangeKey: t.RangeKey, RangeType: t.RangeType}.attributes(attrs)
+	param := &dynamodb.CreateTableInput{
+		TableName:   aws.String(t.Name),
+		BillingMode: aws.String(dynamodb.BillingModePayPerRequest),
+		KeySchema:   keySchema(t.HashKey, t.RangeKey),
+	}
+	for _, index := range t.Indexes {
+		index.attributes(attrs)
+		param.GlobalSecondaryIndexes = append(param.GlobalSecondaryIndexes, &dynamodb.GlobalSecondaryIndex{
+			IndexName:  aws.String(index.Name),
+			KeySchema:  keySchema(index.HashKey, index.RangeKey),
+			Projection: &dynamodb.Projection{ProjectionType: aws.String(dynamodb.ProjectionTypeAll)},
+		})
+	}
+	param.AttributeDefinitions = attributeDefinitions(attrs)
+
+	_, err := m.db.CreateTable(param)
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeResourceInUseException {
+		// 他のmigrateが同時に作成した
+		return nil
+	}
+	return err
+}
+
+func (m *Migrator) createIndex(table string, index Index) error {
+	attrs := map[string]string{}
+	index.attributes(attrs)
+	_, err := m.db.UpdateTable(&dynamodb.UpdateTableInput{
+		TableName:            aws.String(table),
+		AttributeDefinitions: attributeDefinitions(attrs),
+		GlobalSecondaryIndexUpdates: []*dynamodb.GlobalSecondaryIndexUpdate{
+			{
+				Create: &dynamodb.CreateGlobalSecondaryIndexAction{
+					IndexName:  aws.String(index.Name),
+					KeySchema:  keySchema(index.HashKey, index.RangeKey),
+					Projection: &dynamodb.Projection{ProjectionType: aws.String(dynamodb.ProjectionTypeAll)},
+				},
+			},
+		},
+	})
+	return err
+}
+
+// 名前順のAttributeDefinitions
+func attributeDefinitions(attrs map[string]string) []*dynamodb.AttributeDefinition {
+	names := make([]string, 0, len(attrs))
+	for name := range attrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	defs := make([]*dynamodb.AttributeDefinition, 0, len(names))
+	for _, name := range names {
+		defs = append(defs, &dynamodb.AttributeDefinition{
+			AttributeName: aws.String(name),
+			AttributeType: aws.String(attrs[name]),
+		})
+	}
+	return defs
+}
+
+// テーブルとGSIがACTIVEになるまで待つ
+func (m *Migrator) waitActive(name string) error {
+	for i := 0; i < 300; i++ {
+		desc, err := m.describe(name)
+		if err != nil {
+			return err
+		}
+		active := desc != nil && aws.StringValue(desc.TableStatus) == dynamodb.TableStatusActive
+		if active {
+			for _, gsi := range desc.GlobalSecondaryIndexes {
+				if aws.StringValue(gsi.IndexStatus) != dynamodb.IndexStatusActive {
+					active = false
+				}
+			}
+		}
+		if active {
+			return nil
+		}
+		time.Sleep(time.Second)
+	}
+	return fmt.Errorf("%s did not become active", name)
+}
+
+func (m *Migrator) ensureTTL(table, attr string) error {
+	result, err := m.db.DescribeTimeToLive(&dynamodb.DescribeTimeToLiveInput{
+		TableName: aws.String(table),
+	})
+	if err != nil {
+		return err
+	}
+	if desc := result.TimeToLiveDescription; desc != nil {
+		status := aws.StringValue(desc.TimeToLiveStatus)
+		if status == dynamodb.TimeToLiveStatusEnabled || status == dynamodb.TimeToLiveStatusEnabling {
+			if aws.StringValue(desc.AttributeName) != attr {
+				return fmt.Errorf("%s: TTL is already enabled on %s", table, aws.StringValue(desc.AttributeName))
+			}
+			return nil
+		}
+	}
+
+	_, err = m.db.UpdateTimeToLive(&dynamodb.UpdateTimeToLiveInput{
+		TableName: aws.String(table),
+		TimeToLiveSpecification: &dynamodb.TimeToLiveSpecification{
+			AttributeName: aws.String(attr),
+			Enabled:       aws.Bool(true),
+		},
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Println("  enabled TTL", table+"."+attr)
+	return nil
+}
+
+// テーブルのストリームが無ければviewTypeで有効にする
+func (m *Migrator) ensureStream(table, viewType string) error {
+	desc, err := m.describe(table)
+	if err != nil {
+		return err
+	}
+	if desc == nil {
+		return fmt.Errorf("%s does not exist", table)
+	}
+	if spec := desc.StreamSpecification; spec != nil && aws.BoolValue(spec.StreamEnabled) {
+		if aws.StringValue(spec.StreamViewType) != viewType {
+			return fmt.Errorf("%s: stream is already enabled with %s", table, aws.StringValue(spec.StreamViewType))
+		}
+		return nil
+	}
+
+	_, err = m.db.UpdateTable(&dynamodb.UpdateTableInput{
+		TableName: aws.String(table),
+		StreamSpecification: &dynamodb.StreamSpecification{
+			StreamEnabled:  aws.Bool(true),
+			StreamViewType: aws.String(viewType),
+		},
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Println("  enabled stream", table, viewType)
+	return m.waitActive(table)
+}
+
+// ==================== Data ====================
+// keyの項目が無ければitemを登録する（既存の項目は変更しない）
+func (m *Migrator) PutIfAbsent(table, key string, item map[string]*dynamodb.AttributeValue) error {
+	_, err := m.db.PutItem(&dynamodb.PutItemInput{
+		TableName:           aws.String(table),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(#key)"),
+		ExpressionAttributeNames: map[string]*string{
+			"#key": aws.String(key),
+		},
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return nil
+	}
+	return err
+}
+
+// paramの結果を1件ずつfnに渡す（項目の形が変わった場合の移行に使う）
+func (m *Migrator) Backfill(param *dynamodb.ScanInput, fn func(item map[string]*dynamodb.AttributeValue) error) (int, error) {
+	count := 0
+	var fnErr error
+	err := m.db.ScanPages(param, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+		for _, item := range page.Items {
+			if fnErr = fn(item); fnErr != nil {
+				return false
+			}
+			count++
+		}
+		return true
+	})
+	if err == nil {
+		err = fnErr
+	}
+	return count, err
+}
+
+// ==================== Versions ====================
+func (m *Migrator) schemaTable() Table {
+	return Table{
+		Name:     m.tables.SchemaMigrations,
+		HashKey:  "version",
+		HashType: dynamodb.ScalarAttributeTypeN,
+	}
+}
+
+// 適用済みのバージョン
+func (m *Migrator) Applied() (map[int]Applied, error) {
+	applied := map[int]Applied{}
+	_, err := m.Backfill(&dynamodb.ScanInput{
+		TableName: aws.String(m.tables.SchemaMigrations),
+	}, func(item map[string]*dynamodb.AttributeValue) error {
+		var a Applied
+		a.Version, _ = strconv.Atoi(aws.StringValue(item["version"].N))
+		if item["name"] != nil {
+			a.Name = aws.StringValue(item["name"].S)
+		}
+		if item["applied"] != nil {
+			a.Applied = aws.StringValue(item["applied"].S)
+		}
+		applied[a.Version] = a
+		return nil
+	})
+	return applied, err
+}
+
+func (m *Migrator) record(migration Migration) error {
+	nowTime := time.Now().UTC().In(
+		time.FixedZone("Asia/Tokyo", 9*60*60),
+	).Format("2006-01-02 15:04")
+
+	return m.PutIfAbsent(m.tables.SchemaMigrations, "version", map[string]*dynamodb.AttributeValue{
+		"version": {N: aws.String(strconv.Itoa(migration.Version))},
+		"name":    {S: aws.String(migration.Name)},
+		"applied": {S: aws.String(nowTime)},
+	})
+}
+
+// to以下（0の場合は全て）の未適用のバージョンを順に適用し、適用した数を返す
+func (m *Migrator) Up(migrations []Migration, to int) (int, error) {
+	if err := m.EnsureTable(m.schemaTable()); err != nil {
+		return 0, err
+	}
+	applied, err := m.Applied()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, migration := range migrations {
+		if to > 0 && migration.Version > to {
+			break
+		}
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+		fmt.Printf("migrate: %d %s\n", migration.Version, migration.Name)
+		if err := migration.Up(m); err != nil {
+			return count, fmt.Errorf("%d %s: %v", migration.Version, migration.Name, err)
+		}
+		if err := m.record(migration); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// 各バージョンの適用状況を表示する
+func (m *Migrator) Status(migrations []Migration) error {
+	if err := m.EnsureTable(m.schemaTable()); err != nil {
+		return err
+	}
+	applied, err := m.Applied()
+	if err != nil {
+		return err
+	}
+	for _, migration := range migrations {
+		status := "pending"
+		if a, ok := applied[migration.Version]; ok {
+			status = "applied " + a.Applied
+		}
+		fmt.Printf("%4d  %-28s %s\n", migration.Version, migration.Name, status)
+	}
+	return nil
+}
@@ -0,0 +1,439 @@
+package migrate
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/hew-team1/all-api-dev/common"
+	enduser "github.com/hew-team1/all-api-dev/end_user"
+	"github.com/hew-team1/all-api-dev/recruit"
+)
+
+// 全てのバージョン（追加のみ行い、適用済みのバージョンは変更しない）
+var Migrations = []Migration{
+	{1, "create_core_tables", createCoreTables},
+	{2, "create_sessions", createSessions},
+	{3, "create_user_emails", createUserEmails},
+	{4, "create_idempotency_keys", createIdempotencyKeys},
+	{5, "create_reports", createReports},
+	{6, "create_impersonations", createImpersonations},
+	{7, "rebuild_stats", rebuildStats},
+	{8, "create_recruit_owners", createRecruitOwners},
+	{9, "create_memberships", createMemberships},
+	{10, "enable_recruit_purge", enableRecruitPurge},
+	{11, "enable_change_streams", enableChangeStreams},
+	{12, "create_webhooks", createWebhooks},
+}
+
+// EndUsers・Recruits・AtomicCounterと、Recruitsの連番のカウンター
+func createCoreTables(m *Migrator) error {
+	for _, t := range []Table{
+		{Name: m.tables.EndUsers, HashKey: "uid", HashType: dynamodb.ScalarAttributeTypeS},
+		{Name: m.tables.Recruits, HashKey: "id", HashType: dynamodb.ScalarAttributeTypeN},
+		{Name: m.tables.AtomicCounter, HashKey: "countKey", HashType: dynamodb.ScalarAttributeTypeS},
+	} {
+		if err := m.EnsureTable(t); err != nil {
+			return err
+		}
+	}
+
+	// 既にボードがある場合は最大のidから数える
+	maxId := 0
+	_, err := m.Backfill(&dynamodb.ScanInput{
+		TableName:            aws.String(m.tables.Recruits),
+		ProjectionExpression: aws.String("#id"),
+		ExpressionAttributeNames: map[string]*string{
+			"#id": aws.String("id"),
+		},
+	}, func(item map[string]*dynamodb.AttributeValue) error {
+		if id, _ := strconv.Atoi(aws.StringValue(item["id"].N)); id > maxId {
+			maxId = id
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return m.PutIfAbsent(m.tables.AtomicCounter, "countKey", map[string]*dynamodb.AttributeValue{
+		"countKey":    {S: aws.String(recruit.RecruitCountKey)},
+		"countNumber": {N: aws.String(strconv.Itoa(maxId))},
+	})
+}
+
+// ログインセッション（uidごとの一覧用のGSIと有効期限）
+func createSessions(m *Migrator) error {
+	return m.EnsureTable(Table{
+		Name:     m.tables.Sessions,
+		HashKey:  "sessionId",
+		HashType: dynamodb.ScalarAttributeTypeS,
+		Indexes: []Index{
+			{Name: "uid-index", HashKey: "uid", HashType: dynamodb.ScalarAttributeTypeS},
+		},
+		TTL: "expiresAt",
+	})
+}
+
+// メールアドレスの使用者と、登録済みのユーザーのメールアドレスの移行
+func createUserEmails(m *Migrator) error {
+	if err := m.EnsureTable(Table{
+		Name:     m.tables.UserEmails,
+		HashKey:  "email",
+		HashType: dynamodb.ScalarAttributeTypeS,
+	}); err != nil {
+		return err
+	}
+
+	conflicts := 0
+	count, err := m.Backfill(&dynamodb.ScanInput{
+		TableName:            aws.String(m.tables.EndUsers),
+		ProjectionExpression: aws.String("#uid, #email, #deleted"),
+		FilterExpression:     aws.String("attribute_exists(#email) AND attribute_not_exists(#deleted)"),
+		ExpressionAttributeNames: map[string]*string{
+			"#uid":     aws.String("uid"),
+			"#email":   aws.String("email"),
+			"#deleted": aws.String("deletedAt"),
+		},
+	}, func(item map[string]*dynamodb.AttributeValue) error {
+		uid := aws.StringValue(item["uid"].S)
+		email := enduser.NormalizeEmail(aws.StringValue(item["email"].S))
+		if email == "" {
+			return nil
+		}
+		_, err := m.db.PutItem(&dynamodb.PutItemInput{
+			TableName: aws.String(m.tables.UserEmails),
+			Item: map[string]*dynamodb.AttributeValue{
+				"email": {S: aws.String(email)},
+				"uid":   {S: aws.String(uid)},
+			},
+			ConditionExpression: aws.String("attribute_not_exists(#email) OR #uid = :uid"),
+			ExpressionAttributeNames: map[string]*string{
+				"#email": aws.String("email"),
+				"#uid":   aws.String("uid"),
+			},
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":uid": {S: aws.String(uid)},
+			},
+		})
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			// 同じメールアドレスのユーザーが複数いる場合は先のユーザーのみ登録し、手動で対応する
+			fmt.Println("  duplicate email", email, "uid", uid)
+			conflicts++
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("  backfilled %d emails (%d duplicates)\n", count-conflicts, conflicts)
+	return nil
+}
+
+// 登録・更新の再送の結果（有効期限あり）
+func createIdempotencyKeys(m *Migrator) error {
+	return m.EnsureTable(Table{
+		Name:     m.tables.IdempotencyKeys,
+		HashKey:  "idempotencyKey",
+		HashType: dynamodb.ScalarAttributeTypeS,
+		TTL:      "expiresAt",
+	})
+}
+
+// 通報
+func createReports(m *Migrator) error {
+	return m.EnsureTable(Table{
+		Name:     m.tables.Reports,
+		HashKey:  "id",
+		HashType: dynamodb.ScalarAttributeTypeS,
+	})
+}
+
+// 管理者のなりすましトークン（有効期限あり）
+func createImpersonations(m *Migrator) error {
+	return m.EnsureTable(Table{
+		Name:     m.tables.Impersonations,
+		HashKey:  "id",
+		HashType: dynamodb.ScalarAttributeTypeS,
+		TTL:      "expiresAt",
+	})
+}
+
+// 統計のカウンターを既存のデータから数え直す
+//
+// 管理画面の数え直し（adminuser.RebuildStats）は後から変わるため、作成時の数え方をここに固定する
+// （カウンターのキーはAPIと同じcommonの定数を使う）
+// （参加数とメールの送信数は元のデータが無いため数え直さない）
+func rebuildStats(m *Migrator) error {
+	counts := map[string]int{
+		common.StatUsers: 0, common.StatUsersSuspended: 0, common.StatUsersDeleted: 0,
+		common.StatRecruits: 0, common.StatRecruitsOff: 0, common.StatRecruitsClosed: 0, common.StatRecruitsCapacity: 0, common.StatRecruitsMembers: 0,
+	}
+	for _, p := range common.StatPositions {
+		counts[common.StatPosition+p] = 0
+	}
+	// isActiveが無い項目は公開中として扱う
+	inactive := func(item map[string]*dynamodb.AttributeValue) bool {
+		return item["isActive"] != nil && !aws.BoolValue(item["isActive"].BOOL)
+	}
+	createdDate := func(item map[string]*dynamodb.AttributeValue) string {
+		if item["created"] == nil {
+			return ""
+		}
+		if created := aws.StringValue(item["created"].S); len(created) >= 10 {
+			return created[:10]
+		}
+		return ""
+	}
+
+	_, err := m.Backfill(&dynamodb.ScanInput{
+		TableName:            aws.String(m.tables.EndUsers),
+		ProjectionExpression: aws.String("#A, #deleted, #created"),
+		ExpressionAttributeNames: map[string]*string{
+			"#A":       aws.String("isActive"),
+			"#deleted": aws.String("deletedAt"),
+			"#created": aws.String("created"),
+		},
+	}, func(item map[string]*dynamodb.AttributeValue) error {
+		if item["deletedAt"] != nil {
+			counts[common.StatUsersDeleted]++
+			return nil
+		}
+		counts[common.StatUsers]++
+		if inactive(item) {
+			counts[common.StatUsersSuspended]++
+		}
+		if date := createdDate(item); date != "" {
+			counts[common.StatUsersNew+date]++
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = m.Backfill(&dynamodb.ScanInput{
+		TableName:            aws.String(m.tables.Recruits),
+		ProjectionExpression: aws.String("#A, #closed, #created, #total, #members"),
+		ExpressionAttributeNames: map[string]*string{
+			"#A":       aws.String("isActive"),
+			"#closed":  aws.String("closed"),
+			"#created": aws.String("created"),
+			"#total":   aws.String("totalMember"),
+			"#members": aws.String("members"),
+		},
+	}, func(item map[string]*dynamodb.AttributeValue) error {
+		counts[common.StatRecruits]++
+		if inactive(item) {
+			counts[common.StatRecruitsOff]++
+		}
+		if item["closed"] != nil {
+			counts[common.StatRecruitsClosed]++
+		}
+		if date := createdDate(item); date != "" {
+			counts[common.StatRecruitsNew+date]++
+		}
+		if item["totalMember"] != nil {
+			capacity, _ := strconv.Atoi(aws.StringValue(item["totalMember"].S))
+			counts[common.StatRecruitsCapacity] += capacity
+		}
+		if item["members"] != nil {
+			for _, member := range item["members"].L {
+				counts[common.StatRecruitsMembers]++
+				position := ""
+				if member.M != nil && member.M["position"] != nil {
+					position = aws.StringValue(member.M["position"].S)
+				}
+				counts[common.PositionStat(position)]++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for key, n := range counts {
+		_, err := m.db.PutItem(&dynamodb.PutItemInput{
+			TableName: aws.String(m.tables.AtomicCounter),
+			Item: map[string]*dynamodb.AttributeValue{
+				"countKey":    {S: aws.String("stats:" + key)},
+				"countNumber": {N: aws.String(strconv.Itoa(n))},
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	fmt.Printf("  rebuilt %d counters\n", len(counts))
+	return nil
+}
+
+// ボードの作成者（uidごとの一覧用のGSI）と、登録済みのボードの作成者の移行
+func createRecruitOwners(m *Migrator) error {
+	if err := m.EnsureTable(Table{
+		Name:     m.tables.RecruitOwners,
+		HashKey:  "recruitId",
+		HashType: dynamodb.ScalarAttributeTypeN,
+		Indexes: []Index{
+			{Name: "uid-index", HashKey: "uid", HashType: dynamodb.ScalarAttributeTypeS},
+		},
+	}); err != nil {
+		return err
+	}
+
+	count, err := m.Backfill(&dynamodb.ScanInput{
+		TableName:            aws.String(m.tables.Recruits),
+		ProjectionExpression: aws.String("#id, #master, #created"),
+		FilterExpression:     aws.String("attribute_exists(#master)"),
+		ExpressionAttributeNames: map[string]*string{
+			"#id":      aws.String("id"),
+			"#master":  aws.String("masterId"),
+			"#created": aws.String("created"),
+		},
+	}, func(item map[string]*dynamodb.AttributeValue) error {
+		owner := map[string]*dynamodb.AttributeValue{
+			"recruitId": item["id"],
+			"uid":       item["masterId"],
+		}
+		if item["created"] != nil {
+			owner["created"] = item["created"]
+		}
+		_, err := m.db.PutItem(&dynamodb.PutItemInput{
+			TableName: aws.String(m.tables.RecruitOwners),
+			Item:      owner,
+		})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("  backfilled %d owners\n", count)
+	return nil
+}
+
+// ボードの参加者（uidごとの一覧用のGSI）と、登録済みのボードのmembersの移行
+//
+// 移行したメンバーの参加日時は分からないため、募集者のみボードの作成日時を入れる
+func createMemberships(m *Migrator) error {
+	if err := m.EnsureTable(Table{
+		Name:      m.tables.Memberships,
+		HashKey:   "recruitId",
+		HashType:  dynamodb.ScalarAttributeTypeN,
+		RangeKey:  "uid",
+		RangeType: dynamodb.ScalarAttributeTypeS,
+		Indexes: []Index{
+			{
+				Name:      "uid-index",
+				HashKey:   "uid",
+				HashType:  dynamodb.ScalarAttributeTypeS,
+				RangeKey:  "recruitId",
+				RangeType: dynamodb.ScalarAttributeTypeN,
+			},
+		},
+	}); err != nil {
+		return err
+	}
+
+	count := 0
+	_, err := m.Backfill(&dynamodb.ScanInput{
+		TableName:            aws.String(m.tables.Recruits),
+		ProjectionExpression: aws.String("#id, #master, #members, #created"),
+		ExpressionAttributeNames: map[string]*string{
+			"#id":      aws.String("id"),
+			"#master":  aws.String("masterId"),
+			"#members": aws.String("members"),
+			"#created": aws.String("created"),
+		},
+	}, func(item map[string]*dynamodb.AttributeValue) error {
+		if item["members"] == nil {
+			return nil
+		}
+		master := ""
+		if item["masterId"] != nil {
+			master = aws.StringValue(item["masterId"].S)
+		}
+		for _, member := range item["members"].L {
+			if member.M == nil || member.M["uid"] == nil {
+				continue
+			}
+			uid := aws.StringValue(member.M["uid"].S)
+			if uid == "" || uid == common.DeletedUserUid {
+				continue
+			}
+			membership := map[string]*dynamodb.AttributeValue{
+				"recruitId": item["id"],
+				"uid":       {S: aws.String(uid)},
+			}
+			if member.M["position"] != nil {
+				membership["position"] = member.M["position"]
+			}
+			if uid == master && item["created"] != nil {
+				membership["joinedAt"] = item["created"]
+			}
+			// 同じユーザーが複数回入っている場合は最初のポジションのみ
+			if err := m.PutIfAbsent(m.tables.Memberships, "uid", membership); err != nil {
+				return err
+			}
+			count++
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("  backfilled %d memberships\n", count)
+	return nil
+}
+
+// 削除したボードと、その作成者・参加者の項目をpurgeAtを過ぎたらTTLで削除する
+func enableRecruitPurge(m *Migrator) error {
+	for _, table := range []string{m.tables.Recruits, m.tables.RecruitOwners, m.tables.Memberships} {
+		if err := m.ensureTTL(table, "purgeAt"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// workerが読むRecruits・EndUsersのストリームと、シャードごとの読み終えた位置
+func enableChangeStreams(m *Migrator) error {
+	if err := m.EnsureTable(Table{
+		Name:     m.tables.StreamCheckpoints,
+		HashKey:  "shardId",
+		HashType: dynamodb.ScalarAttributeTypeS,
+	}); err != nil {
+		return err
+	}
+	for _, table := range []string{m.tables.Recruits, m.tables.EndUsers} {
+		if err := m.ensureStream(table, dynamodb.StreamViewTypeNewAndOldImages); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Webhookの登録（作成者ごとの一覧と、送信先を探すボード・ユーザーごとのGSI）と送信結果（有効期限あり）
+func createWebhooks(m *Migrator) error {
+	if err := m.EnsureTable(Table{
+		Name:     m.tables.Webhooks,
+		HashKey:  "id",
+		HashType: dynamodb.ScalarAttributeTypeS,
+		Indexes: []Index{
+			{Name: "uid-index", HashKey: "uid", HashType: dynamodb.ScalarAttributeTypeS},
+			{Name: "scope-index", HashKey: "scope", HashType: dynamodb.ScalarAttributeTypeS},
+		},
+	}); err != nil {
+		return err
+	}
+	return m.EnsureTable(Table{
+		Name:      m.tables.WebhookDeliveries,
+		HashKey:   "webhookId",
+		HashType:  dynamodb.ScalarAttributeTypeS,
+		RangeKey:  "deliveryId",
+		RangeType: dynamodb.ScalarAttributeTypeS,
+		TTL:       "expiresAt",
+	})
+}
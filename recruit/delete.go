@@ -0,0 +1,202 @@
+package recruit
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/gorilla/mux"
+	"github.com/hew-team1/all-api-dev/common"
+)
+
+// ==================== Delete ====================
+// 募集者による削除（isActiveの停止とは別に deletedAt・deletedBy を記録し、purgeAtを過ぎるとTTLで削除される）
+type RecruitDeleteResponse struct {
+	Id        int    `json:"id"`
+	DeletedAt string `json:"deletedAt"`
+	PurgeAt   string `json:"purgeAt"`
+}
+
+func (s *Server) RecruitDelete(w http.ResponseWriter, r *http.Request) {
+	now := time.Now().UTC().In(
+		time.FixedZone("Asia/Tokyo", 9*60*60),
+	)
+	nowTime := now.Format("2006-01-02 15:04")
+
+	vars := mux.Vars(r)
+	uid := r.Header.Get("uid")
+	if uid == "" {
+		common.WriteError(w, http.StatusUnauthorized, "uid header is required")
+		return
+	}
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		common.WriteError(w, http.StatusBadRequest, "id must be a number")
+		return
+	}
+	if err := s.CheckActiveUser(uid); err != nil {
+		WriteUserCheckError(w, err)
+		return
+	}
+	expected, checkVersion, err := common.IfMatch(r)
+	if err != nil {
+		common.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	current, err := s.recruitForUpdate(vars["id"])
+	if err != nil {
+		common.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if current == nil || current.DeletedAt != nil {
+		common.WriteError(w, http.StatusNotFound, "recruit not found")
+		return
+	}
+	if aws.StringValue(current.MasterId) != uid {
+		common.WriteError(w, http.StatusForbidden, "only the recruit owner can delete the recruit")
+		return
+	}
+	if checkVersion && current.Version != expected {
+		common.WriteError(w, http.StatusPreconditionFailed, errVersionConflict.Error())
+		return
+	}
+
+	// 停止中のボードも削除できる（isActiveは変更しないため、復元すると停止中に戻る）
+	purgeAt := now.Add(s.retention)
+	names := map[string]*string{
+		"#id":      aws.String("id"),
+		"#deleted": aws.String("deletedAt"),
+		"#by":      aws.String("deletedBy"),
+		"#purge":   aws.String("purgeAt"),
+		"#updated": aws.String("updated"),
+	}
+	values := map[string]*dynamodb.AttributeValue{
+		":deleted": {S: aws.String(nowTime)},
+		":by":      {S: aws.String(uid)},
+		":purge":   {N: aws.String(strconv.FormatInt(purgeAt.Unix(), 10))},
+	}
+	expr := "set #deleted = :deleted, #by = :by, #purge = :purge, #updated = :deleted " + common.VersionIncrement(names, values)
+	cond := "attribute_exists(#id) AND attribute_not_exists(#deleted) AND " + common.VersionCondition(current.Version, names, values)
+
+	// ボードと作成者の項目は1つのトランザクションで削除済みにする
+	items := []*dynamodb.TransactWriteItem{
+		{
+			Update: &dynamodb.Update{
+				TableName: aws.String(s.tables.Recruits),
+				Key: map[string]*dynamodb.AttributeValue{
+					"id": {
+						N: aws.String(vars["id"]),
+					},
+				},
+				ConditionExpression:       aws.String(cond),
+				UpdateExpression:          aws.String(expr),
+				ExpressionAttributeNames:  names,
+				ExpressionAttributeValues: values,
+			},
+		},
+		{
+			Update: &dynamodb.Update{
+				TableName: aws.String(s.tables.RecruitOwners),
+				Key: map[string]*dynamodb.AttributeValue{
+					"recruitId": {
+						N: aws.String(vars["id"]),
+					},
+				},
+				UpdateExpression: aws.String("set #purge = :purge"),
+				ExpressionAttributeNames: map[string]*string{
+					"#purge": aws.String("purgeAt"),
+				},
+				ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+					":purge": values[":purge"],
+				},
+			},
+		},
+	}
+	_, err = s.db.TransactWriteItems(&dynamodb.TransactWriteItemsInput{TransactItems: items})
+	if failed, ok := common.CanceledItems(err, len(items)); ok && failed[0] {
+		common.WriteError(w, http.StatusPreconditionFailed, errVersionConflict.Error())
+		return
+	}
+	if err != nil {
+		fmt.Println("Got error calling TransactWriteItems:")
+		fmt.Println(err.Error())
+		common.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.AddStats(recruitStats(current, -1))
+
+	// 参加者の項目は人数に上限が無いため、トランザクションの後に1件ずつ更新する
+	if err := s.setMembershipsPurgeAt(id, purgeAt); err != nil {
+		fmt.Println("Got error updating memberships:")
+		fmt.Println(err.Error())
+	}
+
+	res := RecruitDeleteResponse{
+		Id:        id,
+		DeletedAt: nowTime,
+		PurgeAt:   purgeAt.Format("2006-01-02 15:04"),
+	}
+	j, _ := json.Marshal(res)
+	w.Write(j)
+
+	// 削除のログ
+	fmt.Println(string(j))
+}
+
+// idのボードのMembershipsの項目にpurgeAtを設定する
+func (s *Server) setMembershipsPurgeAt(id int, purgeAt time.Time) error {
+	var uids []string
+	err := s.db.QueryPages(&dynamodb.QueryInput{
+		TableName:              aws.String(s.tables.Memberships),
+		KeyConditionExpression: aws.String("#id = :id"),
+		ProjectionExpression:   aws.String("#uid"),
+		ExpressionAttributeNames: map[string]*string{
+			"#id":  aws.String("recruitId"),
+			"#uid": aws.String("uid"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":id": {N: aws.String(strconv.Itoa(id))},
+		},
+	}, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+		for _, item := range page.Items {
+			uids = append(uids, aws.StringValue(item["uid"].S))
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, uid := range uids {
+		_, err := s.db.UpdateItem(&dynamodb.UpdateItemInput{
+			TableName: aws.String(s.tables.Memberships),
+			Key: map[string]*dynamodb.AttributeValue{
+				"recruitId": {N: aws.String(strconv.Itoa(id))},
+				"uid":       {S: aws.String(uid)},
+			},
+			ConditionExpression: aws.String("attribute_exists(#uid)"),
+			UpdateExpression:    aws.String("set #purge = :purge"),
+			ExpressionAttributeNames: map[string]*string{
+				"#uid":   aws.String("uid"),
+				"#purge": aws.String("purgeAt"),
+			},
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":purge": {N: aws.String(strconv.FormatInt(purgeAt.Unix(), 10))},
+			},
+		})
+		if err != nil {
+			// 退会などで既に削除された項目は飛ばす
+			if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+				continue
+			}
+			return err
+		}
+	}
+	return nil
+}
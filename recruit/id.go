@@ -0,0 +1,131 @@
+package recruit
+
+import (
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/hew-team1/all-api-dev/common"
+)
+
+// ==================== ID ====================
+// ボードのidの採番
+//
+// idは数値のまま払い出す（テーブルのキーはN型で、/quest_bord/{id} などのURLにも使われているため）。
+// 登録時に同じidのボードが無いことを確認し、重なった場合は次のidで登録し直す
+type IDGenerator interface {
+	NextID() (int, error)
+}
+
+// 設定の方法（recruitIds.strategy）の採番
+func NewIDGenerator(db *dynamodb.DynamoDB, cfg *common.Config) IDGenerator {
+	if cfg.RecruitIDs.Strategy == "time" {
+		return NewTimeIDGenerator()
+	}
+	return NewCounterIDGenerator(db, cfg.Tables.AtomicCounter, RecruitCountKey, cfg.RecruitIDs.BlockSize)
+}
+
+// Recruitsの連番のカウンターのキー（テーブル名の接頭辞に関わらず同じ）
+const RecruitCountKey = "Recruits"
+
+// AtomicCounterの連番（sizeが1より大きい場合はsize件ずつ確保し、確保した分はこのインスタンスのみで使う）
+//
+// カウンターの行への書き込みがsize分の1になる代わりに、インスタンスをまたぐと作成順とidの順が前後し、
+// 再起動時に残った分は欠番になる
+type CounterIDGenerator struct {
+	db    *dynamodb.DynamoDB
+	table string
+	key   string
+	size  int
+
+	mu sync.Mutex
+	// 確保済みで未使用のid（next〜last）
+	next int
+	last int
+}
+
+func NewCounterIDGenerator(db *dynamodb.DynamoDB, table, key string, size int) *CounterIDGenerator {
+	if size < 1 {
+		size = 1
+	}
+	return &CounterIDGenerator{
+		db:    db,
+		table: table,
+		key:   key,
+		size:  size,
+	}
+}
+
+func (g *CounterIDGenerator) NextID() (int, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.next == 0 || g.next > g.last {
+		last, err := ReserveIDs(g.db, g.table, g.key, g.size)
+		if err != nil {
+			return 0, err
+		}
+		g.next = last - g.size + 1
+		g.last = last
+	}
+	id := g.next
+	g.next++
+	return id, nil
+}
+
+// カウンターをn進め、確保したn件の最後の番号を返す
+func ReserveIDs(db *dynamodb.DynamoDB, table, key string, n int) (int, error) {
+	result, err := db.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName: aws.String(table),
+		Key: map[string]*dynamodb.AttributeValue{
+			"countKey": {S: aws.String(key)},
+		},
+		UpdateExpression: aws.String("add #col :n"),
+		ExpressionAttributeNames: map[string]*string{
+			"#col": aws.String("countNumber"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":n": {N: aws.String(strconv.Itoa(n))},
+		},
+		ReturnValues: aws.String("UPDATED_NEW"),
+	})
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(aws.StringValue(result.Attributes["countNumber"].N))
+}
+
+// 作成日時順の数値のid（2021-01-01からのミリ秒 × 1024 + 乱数）
+//
+// カウンターの行に書き込まず、JavaScriptで正確に扱える2^53未満に収まる（2290年頃まで）。
+// 連番のidより必ず大きいため、既存のボードを残したまま切り替えられる（counterには戻さない）
+type TimeIDGenerator struct {
+	mu   sync.Mutex
+	rand *rand.Rand
+	last int
+}
+
+var idEpoch = time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func NewTimeIDGenerator() *TimeIDGenerator {
+	return &TimeIDGenerator{
+		rand: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+func (g *TimeIDGenerator) NextID() (int, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	ms := int(time.Since(idEpoch) / time.Millisecond)
+	id := ms<<10 | g.rand.Intn(1<<10)
+	// 同じインスタンスでは必ず増える
+	if id <= g.last {
+		id = g.last + 1
+	}
+	g.last = id
+	return id, nil
+}
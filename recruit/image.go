@@ -0,0 +1,184 @@
+package recruit
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/gorilla/mux"
+	"github.com/hew-team1/all-api-dev/common"
+)
+
+// ==================== Image Upload ====================
+type RecruitImageUploadResponse struct {
+	ImageUrl          *string `json:"imageUrl,omitempty"`
+	ImageThumbnailUrl *string `json:"imageThumbnailUrl,omitempty"`
+}
+
+// 画像の差し替えに必要なボードの項目
+type RecruitImageOwner struct {
+	MasterId          *string `dynamodbav:"masterId,omitempty"`
+	ImageKey          *string `dynamodbav:"imageKey,omitempty"`
+	ImageThumbnailKey *string `dynamodbav:"imageThumbnailKey,omitempty"`
+	DeletedAt         *string `dynamodbav:"deletedAt,omitempty"`
+	Version           int     `dynamodbav:"version"`
+}
+
+func (s *Server) RecruitImageUpload(w http.ResponseWriter, r *http.Request) {
+	nowTime := time.Now().UTC().In(
+		time.FixedZone("Asia/Tokyo", 9*60*60),
+	).Format("2006-01-02 15:04")
+
+	vars := mux.Vars(r)
+	uid := r.Header.Get("uid")
+	if uid == "" {
+		common.WriteError(w, http.StatusUnauthorized, "uid header is required")
+		return
+	}
+	if _, err := strconv.Atoi(vars["id"]); err != nil {
+		common.WriteError(w, http.StatusBadRequest, "id must be a number")
+		return
+	}
+	if err := s.CheckActiveUser(uid); err != nil {
+		WriteUserCheckError(w, err)
+		return
+	}
+
+	result, err := s.db.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String(s.tables.Recruits),
+		Key: map[string]*dynamodb.AttributeValue{
+			"id": {
+				N: aws.String(vars["id"]),
+			},
+		},
+	})
+	if err != nil {
+		common.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	var owner RecruitImageOwner
+	dynamodbattribute.UnmarshalMap(result.Item, &owner)
+	if result.Item == nil || owner.DeletedAt != nil {
+		common.WriteError(w, http.StatusNotFound, "recruit not found")
+		return
+	}
+	// 画像を変更できるのは募集者のみ
+	if aws.StringValue(owner.MasterId) != uid {
+		common.WriteError(w, http.StatusForbidden, "only the recruit owner can upload an image")
+		return
+	}
+	// If-Matchがある場合は、GETした後に変更されていれば差し替えない
+	version, checkVersion, err := common.IfMatch(r)
+	if err != nil {
+		common.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if checkVersion && version != owner.Version {
+		common.WriteError(w, http.StatusPreconditionFailed, errVersionConflict.Error())
+		return
+	}
+
+	body, status, err := common.ReadUploadedImage(w, r)
+	if err != nil {
+		common.WriteError(w, status, err.Error())
+		return
+	}
+	img, err := common.ProcessImage(body)
+	if err != nil {
+		common.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	prefix := "recruits/" + vars["id"] + "/" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	key := prefix + "." + img.Ext
+	thumbKey := prefix + "_thumb." + img.Ext
+	imageUrl, err := s.blob.Put(key, img.Original, img.ContentType)
+	if err != nil {
+		common.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	thumbUrl, err := s.blob.Put(thumbKey, img.Thumbnail, img.ContentType)
+	if err != nil {
+		s.blob.Delete(key)
+		common.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	names := map[string]*string{
+		"#id":       aws.String("id"),
+		"#deleted":  aws.String("deletedAt"),
+		"#url":      aws.String("imageUrl"),
+		"#thumbUrl": aws.String("imageThumbnailUrl"),
+		"#key":      aws.String("imageKey"),
+		"#thumbKey": aws.String("imageThumbnailKey"),
+		"#updated":  aws.String("updated"),
+	}
+	values := map[string]*dynamodb.AttributeValue{
+		":url":      {S: aws.String(imageUrl)},
+		":thumbUrl": {S: aws.String(thumbUrl)},
+		":key":      {S: aws.String(key)},
+		":thumbKey": {S: aws.String(thumbKey)},
+		":updated":  {S: aws.String(nowTime)},
+	}
+	cond := "attribute_exists(#id) AND attribute_not_exists(#deleted)"
+	if checkVersion {
+		cond += " AND " + common.VersionCondition(version, names, values)
+	}
+	_, err = s.db.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName: aws.String(s.tables.Recruits),
+		Key: map[string]*dynamodb.AttributeValue{
+			"id": {
+				N: aws.String(vars["id"]),
+			},
+		},
+		ConditionExpression: aws.String(cond),
+		UpdateExpression: aws.String(
+			"set #url = :url, #thumbUrl = :thumbUrl, #key = :key, #thumbKey = :thumbKey, #updated = :updated " +
+				common.VersionIncrement(names, values),
+		),
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
+	})
+	if err != nil {
+		s.blob.Delete(key)
+		s.blob.Delete(thumbKey)
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			if checkVersion {
+				common.WriteError(w, http.StatusPreconditionFailed, errVersionConflict.Error())
+				return
+			}
+			common.WriteError(w, http.StatusNotFound, "recruit not found")
+			return
+		}
+		common.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// 以前の画像を削除
+	for _, old := range []*string{owner.ImageKey, owner.ImageThumbnailKey} {
+		if old == nil {
+			continue
+		}
+		if err := s.blob.Delete(*old); err != nil {
+			fmt.Println("Got error deleting blob:")
+			fmt.Println(err.Error())
+		}
+	}
+
+	res := RecruitImageUploadResponse{
+		ImageUrl:          &imageUrl,
+		ImageThumbnailUrl: &thumbUrl,
+	}
+	j, _ := json.Marshal(res)
+	w.WriteHeader(http.StatusCreated)
+	w.Write(j)
+
+	// 保存先のログ
+	fmt.Println(string(j))
+}
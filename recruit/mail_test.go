@@ -0,0 +1,61 @@
+package recruit
+
+import (
+	"testing"
+
+	"github.com/hew-team1/all-api-dev/common"
+	"github.com/hew-team1/all-api-dev/common/dynamotest"
+	"github.com/hew-team1/all-api-dev/common/profiletest"
+)
+
+func TestMailInfoNotFound(t *testing.T) {
+	cfg := common.DefaultConfig()
+	db := dynamotest.New()
+	defer db.Close()
+	db.Table(cfg.Tables.EndUsers, "uid")
+	db.Table(cfg.Tables.Recruits, "id")
+
+	db.Put(cfg.Tables.EndUsers, profiletest.StoredUser("owner"))
+	db.Put(cfg.Tables.EndUsers, map[string]interface{}{"uid": "noemail", "name": "no email"})
+	db.Put(cfg.Tables.Recruits, map[string]interface{}{
+		"id":       1,
+		"masterId": "owner",
+		"title":    "hackathon",
+		"eventDay": "2021-01-01",
+		"day":      "2",
+		"slackUrl": "https://example.com/slack",
+	})
+	db.Put(cfg.Tables.Recruits, map[string]interface{}{"id": 2, "masterId": "deleted", "title": "orphan"})
+
+	s := NewServer(db.Client(), nil, nil, cfg)
+	tests := []struct {
+		name    string
+		info    func() (*MailInfo, error)
+		wantErr bool
+	}{
+		{"recruit mail", func() (*MailInfo, error) { return s.RecruitMailInfo("1", "backend") }, false},
+		{"recruit mail without recruit", func() (*MailInfo, error) { return s.RecruitMailInfo("9", "backend") }, true},
+		{"recruit mail without master", func() (*MailInfo, error) { return s.RecruitMailInfo("2", "backend") }, true},
+		{"join mail", func() (*MailInfo, error) { return s.JoinMailInfo("owner", "backend", "1") }, false},
+		{"join mail without recruit", func() (*MailInfo, error) { return s.JoinMailInfo("owner", "backend", "9") }, true},
+		{"join mail without user", func() (*MailInfo, error) { return s.JoinMailInfo("missing", "backend", "1") }, true},
+		{"join mail without email", func() (*MailInfo, error) { return s.JoinMailInfo("noemail", "backend", "1") }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := tt.info()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %+v, want error", info)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Recipient != "owner@example.com" {
+				t.Errorf("recipient = %q", info.Recipient)
+			}
+		})
+	}
+}
@@ -1,122 +1,101 @@
-package main
+package recruit
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
-	"io"
-	"log"
 	"net/http"
-	"os"
 	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/awserr"
-	"github.com/aws/aws-sdk-go/aws/credentials"
-	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
 	"github.com/aws/aws-sdk-go/service/ses"
 	"github.com/gorilla/mux"
-	"github.com/rs/cors"
+	"github.com/hew-team1/all-api-dev/common"
+	"github.com/hew-team1/all-api-dev/webhook"
 )
 
-func main() {
-	var cfgs aws.Config
-
-	cfgs.Region = aws.String(os.Getenv("REGION"))
-	cfgs.Endpoint = aws.String(os.Getenv("ENDPOINT_SES"))
-	cfgs.Credentials = credentials.NewStaticCredentials(os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY"), "")
-
-	sess, _ := session.NewSession(&cfgs)
+// RecruitAPIのルートをrに登録する
+func Mount(r *mux.Router, cfg *common.Config) error {
+	sess, err := cfg.Session(cfg.Endpoints.SES)
+	if err != nil {
+		return err
+	}
 	ses := ses.New(sess)
 
-	cfgs.Endpoint = aws.String(os.Getenv("ENDPOINT_DB"))
-	sess, _ = session.NewSession(&cfgs)
+	sess, err = cfg.Session(cfg.Endpoints.DB)
+	if err != nil {
+		return err
+	}
 	db := dynamodb.New(sess)
 
-	server := NewServer(db, ses)
+	blob, err := common.NewBlobStore(cfg)
+	if err != nil {
+		return err
+	}
+	server := NewServer(db, ses, blob, cfg)
+	if cfg.Mail.ViaWorker {
+		// workerが動いていないと参加時のメールが送られない
+		fmt.Println("warning: MAIL_VIA_WORKER is set, join mails are sent only by the worker's mail handler")
+	}
 
-	r := mux.NewRouter()
 	r.HandleFunc("/recruits", server.RecruitAllGet).Methods("GET")
 	r.HandleFunc("/recruits", server.RecruitCreate).Methods("POST")
 	r.HandleFunc("/recruits/{id}", server.RecruitGet).Methods("GET")
+	r.HandleFunc("/recruits/{id}", server.RecruitUpdate).Methods("PATCH")
+	r.HandleFunc("/recruits/{id}", server.RecruitDelete).Methods("DELETE")
 	r.HandleFunc("/recruits/{id}/members", server.MemberAdd).Methods("PUT")
-	c := cors.New(cors.Options{
-		AllowedOrigins: []string{"*"},
-		AllowedHeaders: []string{"*"},
-		AllowedMethods: []string{
-			http.MethodHead,
-			http.MethodGet,
-			http.MethodPost,
-			http.MethodPatch,
-			http.MethodPut,
-			http.MethodDelete,
-		},
-	}).Handler(r)
-
-	fmt.Println("サーバー起動 :80 port で受信")
-
-	// log.Fatal は、異常を検知すると処理の実行を止めてくれる
-	log.Fatal(http.ListenAndServe(":80", c))
-}
-
-// io.Readerをbyteのスライスに変換
-func StreamToByte(stream io.Reader) []byte {
-	buf := new(bytes.Buffer)
-	buf.ReadFrom(stream)
-	return buf.Bytes()
+	r.HandleFunc("/recruits/{id}/image", server.RecruitImageUpload).Methods("POST")
+	r.HandleFunc("/recruits/{id}/reports", server.RecruitReport).Methods("POST")
+	r.HandleFunc("/webhooks", server.WebhookAllGet).Methods("GET")
+	r.HandleFunc("/webhooks", server.WebhookCreate).Methods("POST")
+	r.HandleFunc("/webhooks/{id}", server.WebhookDelete).Methods("DELETE")
+	r.HandleFunc("/webhooks/{id}/test", server.WebhookTest).Methods("POST")
+	r.HandleFunc("/webhooks/{id}/deliveries", server.WebhookDeliveryAllGet).Methods("GET")
+	return nil
 }
 
-func NewServer(db *dynamodb.DynamoDB, ses *ses.SES) *Server {
+func NewServer(db *dynamodb.DynamoDB, ses *ses.SES, blob common.BlobStore, cfg *common.Config) *Server {
 	return &Server{
-		db:  db,
-		ses: ses,
+		db:            db,
+		ses:           ses,
+		blob:          blob,
+		tables:        cfg.Tables,
+		ids:           NewIDGenerator(db, cfg),
+		mail:          cfg.Mail,
+		publicBaseURL: strings.TrimRight(cfg.PublicBaseURL, "/"),
+		retention:     time.Duration(cfg.RecruitRetentionDays) * 24 * time.Hour,
+		mailByWorker:  cfg.Mail.ViaWorker,
+		hooks:         webhook.New(db, cfg),
 	}
 }
 
 type Server struct {
-	db  *dynamodb.DynamoDB
-	ses *ses.SES
+	db     *dynamodb.DynamoDB
+	ses    *ses.SES
+	blob   common.BlobStore
+	tables common.Tables
+	ids    IDGenerator
+	// 通知メールの送信元と本文のURL
+	mail          common.MailConfig
+	publicBaseURL string
+	// 削除したボードをTTLで完全に削除するまでの期間
+	retention time.Duration
+	// 参加時のメールはworkerが送る（MAIL_VIA_WORKER）
+	mailByWorker bool
+	// Webhookの登録と試験送信
+	hooks *webhook.Hooks
 }
 
 // Recruitのmembersの構造体
 type RecruitsMembers struct {
 	Uid      *string `json:"uid,omitempty" dynamodbav:"uid,omitempty"`
 	Position *string `json:"position,omitempty" dynamodbav:"position,omitempty"`
-}
-
-// ==================== Count ====================
-func (s *Server) Increment(key string) (max int) {
-	tableName := "AtomicCounter"
-	param := &dynamodb.UpdateItemInput{
-		TableName: aws.String(tableName),
-		Key: map[string]*dynamodb.AttributeValue{
-			"countKey": {
-				S: aws.String(key),
-			},
-		},
-		UpdateExpression: aws.String("add #col :incr"),
-		ExpressionAttributeNames: map[string]*string{
-			"#col": aws.String("countNumber"),
-		},
-		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
-			":incr": {
-				N: aws.String("1"),
-			},
-		},
-		ReturnValues: aws.String("UPDATED_NEW"),
-	}
-	newCnt, err := s.db.UpdateItem(param)
-	if err != nil {
-		fmt.Println("Got error calling PutItem:")
-		fmt.Println(err.Error())
-		os.Exit(1)
-	}
-	max, _ = strconv.Atoi(*newCnt.Attributes["countNumber"].N)
-	return max
+	// 停止中のユーザーか（レスポンスのみ）
+	Suspended bool `json:"suspended,omitempty" dynamodbav:"-"`
 }
 
 // sortのインターフェース
@@ -132,33 +111,37 @@ func (r AllGetType) Less(i, j int) bool {
 
 // ==================== AllGet ====================
 type RecruitAllGetResponse struct {
-	Id          *int              `json:"id,omitempty" dynamodbav:"id,omitempty"`
-	MasterId    *string           `json:"masterId,omitempty" dynamodbav:"masterId,omitempty"`
-	Title       *string           `json:"title,omitempty" dynamodbav:"title,omitempty"`
-	EventDay    *string           `json:"eventDay,omitempty" dynamodbav:"eventDay,omitempty"`
-	Day         *string           `json:"day,omitempty" dynamodbav:"day,omitempty"`
-	Organizer   *string           `json:"organizer,omitempty" dynamodbav:"organizer,omitempty"`
-	Commit      *string           `json:"commit,omitempty" dynamodbav:"commit,omitempty"`
-	Beginner    *string           `json:"beginner,omitempty" dynamodbav:"beginner,omitempty"`
-	Message     *string           `json:"message,omitempty" dynamodbav:"message,omitempty"`
-	SlackUrl    *string           `json:"slackUrl,omitempty" dynamodbav:"slackUrl,omitempty"`
-	TotalMember *string           `json:"totalMember,omitempty" dynamodbav:"totalMember,omitempty"`
-	Position    *string           `json:"position,omitempty" dynamodbav:"position,omitempty"`
-	Reword      *string           `json:"reword,omitempty" dynamodbav:"reword,omitempty"`
-	Members     []RecruitsMembers `json:"members,omitempty" dynamodbav:"members,omitempty"`
-	Created     *string           `json:"created,omitempty" dynamodbav:"created,omitempty"`
-	Updated     *string           `json:"updated,omitempty" dynamodbav:"updated,omitempty"`
+	Id                *int              `json:"id,omitempty" dynamodbav:"id,omitempty"`
+	MasterId          *string           `json:"masterId,omitempty" dynamodbav:"masterId,omitempty"`
+	Title             *string           `json:"title,omitempty" dynamodbav:"title,omitempty"`
+	EventDay          *string           `json:"eventDay,omitempty" dynamodbav:"eventDay,omitempty"`
+	Day               *string           `json:"day,omitempty" dynamodbav:"day,omitempty"`
+	Organizer         *string           `json:"organizer,omitempty" dynamodbav:"organizer,omitempty"`
+	Commit            *string           `json:"commit,omitempty" dynamodbav:"commit,omitempty"`
+	Beginner          *string           `json:"beginner,omitempty" dynamodbav:"beginner,omitempty"`
+	Message           *string           `json:"message,omitempty" dynamodbav:"message,omitempty"`
+	SlackUrl          *string           `json:"slackUrl,omitempty" dynamodbav:"slackUrl,omitempty"`
+	TotalMember       *string           `json:"totalMember,omitempty" dynamodbav:"totalMember,omitempty"`
+	Position          *string           `json:"position,omitempty" dynamodbav:"position,omitempty"`
+	Reword            *string           `json:"reword,omitempty" dynamodbav:"reword,omitempty"`
+	ImageUrl          *string           `json:"imageUrl,omitempty" dynamodbav:"imageUrl,omitempty"`
+	ImageThumbnailUrl *string           `json:"imageThumbnailUrl,omitempty" dynamodbav:"imageThumbnailUrl,omitempty"`
+	Members           []RecruitsMembers `json:"members,omitempty" dynamodbav:"members,omitempty"`
+	Created           *string           `json:"created,omitempty" dynamodbav:"created,omitempty"`
+	Updated           *string           `json:"updated,omitempty" dynamodbav:"updated,omitempty"`
+	Version           int               `json:"version" dynamodbav:"version"`
 }
 type AllGetType []RecruitAllGetResponse
 
 func (s *Server) RecruitAllGet(w http.ResponseWriter, r *http.Request) {
-	tableName := "Recruits"
+	tableName := s.tables.Recruits
 	active := true
 	param := &dynamodb.ScanInput{
 		TableName:        aws.String(tableName),
-		FilterExpression: aws.String("#A = :a"),
+		FilterExpression: aws.String("#A = :a AND attribute_not_exists(#D)"),
 		ExpressionAttributeNames: map[string]*string{
 			"#A": aws.String("isActive"),
+			"#D": aws.String("deletedAt"),
 		},
 		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
 			":a": {
@@ -168,8 +151,36 @@ func (s *Server) RecruitAllGet(w http.ResponseWriter, r *http.Request) {
 	}
 	result, _ := s.db.Scan(param)
 
-	var resRecruit = make(AllGetType, 0)
-	dynamodbattribute.UnmarshalListOfMaps(result.Items, &resRecruit)
+	var allRecruit = make(AllGetType, 0)
+	dynamodbattribute.UnmarshalListOfMaps(result.Items, &allRecruit)
+
+	// 停止中のユーザーのボードは表示せず、メンバーには印を付ける（作成者とメンバーのみ取得する）
+	uids := []string{}
+	for _, row := range allRecruit {
+		if row.MasterId != nil {
+			uids = append(uids, *row.MasterId)
+		}
+		for _, member := range row.Members {
+			if member.Uid != nil {
+				uids = append(uids, *member.Uid)
+			}
+		}
+	}
+	suspended, err := common.SuspendedUids(s.db, s.tables.EndUsers, uids)
+	if err != nil {
+		common.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	var resRecruit = make(AllGetType, 0, len(allRecruit))
+	for _, row := range allRecruit {
+		if row.MasterId != nil && suspended[*row.MasterId] {
+			continue
+		}
+		for i, member := range row.Members {
+			row.Members[i].Suspended = member.Uid != nil && suspended[*member.Uid]
+		}
+		resRecruit = append(resRecruit, row)
+	}
 	sort.Sort(resRecruit)
 	j, _ := json.Marshal(resRecruit)
 	w.Write(j)
@@ -179,36 +190,50 @@ func (s *Server) RecruitAllGet(w http.ResponseWriter, r *http.Request) {
 }
 
 // ==================== Get ====================
+// 詳細取得時のmembers（プロフィール付き）
+type RecruitGetMember struct {
+	Uid      *string               `json:"uid,omitempty" dynamodbav:"uid,omitempty"`
+	Position *string               `json:"position,omitempty" dynamodbav:"position,omitempty"`
+	Profile  *common.PublicProfile `json:"profile,omitempty" dynamodbav:"-"`
+	// 停止中のユーザーか
+	Suspended bool `json:"suspended,omitempty" dynamodbav:"-"`
+}
+
 type RecruitGetResponse struct {
-	Id          *int              `json:"id,omitempty" dynamodbav:"id,omitempty"`
-	MasterId    *string           `json:"masterId,omitempty" dynamodbav:"masterId,omitempty"`
-	Title       *string           `json:"title,omitempty" dynamodbav:"title,omitempty"`
-	EventDay    *string           `json:"eventDay,omitempty" dynamodbav:"eventDay,omitempty"`
-	Day         *string           `json:"day,omitempty" dynamodbav:"day,omitempty"`
-	Organizer   *string           `json:"organizer,omitempty" dynamodbav:"organizer,omitempty"`
-	Commit      *string           `json:"commit,omitempty" dynamodbav:"commit,omitempty"`
-	Beginner    *string           `json:"beginner,omitempty" dynamodbav:"beginner,omitempty"`
-	Message     *string           `json:"message,omitempty" dynamodbav:"message,omitempty"`
-	SlackUrl    *string           `json:"slackUrl,omitempty" dynamodbav:"slackUrl,omitempty"`
-	TotalMember *string           `json:"totalMember,omitempty" dynamodbav:"totalMember,omitempty"`
-	Position    *string           `json:"position,omitempty" dynamodbav:"position,omitempty"`
-	Reword      *string           `json:"reword,omitempty" dynamodbav:"reword,omitempty"`
-	Members     []RecruitsMembers `json:"members,omitempty" dynamodbav:"members,omitempty"`
-	Created     *string           `json:"created,omitempty" dynamodbav:"created,omitempty"`
-	Updated     *string           `json:"updated,omitempty" dynamodbav:"updated,omitempty"`
+	Id                *int               `json:"id,omitempty" dynamodbav:"id,omitempty"`
+	MasterId          *string            `json:"masterId,omitempty" dynamodbav:"masterId,omitempty"`
+	Title             *string            `json:"title,omitempty" dynamodbav:"title,omitempty"`
+	EventDay          *string            `json:"eventDay,omitempty" dynamodbav:"eventDay,omitempty"`
+	Day               *string            `json:"day,omitempty" dynamodbav:"day,omitempty"`
+	Organizer         *string            `json:"organizer,omitempty" dynamodbav:"organizer,omitempty"`
+	Commit            *string            `json:"commit,omitempty" dynamodbav:"commit,omitempty"`
+	Beginner          *string            `json:"beginner,omitempty" dynamodbav:"beginner,omitempty"`
+	Message           *string            `json:"message,omitempty" dynamodbav:"message,omitempty"`
+	SlackUrl          *string            `json:"slackUrl,omitempty" dynamodbav:"slackUrl,omitempty"`
+	TotalMember       *string            `json:"totalMember,omitempty" dynamodbav:"totalMember,omitempty"`
+	Position          *string            `json:"position,omitempty" dynamodbav:"position,omitempty"`
+	Reword            *string            `json:"reword,omitempty" dynamodbav:"reword,omitempty"`
+	ImageUrl          *string            `json:"imageUrl,omitempty" dynamodbav:"imageUrl,omitempty"`
+	ImageThumbnailUrl *string            `json:"imageThumbnailUrl,omitempty" dynamodbav:"imageThumbnailUrl,omitempty"`
+	Members           []RecruitGetMember `json:"members,omitempty" dynamodbav:"members,omitempty"`
+	Created           *string            `json:"created,omitempty" dynamodbav:"created,omitempty"`
+	Updated           *string            `json:"updated,omitempty" dynamodbav:"updated,omitempty"`
+	// 変更のたびに1増える（ETagと同じ値）
+	Version int `json:"version" dynamodbav:"version"`
 }
 
 func (s *Server) RecruitGet(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 
-	tableName := "Recruits"
+	tableName := s.tables.Recruits
 	active := true
 	param := &dynamodb.ScanInput{
 		TableName:        aws.String(tableName),
-		FilterExpression: aws.String("#I = :id AND #A = :active"),
+		FilterExpression: aws.String("#I = :id AND #A = :active AND attribute_not_exists(#D)"),
 		ExpressionAttributeNames: map[string]*string{
 			"#I": aws.String("id"),
 			"#A": aws.String("isActive"),
+			"#D": aws.String("deletedAt"),
 		},
 		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
 			":id": {
@@ -220,10 +245,51 @@ func (s *Server) RecruitGet(w http.ResponseWriter, r *http.Request) {
 		},
 	}
 	result, _ := s.db.Scan(param)
+	if result == nil || len(result.Items) == 0 {
+		common.WriteError(w, http.StatusNotFound, "recruit not found")
+		return
+	}
 
 	var resRecruit RecruitGetResponse
 	dynamodbattribute.UnmarshalMap(result.Items[0], &resRecruit)
+
+	uids := make([]string, 0, len(resRecruit.Members))
+	for _, member := range resRecruit.Members {
+		if member.Uid != nil {
+			uids = append(uids, *member.Uid)
+		}
+	}
+
+	// 停止中のユーザーのボードは存在しないものとして扱う
+	involved := uids
+	if resRecruit.MasterId != nil {
+		involved = append([]string{*resRecruit.MasterId}, uids...)
+	}
+	suspended, err := common.SuspendedUids(s.db, s.tables.EndUsers, involved)
+	if err != nil {
+		common.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if resRecruit.MasterId != nil && suspended[*resRecruit.MasterId] {
+		common.WriteError(w, http.StatusNotFound, "recruit not found")
+		return
+	}
+
+	// メンバーのプロフィールを付与
+	profiles, err := s.MemberProfiles(uids)
+	if err != nil {
+		fmt.Println("Got error calling BatchGetItem:")
+		fmt.Println(err.Error())
+	}
+	for i, member := range resRecruit.Members {
+		if member.Uid != nil {
+			resRecruit.Members[i].Profile = profiles[*member.Uid]
+			resRecruit.Members[i].Suspended = suspended[*member.Uid]
+		}
+	}
+
 	j, _ := json.Marshal(resRecruit)
+	w.Header().Set("ETag", common.ETag(resRecruit.Version))
 	w.Write(j)
 
 	// 取得値のログ
@@ -249,6 +315,82 @@ type RecruitsCreateRequest struct {
 	Created     *string           `json:"created,omitempty" dynamodbav:"created,omitempty"`
 	Updated     *string           `json:"updated,omitempty" dynamodbav:"updated,omitempty"`
 	IsActive    bool              `json:"isActive" dynamodbav:"isActive"`
+	Version     int               `json:"version" dynamodbav:"version"`
+}
+
+var (
+	errRecruitIdTaken  = fmt.Errorf("recruit id is already used")
+	errVersionConflict = fmt.Errorf("recruit was modified, reload and retry")
+)
+
+// Recruitsとボードの作成者・参加者を登録する（idが未使用の場合のみ）
+//
+// 統計のカウンターは全てのボードで同じ項目のため、トランザクションに含めると同時の作成が衝突する。登録した後に加算する
+func (s *Server) CreateRecruit(rec *RecruitsCreateRequest) error {
+	av, err := dynamodbattribute.MarshalMap(rec)
+	if err != nil {
+		return err
+	}
+	items := []*dynamodb.TransactWriteItem{
+		{
+			Put: &dynamodb.Put{
+				TableName:           aws.String(s.tables.Recruits),
+				Item:                av,
+				ConditionExpression: aws.String("attribute_not_exists(#id)"),
+				ExpressionAttributeNames: map[string]*string{
+					"#id": aws.String("id"),
+				},
+			},
+		},
+		s.ownerPut(*rec.Id, *rec.MasterId, *rec.Created),
+		s.membershipPut(*rec.Id, *rec.MasterId, aws.StringValue(rec.Position), *rec.Created),
+	}
+	_, err = s.db.TransactWriteItems(&dynamodb.TransactWriteItemsInput{TransactItems: items})
+	if failed, ok := common.CanceledItems(err, len(items)); ok && (failed[0] || failed[1] || failed[2]) {
+		return errRecruitIdTaken
+	}
+	if err != nil {
+		return err
+	}
+	s.AddStats(createdStats(rec, time.Now()))
+	return nil
+}
+
+// ボードの作成者（RecruitOwnersの項目）を登録する
+func (s *Server) ownerPut(id int, uid, created string) *dynamodb.TransactWriteItem {
+	return &dynamodb.TransactWriteItem{
+		Put: &dynamodb.Put{
+			TableName: aws.String(s.tables.RecruitOwners),
+			Item: map[string]*dynamodb.AttributeValue{
+				"recruitId": {N: aws.String(strconv.Itoa(id))},
+				"uid":       {S: aws.String(uid)},
+				"created":   {S: aws.String(created)},
+			},
+			ConditionExpression: aws.String("attribute_not_exists(#id)"),
+			ExpressionAttributeNames: map[string]*string{
+				"#id": aws.String("recruitId"),
+			},
+		},
+	}
+}
+
+// ボードの参加者（Membershipsの項目）を登録する（参加済みの場合は取り消される）
+func (s *Server) membershipPut(id int, uid, position, joinedAt string) *dynamodb.TransactWriteItem {
+	return &dynamodb.TransactWriteItem{
+		Put: &dynamodb.Put{
+			TableName: aws.String(s.tables.Memberships),
+			Item: map[string]*dynamodb.AttributeValue{
+				"recruitId": {N: aws.String(strconv.Itoa(id))},
+				"uid":       {S: aws.String(uid)},
+				"position":  {S: aws.String(position)},
+				"joinedAt":  {S: aws.String(joinedAt)},
+			},
+			ConditionExpression: aws.String("attribute_not_exists(#uid)"),
+			ExpressionAttributeNames: map[string]*string{
+				"#uid": aws.String("uid"),
+			},
+		},
+	}
 }
 
 func (s *Server) RecruitCreate(w http.ResponseWriter, r *http.Request) {
@@ -256,37 +398,74 @@ func (s *Server) RecruitCreate(w http.ResponseWriter, r *http.Request) {
 		time.FixedZone("Asia/Tokyo", 9*60*60),
 	).Format("2006-01-02 15:04")
 
-	tableName := "Recruits"
-	// 連番の取得
-	id := s.Increment(tableName)
-
 	var reqRecruit RecruitsCreateRequest
-	json.Unmarshal(StreamToByte(r.Body), &reqRecruit)
+	if err := json.Unmarshal(common.StreamToByte(r.Body), &reqRecruit); err != nil {
+		common.WriteError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+
+	// 停止中のユーザーは募集できない
+	if reqRecruit.MasterId == nil || *reqRecruit.MasterId == "" {
+		common.WriteError(w, http.StatusBadRequest, "masterId is required")
+		return
+	}
+	if err := s.CheckActiveUser(*reqRecruit.MasterId); err != nil {
+		WriteUserCheckError(w, err)
+		return
+	}
 
-	reqRecruit.Id = &id
 	reqRecruit.Created = &nowTime
 	reqRecruit.Updated = &nowTime
 	reqRecruit.IsActive = true
+	reqRecruit.Version = 1
+	// 募集者を最初のメンバーにする
 	reqRecruit.Members = append([]RecruitsMembers{}, RecruitsMembers{
 		Uid:      reqRecruit.MasterId,
 		Position: reqRecruit.Position,
 	})
 
-	av, err := dynamodbattribute.MarshalMap(reqRecruit)
-
-	input := &dynamodb.PutItemInput{
-		Item:      av,
-		TableName: aws.String(tableName),
-	}
+	// 同じidのボードがある場合（復元したデータとカウンターがずれている等）は次のidで登録し直す
+	// idの確保は登録のトランザクションに含めない（登録しなかったidは欠番になる）
+	reqRecruit.Id = nil
+	for attempt := 0; ; attempt++ {
+		if attempt == 5 {
+			common.WriteError(w, http.StatusServiceUnavailable, "could not allocate a recruit id")
+			return
+		}
+		if reqRecruit.Id == nil {
+			id, err := s.ids.NextID()
+			if err != nil {
+				common.WriteError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			reqRecruit.Id = &id
+		}
 
-	_, err = s.db.PutItem(input)
-	if err != nil {
-		fmt.Println("Got error calling PutItem:")
-		fmt.Println(err.Error())
-		os.Exit(1)
+		err := s.CreateRecruit(&reqRecruit)
+		if err == errRecruitIdTaken {
+			fmt.Println("recruit id", *reqRecruit.Id, "already exists")
+			reqRecruit.Id = nil
+			continue
+		}
+		// 他の書き込みと衝突した場合は、少し待って同じidで登録し直す
+		if common.TransactionConflict(err) {
+			time.Sleep(time.Duration(attempt+1) * 50 * time.Millisecond)
+			continue
+		}
+		if err != nil {
+			fmt.Println("Got error calling TransactWriteItems:")
+			fmt.Println(err.Error())
+			common.WriteError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		break
 	}
 
 	j, _ := json.Marshal(reqRecruit)
+	w.Header().Set("Location", "/recruits/"+strconv.Itoa(*reqRecruit.Id))
+	w.Header().Set("ETag", common.ETag(reqRecruit.Version))
+	w.WriteHeader(http.StatusCreated)
+	w.Write(j)
 
 	// 作成値のログ
 	fmt.Println(string(j))
@@ -298,6 +477,88 @@ type MemberAddRequest struct {
 	Position *string `json:"position,omitempty" dynamodbav:"position,omitempty"`
 }
 
+var (
+	errAlreadyJoined = fmt.Errorf("user has already joined")
+	errJoinConflict  = fmt.Errorf("recruit is being updated, retry")
+)
+
+// membersへの追加とMembershipsへの登録を1つのトランザクションで行う
+// （ボードのversionがversionのままの場合のみ。同じユーザーは1度のみ参加できる）
+//
+// 統計のカウンターは全てのボードで同じ項目のため、トランザクションに含めず参加の後に加算する
+func (s *Server) addMember(id int, member *MemberAddRequest, version int, nowTime string) error {
+	addList := []*dynamodb.AttributeValue{
+		{
+			M: map[string]*dynamodb.AttributeValue{
+				"uid": {
+					S: aws.String(*member.Uid),
+				},
+				"position": {
+					S: aws.String(*member.Position),
+				},
+			},
+		},
+	}
+	names := map[string]*string{
+		"#id":      aws.String("id"),
+		"#members": aws.String("members"),
+		"#updated": aws.String("updated"),
+	}
+	values := map[string]*dynamodb.AttributeValue{
+		":addend": {
+			L: addList,
+		},
+		":empty": {
+			L: []*dynamodb.AttributeValue{},
+		},
+		":updated": {
+			S: aws.String(nowTime),
+		},
+	}
+	cond := "attribute_exists(#id) AND " + common.VersionCondition(version, names, values)
+	items := []*dynamodb.TransactWriteItem{
+		{
+			Update: &dynamodb.Update{
+				TableName: aws.String(s.tables.Recruits),
+				Key: map[string]*dynamodb.AttributeValue{
+					"id": {
+						N: aws.String(strconv.Itoa(id)),
+					},
+				},
+				ConditionExpression: aws.String(cond),
+				UpdateExpression: aws.String(
+					"set #members = list_append(if_not_exists(#members, :empty), :addend), #updated = :updated " +
+						common.VersionIncrement(names, values),
+				),
+				ExpressionAttributeNames:  names,
+				ExpressionAttributeValues: values,
+			},
+		},
+		s.membershipPut(id, *member.Uid, *member.Position, nowTime),
+	}
+	_, err := s.db.TransactWriteItems(&dynamodb.TransactWriteItemsInput{TransactItems: items})
+	if failed, ok := common.CanceledItems(err, len(items)); ok {
+		if failed[0] {
+			return errVersionConflict
+		}
+		if failed[1] {
+			return errAlreadyJoined
+		}
+	}
+	if common.TransactionConflict(err) {
+		return errJoinConflict
+	}
+	if err != nil {
+		return err
+	}
+	s.AddStats(map[string]int{
+		common.DailyStat(common.StatJoins, time.Now()): 1,
+		common.StatRecruitsMembers:                     1,
+		common.PositionStat(*member.Position):          1,
+	})
+	return nil
+}
+
 func (s *Server) MemberAdd(w http.ResponseWriter, r *http.Request) {
 	nowTime := time.Now().UTC().In(
 		time.FixedZone("Asia/Tokyo", 9*60*60),
@@ -306,65 +567,112 @@ func (s *Server) MemberAdd(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 
 	var reqMember MemberAddRequest
-	json.Unmarshal(StreamToByte(r.Body), &reqMember)
+	json.Unmarshal(common.StreamToByte(r.Body), &reqMember)
+	if reqMember.Uid == nil || reqMember.Position == nil {
+		common.WriteError(w, http.StatusBadRequest, "uid and position are required")
+		return
+	}
 
-	addMap := map[string]*dynamodb.AttributeValue{
-		"uid": {
-			S: aws.String(*reqMember.Uid),
-		},
-		"position": {
-			S: aws.String(*reqMember.Position),
-		},
+	// 停止中のユーザーは参加できず、停止中のユーザーのボードには参加できない
+	if err := s.CheckActiveUser(*reqMember.Uid); err != nil {
+		WriteUserCheckError(w, err)
+		return
 	}
-	addList := []*dynamodb.AttributeValue{
-		{
-			M: addMap,
-		},
+	if err := s.CheckRecruitOwner(vars["id"]); err != nil {
+		if err == errUserSuspended || err == errUserNotFound {
+			common.WriteError(w, http.StatusNotFound, "recruit not found")
+			return
+		}
+		common.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
 	}
 
-	tableName := "Recruits"
-	param := &dynamodb.UpdateItemInput{
-		TableName: aws.String(tableName),
-		Key: map[string]*dynamodb.AttributeValue{
-			"id": {
-				N: aws.String(vars["id"]),
-			},
-		},
-		UpdateExpression: aws.String(
-			"set #members = list_append(#members, :addend), #updated = :updated",
-		),
-		ExpressionAttributeNames: map[string]*string{
-			"#members": aws.String("members"),
-			"#updated": aws.String("updated"),
-		},
-		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
-			":addend": {
-				L: addList,
-			},
-			":updated": {
-				S: aws.String(nowTime),
-			},
-		},
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		common.WriteError(w, http.StatusNotFound, "recruit not found")
+		return
 	}
-	_, err := s.db.UpdateItem(param)
-
+	// If-Matchがある場合は、GETした時点のボードにのみ参加する
+	expected, checkVersion, err := common.IfMatch(r)
 	if err != nil {
-		fmt.Println("Got error calling PutItem:")
-		fmt.Println(err.Error())
-		os.Exit(1)
+		common.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// 読み込んだversionのままの場合のみ追加する（同時に参加して定員を超えないように、競合した場合は読み直す）
+	var version int
+	for attempt := 0; ; attempt++ {
+		current, err := s.recruitForUpdate(vars["id"])
+		if err != nil {
+			common.WriteError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if current == nil || !current.IsActive || current.DeletedAt != nil {
+			common.WriteError(w, http.StatusNotFound, "recruit not found")
+			return
+		}
+		if checkVersion && current.Version != expected {
+			common.WriteError(w, http.StatusPreconditionFailed, errVersionConflict.Error())
+			return
+		}
+		if current.hasMember(*reqMember.Uid) {
+			common.WriteError(w, http.StatusConflict, "user has already joined")
+			return
+		}
+		if current.isFull() {
+			common.WriteError(w, http.StatusConflict, "recruit is full")
+			return
+		}
+		version = current.Version
+
+		err = s.addMember(id, &reqMember, version, nowTime)
+		if err == errVersionConflict {
+			if checkVersion || attempt == 2 {
+				common.WriteError(w, http.StatusPreconditionFailed, err.Error())
+				return
+			}
+			continue
+		}
+		// 同じボードへの他の書き込みと同時だった場合（versionは変わっていない場合がある）も読み直す
+		if err == errJoinConflict {
+			if attempt == 2 {
+				common.WriteError(w, http.StatusConflict, err.Error())
+				return
+			}
+			continue
+		}
+		if err == errAlreadyJoined {
+			common.WriteError(w, http.StatusConflict, "user has already joined")
+			return
+		}
+		if err != nil {
+			fmt.Println("Got error calling TransactWriteItems:")
+			fmt.Println(err.Error())
+			common.WriteError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		break
 	}
 
+	w.Header().Set("ETag", common.ETag(version+1))
 	j, _ := json.Marshal(reqMember)
 	// 追加メンバーのログ
 	fmt.Println(string(j))
 
+	if s.mailByWorker {
+		return
+	}
+
+	// 参加は完了しているため、メールの失敗はログに残すだけにする
 	// 募集者にメール送信
-	recruitMail := s.RecruitMailInfo(vars["id"], *reqMember.Position)
-	s.MailSend(recruitMail)
-	
+	if err := s.sendMail(s.RecruitMailInfo(vars["id"], *reqMember.Position)); err != nil {
+		fmt.Println("recruit mail:", err)
+	}
+
 	// 参加者にメール送信
-	joinMail := s.JoinMailInfo(*reqMember.Uid, *reqMember.Position, vars["id"])
-	s.MailSend(joinMail)
+	if err := s.sendMail(s.JoinMailInfo(*reqMember.Uid, *reqMember.Position, vars["id"])); err != nil {
+		fmt.Println("join mail:", err)
+	}
 }
 
 type MailInfo struct {
@@ -380,9 +688,9 @@ type MailInfo struct {
 	CharSet  string // 文字のエンコード
 }
 
-func NewMailInfo(sender, name, charSet string) *MailInfo {
+func NewMailInfo(mail common.MailConfig, charSet string) *MailInfo {
 	return &MailInfo{
-		Sender:  name + "<" + sender + ">",
+		Sender:  mail.From(),
 		CharSet: charSet,
 	}
 }
@@ -400,26 +708,75 @@ type GetUser struct {
 	Email *string `dynamodbav:"email,omitempty"`
 }
 
-func (s *Server) RecruitMailInfo(id, position string) *MailInfo {
-	mailInfo := *NewMailInfo("info@raityupiyo.dev", "GuildHack", "UTF-8")
-
-	result, _ := s.db.Scan(&dynamodb.ScanInput{
-		TableName:                 aws.String("Recruits"),
-		FilterExpression:          aws.String("#I = :id"),
-		ExpressionAttributeNames:  map[string]*string{"#I": aws.String("id")},
-		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":id": {N: aws.String(id)}},
+// メールに載せるボード
+func (s *Server) mailRecruit(id string) (*GetRecruit, error) {
+	result, err := s.db.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String(s.tables.Recruits),
+		Key: map[string]*dynamodb.AttributeValue{
+			"id": {
+				N: aws.String(id),
+			},
+		},
 	})
+	if err != nil {
+		return nil, err
+	}
+	if result.Item == nil {
+		return nil, fmt.Errorf("recruit %s not found", id)
+	}
 	var getRecruit GetRecruit
-	dynamodbattribute.UnmarshalMap(result.Items[0], &getRecruit)
+	if err := dynamodbattribute.UnmarshalMap(result.Item, &getRecruit); err != nil {
+		return nil, err
+	}
+	return &getRecruit, nil
+}
 
-	result, _ = s.db.Scan(&dynamodb.ScanInput{
-		TableName:                 aws.String("EndUsers"),
-		FilterExpression:          aws.String("#u = :uid"),
-		ExpressionAttributeNames:  map[string]*string{"#u": aws.String("uid")},
-		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":uid": {S: aws.String(*getRecruit.MasterId)}},
+// メールの宛先のユーザー（メールアドレスが無い場合はエラー）
+func (s *Server) mailUser(uid string) (*GetUser, error) {
+	result, err := s.db.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String(s.tables.EndUsers),
+		Key: map[string]*dynamodb.AttributeValue{
+			"uid": {
+				S: aws.String(uid),
+			},
+		},
+		ProjectionExpression: aws.String("#N, #E"),
+		ExpressionAttributeNames: map[string]*string{
+			"#N": aws.String("name"),
+			"#E": aws.String("email"),
+		},
 	})
+	if err != nil {
+		return nil, err
+	}
+	if result.Item == nil {
+		return nil, errUserNotFound
+	}
 	var getUser GetUser
-	dynamodbattribute.UnmarshalMap(result.Items[0], &getUser)
+	if err := dynamodbattribute.UnmarshalMap(result.Item, &getUser); err != nil {
+		return nil, err
+	}
+	if aws.StringValue(getUser.Email) == "" {
+		return nil, fmt.Errorf("user %s has no email", uid)
+	}
+	return &getUser, nil
+}
+
+// 募集者に送る参加の通知（ボードまたは募集者が無い場合はエラー）
+func (s *Server) RecruitMailInfo(id, position string) (*MailInfo, error) {
+	mailInfo := *NewMailInfo(s.mail, "UTF-8")
+
+	getRecruit, err := s.mailRecruit(id)
+	if err != nil {
+		return nil, err
+	}
+	if getRecruit.MasterId == nil {
+		return nil, fmt.Errorf("recruit %s has no master", id)
+	}
+	getUser, err := s.mailUser(aws.StringValue(getRecruit.MasterId))
+	if err != nil {
+		return nil, err
+	}
 
 	positionList := map[string]string{
 		"frontend": "フロントエンド",
@@ -427,57 +784,49 @@ func (s *Server) RecruitMailInfo(id, position string) *MailInfo {
 		"infra":    "インフラ",
 	}
 
-	mailInfo.Recipient = *getUser.Email
+	mailInfo.Recipient = aws.StringValue(getUser.Email)
 	mailInfo.Subject = "【GuildHack】募集中ボードに参加メンバー追加の通知"
-	mailInfo.HtmlBody = "<p>" + *getUser.Name + "さん、こんにちは！ GuildHack運営事務局です。</p>" +
-		"<p>タイトル : " + *getRecruit.Title + "のボードに" + positionList[position] + "で" + strconv.Itoa(len(getRecruit.Members)-1) + "人目のメンバーが参加しました。</p>" +
+	mailInfo.HtmlBody = "<p>" + aws.StringValue(getUser.Name) + "さん、こんにちは！ GuildHack運営事務局です。</p>" +
+		"<p>タイトル : " + aws.StringValue(getRecruit.Title) + "のボードに" + positionList[position] + "で" + strconv.Itoa(len(getRecruit.Members)-1) + "人目のメンバーが参加しました。</p>" +
 		"<p>以下のURLをクリックし、確認してください。</p>" +
-		"<p><a href='https://raityupiyo.dev/quest_bord/" + id + "'>https://raityupiyo.dev/quest_bord/" + id + "</a></p>" +
+		"<p><a href='" + s.publicBaseURL + "/quest_bord/" + id + "'>" + s.publicBaseURL + "/quest_bord/" + id + "</a></p>" +
 		"<br>" +
 		"<p>※イベント参加時のトラブルの責任は一切おいかねますので、ご了承ください。</p>" +
 		"<p>※連絡のない当日不参加が繰り返される場合、退会とさせていただくことがありますので、ご了承ください。</p>" +
 		"<p>※本メールアドレスは送信専用のため、返信できません。</p>" +
 		"<p>---------------------------</p>" +
 		"<p>GuildHack運営事務局</p>" +
-		"<p>Mail : support@raityupiyo.dev</p>" +
-		"<p><a href='https://raityupiyo.dev'>https://raityupiyo.dev</a></p>" +
+		"<p>Mail : " + s.mail.Support + "</p>" +
+		"<p><a href='" + s.publicBaseURL + "'>" + s.publicBaseURL + "</a></p>" +
 		"<p>---------------------------</p>"
-	mailInfo.TextBody = *getUser.Name + "さん、こんにちは！ GuildHack運営事務局です。\n" +
-		"タイトル : " + *getRecruit.Title + "のボードに" + positionList[position] + "で" + strconv.Itoa(len(getRecruit.Members)-1) + "/のメンバーが参加しました。\n" +
+	mailInfo.TextBody = aws.StringValue(getUser.Name) + "さん、こんにちは！ GuildHack運営事務局です。\n" +
+		"タイトル : " + aws.StringValue(getRecruit.Title) + "のボードに" + positionList[position] + "で" + strconv.Itoa(len(getRecruit.Members)-1) + "/のメンバーが参加しました。\n" +
 		"以下のURLをクリックし、確認してください。\n" +
-		"https://raityupiyo.dev/quest_bord/" + id + "\n" +
+		s.publicBaseURL + "/quest_bord/" + id + "\n" +
 		"\n" +
 		"※イベント参加時のトラブルの責任は一切おいかねますので、ご了承ください。\n" +
 		"※連絡のない当日不参加が繰り返される場合、退会とさせていただくことがありますので、ご了承ください。\n" +
 		"※本メールアドレスは送信専用のため、返信できません。\n" +
 		"---------------------------\n" +
 		"GuildHack運営事務局\n" +
-		"Mail : support@raityupiyo.dev\n" +
-		"https://raityupiyo.dev\n" +
+		"Mail : " + s.mail.Support + "\n" +
+		s.publicBaseURL + "\n" +
 		"--------------------------"
-	return &mailInfo
+	return &mailInfo, nil
 }
 
-func (s *Server) JoinMailInfo(uid, position, id string) *MailInfo {
-	mailInfo := *NewMailInfo("info@raityupiyo.dev", "GuildHack", "UTF-8")
-
-	result, _ := s.db.Scan(&dynamodb.ScanInput{
-		TableName:                 aws.String("Recruits"),
-		FilterExpression:          aws.String("#I = :id"),
-		ExpressionAttributeNames:  map[string]*string{"#I": aws.String("id")},
-		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":id": {N: aws.String(id)}},
-	})
-	var getRecruit GetRecruit
-	dynamodbattribute.UnmarshalMap(result.Items[0], &getRecruit)
+// 参加者に送る参加完了の通知（ボードまたは参加者が無い場合はエラー）
+func (s *Server) JoinMailInfo(uid, position, id string) (*MailInfo, error) {
+	mailInfo := *NewMailInfo(s.mail, "UTF-8")
 
-	result, _ = s.db.Scan(&dynamodb.ScanInput{
-		TableName:                 aws.String("EndUsers"),
-		FilterExpression:          aws.String("#u = :uid"),
-		ExpressionAttributeNames:  map[string]*string{"#u": aws.String("uid")},
-		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":uid": {S: aws.String(uid)}},
-	})
-	var getUser GetUser
-	dynamodbattribute.UnmarshalMap(result.Items[0], &getUser)
+	getRecruit, err := s.mailRecruit(id)
+	if err != nil {
+		return nil, err
+	}
+	getUser, err := s.mailUser(uid)
+	if err != nil {
+		return nil, err
+	}
 
 	positionList := map[string]string{
 		"frontend": "フロントエンド",
@@ -485,44 +834,52 @@ func (s *Server) JoinMailInfo(uid, position, id string) *MailInfo {
 		"infra":    "インフラ",
 	}
 
-	mailInfo.Recipient = *getUser.Email
+	mailInfo.Recipient = aws.StringValue(getUser.Email)
 	mailInfo.Subject = "【GuildHack】参加完了の通知"
-	mailInfo.HtmlBody = "<p>" + *getUser.Name + "さん、こんにちは！ GuildHack運営事務局です。</p>" +
-		"<p>タイトル : " + *getRecruit.Title + "（" + *getRecruit.EventDay + "からの" + *getRecruit.Day + "日間）に" + positionList[position] + "として参加が確定しました。</p>" +
+	mailInfo.HtmlBody = "<p>" + aws.StringValue(getUser.Name) + "さん、こんにちは！ GuildHack運営事務局です。</p>" +
+		"<p>タイトル : " + aws.StringValue(getRecruit.Title) + "（" + aws.StringValue(getRecruit.EventDay) + "からの" + aws.StringValue(getRecruit.Day) + "日間）に" + positionList[position] + "として参加が確定しました。</p>" +
 		"<p>以下のURLをクリックし、確認してください。</p>" +
-		"<p><a href='https://raityupiyo.dev/quest_bord/" + id + "'>https://raityupiyo.dev/quest_bord/" + id + "</a></p>" +
+		"<p><a href='" + s.publicBaseURL + "/quest_bord/" + id + "'>" + s.publicBaseURL + "/quest_bord/" + id + "</a></p>" +
 		"<br>" +
 		"<p>コミュニケーションツールへの招待は以下のURLになります。</p>" +
-		"<p><a href='" + *getRecruit.SlackUrl + "'>" + *getRecruit.SlackUrl + "</a></p>" +
+		"<p><a href='" + aws.StringValue(getRecruit.SlackUrl) + "'>" + aws.StringValue(getRecruit.SlackUrl) + "</a></p>" +
 		"<br>" +
 		"<p>※イベント参加時のトラブルの責任は一切おいかねますので、ご了承ください。</p>" +
 		"<p>※連絡のない当日不参加が繰り返される場合、退会とさせていただくことがありますので、ご了承ください。</p>" +
 		"<p>※本メールアドレスは送信専用のため、返信できません。</p>" +
 		"<p>---------------------------</p>" +
 		"<p>GuildHack運営事務局</p>" +
-		"<p>Mail : support@raityupiyo.dev</p>" +
-		"<p><a href='https://raityupiyo.dev'>https://raityupiyo.dev</a></p>" +
+		"<p>Mail : " + s.mail.Support + "</p>" +
+		"<p><a href='" + s.publicBaseURL + "'>" + s.publicBaseURL + "</a></p>" +
 		"<p>---------------------------</p>"
-	mailInfo.TextBody = *getUser.Name + "さん、こんにちは！ GuildHack運営事務局です。\n" +
-		"タイトル : " + *getRecruit.Title + "（" + *getRecruit.EventDay + "からの" + *getRecruit.Day + "日間）への参加が確定しました。\n" +
+	mailInfo.TextBody = aws.StringValue(getUser.Name) + "さん、こんにちは！ GuildHack運営事務局です。\n" +
+		"タイトル : " + aws.StringValue(getRecruit.Title) + "（" + aws.StringValue(getRecruit.EventDay) + "からの" + aws.StringValue(getRecruit.Day) + "日間）への参加が確定しました。\n" +
 		"以下のURLをクリックし、確認してください。\n" +
-		"https://raityupiyo.dev/quest_bord/" + id + "\n" +
+		s.publicBaseURL + "/quest_bord/" + id + "\n" +
 		"\n" +
 		"コミュニケーションツールへの招待は以下のURLになります。" +
-		*getRecruit.SlackUrl + "\n" +
+		aws.StringValue(getRecruit.SlackUrl) + "\n" +
 		"\n" +
 		"※イベント参加時のトラブルの責任は一切おいかねますので、ご了承ください。\n" +
 		"※連絡のない当日不参加が繰り返される場合、退会とさせていただくことがありますので、ご了承ください。\n" +
 		"※本メールアドレスは送信専用のため、返信できません。\n" +
 		"---------------------------\n" +
 		"GuildHack運営事務局\n" +
-		"Mail : support@raityupiyo.dev\n" +
-		"https://raityupiyo.dev\n" +
+		"Mail : " + s.mail.Support + "\n" +
+		s.publicBaseURL + "\n" +
 		"--------------------------"
-	return &mailInfo
+	return &mailInfo, nil
+}
+
+// MailInfoの作成に成功した場合のみ送信する
+func (s *Server) sendMail(info *MailInfo, err error) error {
+	if err != nil {
+		return err
+	}
+	return s.MailSend(info)
 }
 
-func (s *Server) MailSend(info *MailInfo) {
+func (s *Server) MailSend(info *MailInfo) error {
 	input := &ses.SendEmailInput{
 		Destination: &ses.Destination{
 			CcAddresses: []*string{},
@@ -551,28 +908,13 @@ func (s *Server) MailSend(info *MailInfo) {
 		//ConfigurationSetName: aws.String(info.ConfigurationSet),
 	}
 	result, err := s.ses.SendEmail(input)
-
-	// Display error messages if they occur.
 	if err != nil {
-		if aerr, ok := err.(awserr.Error); ok {
-			switch aerr.Code() {
-			case ses.ErrCodeMessageRejected:
-				fmt.Println(ses.ErrCodeMessageRejected, aerr.Error())
-			case ses.ErrCodeMailFromDomainNotVerifiedException:
-				fmt.Println(ses.ErrCodeMailFromDomainNotVerifiedException, aerr.Error())
-			case ses.ErrCodeConfigurationSetDoesNotExistException:
-				fmt.Println(ses.ErrCodeConfigurationSetDoesNotExistException, aerr.Error())
-			default:
-				fmt.Println(aerr.Error())
-			}
-		} else {
-			// Print the error, cast err to awserr.Error to get the Code and
-			// Message from an error.
-			fmt.Println(err.Error())
-		}
-		return
+		s.AddStats(map[string]int{common.StatMailFailed: 1})
+		return err
 	}
+	s.AddStats(map[string]int{common.StatMailSent: 1})
 
 	// メールのログ
 	fmt.Println(result)
+	return nil
 }
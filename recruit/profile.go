@@ -0,0 +1,37 @@
+package recruit
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/hew-team1/all-api-dev/common"
+)
+
+// uidごとの公開プロフィールを取得（停止中のユーザーは含めない）
+func (s *Server) MemberProfiles(uids []string) (map[string]*common.PublicProfile, error) {
+	profiles := map[string]*common.PublicProfile{}
+	keys := make([]map[string]*dynamodb.AttributeValue, 0, len(uids))
+	for _, uid := range uids {
+		keys = append(keys, map[string]*dynamodb.AttributeValue{"uid": {S: aws.String(uid)}})
+	}
+	projection, names := common.PublicProfileProjection("isActive")
+	items, err := common.BatchGet(s.db, s.tables.EndUsers, keys, projection, names)
+	if err != nil {
+		return profiles, err
+	}
+	for _, item := range items {
+		var user struct {
+			common.Profile
+			IsActive bool `dynamodbav:"isActive"`
+		}
+		if err := dynamodbattribute.UnmarshalMap(item, &user); err != nil {
+			return profiles, err
+		}
+		if !user.IsActive {
+			continue
+		}
+		profile := user.Public()
+		profiles[aws.StringValue(item["uid"].S)] = &profile
+	}
+	return profiles, nil
+}
@@ -0,0 +1,117 @@
+package recruit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/hew-team1/all-api-dev/common"
+	"github.com/hew-team1/all-api-dev/common/dynamotest"
+	"github.com/hew-team1/all-api-dev/common/profiletest"
+)
+
+func TestRecruitRoutesOmitPrivateFields(t *testing.T) {
+	cfg := common.DefaultConfig()
+	db := dynamotest.New()
+	defer db.Close()
+	db.Table(cfg.Tables.EndUsers, "uid")
+	db.Table(cfg.Tables.Recruits, "id")
+
+	db.Put(cfg.Tables.EndUsers, profiletest.StoredUser("owner"))
+	db.Put(cfg.Tables.EndUsers, profiletest.StoredUser("member"))
+	db.Put(cfg.Tables.Recruits, profiletest.StoredRecruit(1, "owner", "member"))
+
+	s := NewServer(db.Client(), nil, nil, cfg)
+	r := mux.NewRouter()
+	r.HandleFunc("/recruits", s.RecruitAllGet).Methods("GET")
+	r.HandleFunc("/recruits/{id}", s.RecruitGet).Methods("GET")
+
+	tests := []struct {
+		name string
+		path string
+		// レスポンスの中のプロフィール（一覧の場合はmembers）
+		profiles func(body []byte) ([]map[string]interface{}, error)
+		// プロフィールに必ず含まれる項目
+		wantKeys []string
+	}{
+		{
+			name: "recruit list",
+			path: "/recruits",
+			profiles: func(body []byte) ([]map[string]interface{}, error) {
+				var res []struct {
+					Members []map[string]interface{} `json:"members"`
+				}
+				if err := json.Unmarshal(body, &res); err != nil {
+					return nil, err
+				}
+				var members []map[string]interface{}
+				for _, recruit := range res {
+					members = append(members, recruit.Members...)
+				}
+				return members, nil
+			},
+			wantKeys: []string{"uid"},
+		},
+		{
+			name: "recruit detail",
+			path: "/recruits/1",
+			profiles: func(body []byte) ([]map[string]interface{}, error) {
+				var res struct {
+					Members []struct {
+						Profile map[string]interface{} `json:"profile"`
+					} `json:"members"`
+				}
+				if err := json.Unmarshal(body, &res); err != nil {
+					return nil, err
+				}
+				var profiles []map[string]interface{}
+				for _, member := range res.Members {
+					profiles = append(profiles, member.Profile)
+				}
+				return profiles, nil
+			},
+			wantKeys: []string{"displayName", "portfolioUrl"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+			}
+			profiles, err := tt.profiles(rec.Body.Bytes())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(profiles) != 2 {
+				t.Fatalf("got %d profiles, want 2: %s", len(profiles), rec.Body.String())
+			}
+			for _, profile := range profiles {
+				if profile == nil {
+					t.Fatalf("profile is missing: %s", rec.Body.String())
+				}
+				for _, key := range profiletest.PrivateKeys() {
+					if _, ok := profile[key]; ok {
+						t.Errorf("%s is returned: %s", key, rec.Body.String())
+					}
+				}
+				for _, key := range tt.wantKeys {
+					if _, ok := profile[key]; !ok {
+						t.Errorf("%s is missing: %s", key, rec.Body.String())
+					}
+				}
+			}
+			for _, uid := range []string{"owner", "member"} {
+				for _, value := range profiletest.PrivateValues(uid) {
+					if strings.Contains(rec.Body.String(), value) {
+						t.Errorf("%q is returned: %s", value, rec.Body.String())
+					}
+				}
+			}
+		})
+	}
+}
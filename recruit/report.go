@@ -0,0 +1,175 @@
+package recruit
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/gorilla/mux"
+	"github.com/hew-team1/all-api-dev/common"
+)
+
+const maxReportDetail = 1000
+
+// 通報の対象
+const (
+	ReportTargetRecruit = "recruit"
+	ReportTargetUser    = "user"
+)
+
+// 管理者が対応する前の通報の状態
+const ReportStatusOpen = "open"
+
+// 通報のカテゴリ
+var reportCategories = map[string]string{
+	"spam":          "スパム",
+	"harassment":    "嫌がらせ",
+	"inappropriate": "不適切な内容",
+	"impersonation": "なりすまし",
+	"other":         "その他",
+}
+
+// Reportsの項目
+type Report struct {
+	Id          string  `json:"id" dynamodbav:"id"`
+	TargetType  string  `json:"targetType" dynamodbav:"targetType"`
+	TargetId    string  `json:"targetId" dynamodbav:"targetId"`
+	ReporterUid string  `json:"reporterUid" dynamodbav:"reporterUid"`
+	Category    string  `json:"category" dynamodbav:"category"`
+	Detail      *string `json:"detail,omitempty" dynamodbav:"detail,omitempty"`
+	Status      string  `json:"status" dynamodbav:"status"`
+	Created     string  `json:"created" dynamodbav:"created"`
+	Updated     string  `json:"updated" dynamodbav:"updated"`
+}
+
+type ReportCreateRequest struct {
+	Category *string `json:"category"`
+	Detail   *string `json:"detail"`
+}
+
+func (req *ReportCreateRequest) Validate() error {
+	if req.Category == nil {
+		return fmt.Errorf("category is required")
+	}
+	if _, ok := reportCategories[*req.Category]; !ok {
+		return fmt.Errorf("unknown category %q", *req.Category)
+	}
+	if req.Detail != nil && utf8.RuneCountInString(*req.Detail) > maxReportDetail {
+		return fmt.Errorf("detail must be at most %d characters", maxReportDetail)
+	}
+	return nil
+}
+
+// 通報を登録する
+func (s *Server) CreateReport(targetType, targetId, reporterUid string, req *ReportCreateRequest) (*Report, error) {
+	nowTime := time.Now().UTC().In(
+		time.FixedZone("Asia/Tokyo", 9*60*60),
+	).Format("2006-01-02 15:04")
+
+	id, err := common.RandomHex(16)
+	if err != nil {
+		return nil, err
+	}
+	report := &Report{
+		Id:          id,
+		TargetType:  targetType,
+		TargetId:    targetId,
+		ReporterUid: reporterUid,
+		Category:    *req.Category,
+		Detail:      req.Detail,
+		Status:      ReportStatusOpen,
+		Created:     nowTime,
+		Updated:     nowTime,
+	}
+	av, err := dynamodbattribute.MarshalMap(report)
+	if err != nil {
+		return nil, err
+	}
+	_, err = s.db.PutItem(&dynamodb.PutItemInput{
+		TableName:           aws.String(s.tables.Reports),
+		Item:                av,
+		ConditionExpression: aws.String("attribute_not_exists(#id)"),
+		ExpressionAttributeNames: map[string]*string{
+			"#id": aws.String("id"),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// ==================== Report ====================
+func (s *Server) RecruitReport(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if _, err := strconv.Atoi(vars["id"]); err != nil {
+		common.WriteError(w, http.StatusBadRequest, "id must be a number")
+		return
+	}
+
+	uid := r.Header.Get("uid")
+	if uid == "" {
+		common.WriteError(w, http.StatusUnauthorized, "uid header is required")
+		return
+	}
+	// 停止中のユーザーは通報できない
+	if err := s.CheckActiveUser(uid); err != nil {
+		WriteUserCheckError(w, err)
+		return
+	}
+
+	var reqReport ReportCreateRequest
+	if err := json.Unmarshal(common.StreamToByte(r.Body), &reqReport); err != nil {
+		common.WriteError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if err := reqReport.Validate(); err != nil {
+		common.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	result, err := s.db.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String(s.tables.Recruits),
+		Key: map[string]*dynamodb.AttributeValue{
+			"id": {
+				N: aws.String(vars["id"]),
+			},
+		},
+		ProjectionExpression: aws.String("#M, #D"),
+		ExpressionAttributeNames: map[string]*string{
+			"#M": aws.String("masterId"),
+			"#D": aws.String("deletedAt"),
+		},
+	})
+	if err != nil {
+		common.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if result.Item == nil || result.Item["deletedAt"] != nil {
+		common.WriteError(w, http.StatusNotFound, "recruit not found")
+		return
+	}
+	if result.Item["masterId"] != nil && aws.StringValue(result.Item["masterId"].S) == uid {
+		common.WriteError(w, http.StatusBadRequest, "cannot report your own recruit")
+		return
+	}
+
+	report, err := s.CreateReport(ReportTargetRecruit, vars["id"], uid, &reqReport)
+	if err != nil {
+		common.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	j, _ := json.Marshal(report)
+	w.WriteHeader(http.StatusCreated)
+	w.Write(j)
+
+	// 作成値のログ
+	fmt.Println(string(j))
+}
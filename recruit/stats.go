@@ -0,0 +1,47 @@
+package recruit
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/hew-team1/all-api-dev/common"
+)
+
+// 作成したボードのカウンターの増減（作成者が最初のメンバー）
+func createdStats(rec *RecruitsCreateRequest, now time.Time) map[string]int {
+	capacity, _ := strconv.Atoi(aws.StringValue(rec.TotalMember))
+	return map[string]int{
+		common.StatRecruits:                                1,
+		common.DailyStat(common.StatRecruitsNew, now):      1,
+		common.StatRecruitsMembers:                         1,
+		common.PositionStat(aws.StringValue(rec.Position)): 1,
+		common.StatRecruitsCapacity:                        capacity,
+	}
+}
+
+// 削除したボードを除く（n=-1）・戻す（n=1）ためのカウンターの増減
+func recruitStats(rec *RecruitForUpdate, n int) map[string]int {
+	deltas := map[string]int{
+		common.StatRecruits:        n,
+		common.StatRecruitsDeleted: -n,
+	}
+	if !rec.IsActive {
+		deltas[common.StatRecruitsOff] += n
+	}
+	if rec.Closed != nil {
+		deltas[common.StatRecruitsClosed] += n
+	}
+	capacity, _ := strconv.Atoi(aws.StringValue(rec.TotalMember))
+	deltas[common.StatRecruitsCapacity] += n * capacity
+	for _, member := range rec.Members {
+		deltas[common.StatRecruitsMembers] += n
+		deltas[common.PositionStat(aws.StringValue(member.Position))] += n
+	}
+	return deltas
+}
+
+// カウンターを加算する（統計のみのため、失敗しても処理は止めない）
+func (s *Server) AddStats(deltas map[string]int) {
+	common.AddStats(s.db, s.tables.AtomicCounter, deltas)
+}
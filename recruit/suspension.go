@@ -0,0 +1,90 @@
+package recruit
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/hew-team1/all-api-dev/common"
+)
+
+// 書き込みを拒否した理由
+var (
+	errUserNotFound  = fmt.Errorf("user not found")
+	errUserSuspended = fmt.Errorf("user is suspended")
+)
+
+// 書き込みの可否の判定に必要なユーザーの項目
+type UserStatus struct {
+	IsActive  bool    `dynamodbav:"isActive"`
+	DeletedAt *string `dynamodbav:"deletedAt,omitempty"`
+}
+
+// uidが書き込みできるユーザーか（停止中・退会済みはエラー）
+func (s *Server) CheckActiveUser(uid string) error {
+	result, err := s.db.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String(s.tables.EndUsers),
+		Key: map[string]*dynamodb.AttributeValue{
+			"uid": {
+				S: aws.String(uid),
+			},
+		},
+		ProjectionExpression: aws.String("#A, #D"),
+		ExpressionAttributeNames: map[string]*string{
+			"#A": aws.String("isActive"),
+			"#D": aws.String("deletedAt"),
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if result.Item == nil {
+		return errUserNotFound
+	}
+	var status UserStatus
+	dynamodbattribute.UnmarshalMap(result.Item, &status)
+	if status.DeletedAt != nil {
+		return errUserNotFound
+	}
+	if !status.IsActive {
+		return errUserSuspended
+	}
+	return nil
+}
+
+// CheckActiveUserのエラーをレスポンスに変換
+func WriteUserCheckError(w http.ResponseWriter, err error) {
+	switch err {
+	case errUserNotFound:
+		common.WriteError(w, http.StatusNotFound, err.Error())
+	case errUserSuspended:
+		common.WriteError(w, http.StatusForbidden, err.Error())
+	default:
+		common.WriteError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// idのボードの募集者が書き込みできるユーザーか
+func (s *Server) CheckRecruitOwner(id string) error {
+	result, err := s.db.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String(s.tables.Recruits),
+		Key: map[string]*dynamodb.AttributeValue{
+			"id": {
+				N: aws.String(id),
+			},
+		},
+		ProjectionExpression: aws.String("#M"),
+		ExpressionAttributeNames: map[string]*string{
+			"#M": aws.String("masterId"),
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if result.Item == nil || result.Item["masterId"] == nil {
+		return errUserNotFound
+	}
+	return s.CheckActiveUser(aws.StringValue(result.Item["masterId"].S))
+}
@@ -0,0 +1,235 @@
+package recruit
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/gorilla/mux"
+	"github.com/hew-team1/all-api-dev/common"
+)
+
+// 書き込み前に読み込むボードの項目
+type RecruitForUpdate struct {
+	MasterId    *string           `dynamodbav:"masterId,omitempty"`
+	TotalMember *string           `dynamodbav:"totalMember,omitempty"`
+	Members     []RecruitsMembers `dynamodbav:"members,omitempty"`
+	IsActive    bool              `dynamodbav:"isActive"`
+	Closed      *string           `dynamodbav:"closed,omitempty"`
+	DeletedAt   *string           `dynamodbav:"deletedAt,omitempty"`
+	Version     int               `dynamodbav:"version"`
+}
+
+// idのボードを強い整合性で読み込む（無い場合はnil）
+func (s *Server) recruitForUpdate(id string) (*RecruitForUpdate, error) {
+	result, err := s.db.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String(s.tables.Recruits),
+		Key: map[string]*dynamodb.AttributeValue{
+			"id": {
+				N: aws.String(id),
+			},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.Item == nil {
+		return nil, nil
+	}
+	var rec RecruitForUpdate
+	if err := dynamodbattribute.UnmarshalMap(result.Item, &rec); err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+// uidが参加済みか
+func (r *RecruitForUpdate) hasMember(uid string) bool {
+	for _, member := range r.Members {
+		if aws.StringValue(member.Uid) == uid {
+			return true
+		}
+	}
+	return false
+}
+
+// 募集者を含めて定員に達しているか（定員が無い場合は常にfalse）
+func (r *RecruitForUpdate) isFull() bool {
+	capacity, _ := strconv.Atoi(aws.StringValue(r.TotalMember))
+	return capacity > 0 && len(r.Members) >= capacity
+}
+
+// ==================== Update ====================
+// 募集者が変更できる項目（指定した項目のみ変更する）
+type RecruitUpdateRequest struct {
+	Title       *string `json:"title,omitempty"`
+	EventDay    *string `json:"eventDay,omitempty"`
+	Day         *string `json:"day,omitempty"`
+	Organizer   *string `json:"organizer,omitempty"`
+	Commit      *string `json:"commit,omitempty"`
+	Beginner    *string `json:"beginner,omitempty"`
+	Message     *string `json:"message,omitempty"`
+	SlackUrl    *string `json:"slackUrl,omitempty"`
+	TotalMember *string `json:"totalMember,omitempty"`
+	Reword      *string `json:"reword,omitempty"`
+}
+
+// 変更する属性名と値
+func (req *RecruitUpdateRequest) fields() map[string]*string {
+	fields := map[string]*string{
+		"title":       req.Title,
+		"eventDay":    req.EventDay,
+		"day":         req.Day,
+		"organizer":   req.Organizer,
+		"commit":      req.Commit,
+		"beginner":    req.Beginner,
+		"message":     req.Message,
+		"slackUrl":    req.SlackUrl,
+		"totalMember": req.TotalMember,
+		"reword":      req.Reword,
+	}
+	for name, value := range fields {
+		if value == nil {
+			delete(fields, name)
+		}
+	}
+	return fields
+}
+
+func (s *Server) RecruitUpdate(w http.ResponseWriter, r *http.Request) {
+	nowTime := time.Now().UTC().In(
+		time.FixedZone("Asia/Tokyo", 9*60*60),
+	).Format("2006-01-02 15:04")
+
+	vars := mux.Vars(r)
+	uid := r.Header.Get("uid")
+	if uid == "" {
+		common.WriteError(w, http.StatusUnauthorized, "uid header is required")
+		return
+	}
+	if _, err := strconv.Atoi(vars["id"]); err != nil {
+		common.WriteError(w, http.StatusBadRequest, "id must be a number")
+		return
+	}
+	if err := s.CheckActiveUser(uid); err != nil {
+		WriteUserCheckError(w, err)
+		return
+	}
+	expected, checkVersion, err := common.IfMatch(r)
+	if err != nil {
+		common.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var reqUpdate RecruitUpdateRequest
+	if err := json.Unmarshal(common.StreamToByte(r.Body), &reqUpdate); err != nil {
+		common.WriteError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	fields := reqUpdate.fields()
+	if len(fields) == 0 {
+		common.WriteError(w, http.StatusBadRequest, "no fields to update")
+		return
+	}
+
+	current, err := s.recruitForUpdate(vars["id"])
+	if err != nil {
+		common.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if current == nil || !current.IsActive || current.DeletedAt != nil {
+		common.WriteError(w, http.StatusNotFound, "recruit not found")
+		return
+	}
+	if aws.StringValue(current.MasterId) != uid {
+		common.WriteError(w, http.StatusForbidden, "only the recruit owner can update the recruit")
+		return
+	}
+	if checkVersion && current.Version != expected {
+		common.WriteError(w, http.StatusPreconditionFailed, errVersionConflict.Error())
+		return
+	}
+	// 定員は参加済みの人数より少なくできない
+	if reqUpdate.TotalMember != nil {
+		capacity, err := strconv.Atoi(*reqUpdate.TotalMember)
+		if err != nil || capacity < 1 {
+			common.WriteError(w, http.StatusBadRequest, "totalMember must be a positive number")
+			return
+		}
+		if capacity < len(current.Members) {
+			common.WriteError(w, http.StatusConflict, fmt.Sprintf("totalMember must be at least %d", len(current.Members)))
+			return
+		}
+	}
+
+	// 読み込んだ後に管理者の停止や参加があった場合は上書きしない
+	names := map[string]*string{
+		"#id":      aws.String("id"),
+		"#A":       aws.String("isActive"),
+		"#updated": aws.String("updated"),
+	}
+	values := map[string]*dynamodb.AttributeValue{
+		":a":       {BOOL: aws.Bool(true)},
+		":updated": {S: aws.String(nowTime)},
+	}
+	expr := "set #updated = :updated"
+	i := 0
+	for name, value := range fields {
+		names["#f"+strconv.Itoa(i)] = aws.String(name)
+		values[":f"+strconv.Itoa(i)] = &dynamodb.AttributeValue{S: value}
+		expr += fmt.Sprintf(", #f%d = :f%d", i, i)
+		i++
+	}
+	expr += " " + common.VersionIncrement(names, values)
+	cond := "attribute_exists(#id) AND #A = :a AND " + common.VersionCondition(current.Version, names, values)
+
+	result, err := s.db.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName: aws.String(s.tables.Recruits),
+		Key: map[string]*dynamodb.AttributeValue{
+			"id": {
+				N: aws.String(vars["id"]),
+			},
+		},
+		ConditionExpression:       aws.String(cond),
+		UpdateExpression:          aws.String(expr),
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
+		ReturnValues:              aws.String("ALL_NEW"),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			common.WriteError(w, http.StatusPreconditionFailed, errVersionConflict.Error())
+			return
+		}
+		fmt.Println("Got error calling UpdateItem:")
+		fmt.Println(err.Error())
+		common.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var resRecruit RecruitAllGetResponse
+	dynamodbattribute.UnmarshalMap(result.Attributes, &resRecruit)
+
+	// 定員の変更を統計に反映する
+	if reqUpdate.TotalMember != nil {
+		before, _ := strconv.Atoi(aws.StringValue(current.TotalMember))
+		after, _ := strconv.Atoi(*reqUpdate.TotalMember)
+		if after != before {
+			s.AddStats(map[string]int{common.StatRecruitsCapacity: after - before})
+		}
+	}
+
+	j, _ := json.Marshal(resRecruit)
+	w.Header().Set("ETag", common.ETag(resRecruit.Version))
+	w.Write(j)
+
+	// 変更値のログ
+	fmt.Println(string(j))
+}
@@ -0,0 +1,215 @@
+package recruit
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/gorilla/mux"
+	"github.com/hew-team1/all-api-dev/common"
+	"github.com/hew-team1/all-api-dev/webhook"
+)
+
+const (
+	defaultDeliveryLimit = 20
+	maxDeliveryLimit     = 100
+)
+
+// ==================== Webhook ====================
+// recruitIdを指定した場合はそのボード、省略した場合は自分が作成した全てのボードのイベントを送る
+type WebhookCreateRequest struct {
+	Url       *string  `json:"url"`
+	Events    []string `json:"events"`
+	RecruitId *int     `json:"recruitId"`
+}
+
+func (s *Server) WebhookCreate(w http.ResponseWriter, r *http.Request) {
+	uid := r.Header.Get("uid")
+	if uid == "" {
+		common.WriteError(w, http.StatusUnauthorized, "uid header is required")
+		return
+	}
+	if err := s.CheckActiveUser(uid); err != nil {
+		WriteUserCheckError(w, err)
+		return
+	}
+
+	var reqHook WebhookCreateRequest
+	if err := json.Unmarshal(common.StreamToByte(r.Body), &reqHook); err != nil {
+		common.WriteError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if reqHook.Url == nil {
+		common.WriteError(w, http.StatusBadRequest, "url is required")
+		return
+	}
+	if err := s.hooks.ValidateURL(*reqHook.Url); err != nil {
+		common.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	events, err := webhook.ValidateEvents(reqHook.Events)
+	if err != nil {
+		common.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// ボードのWebhookは作成者のみ登録できる
+	if reqHook.RecruitId != nil {
+		current, err := s.recruitForUpdate(strconv.Itoa(*reqHook.RecruitId))
+		if err != nil {
+			common.WriteError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if current == nil || current.DeletedAt != nil {
+			common.WriteError(w, http.StatusNotFound, "recruit not found")
+			return
+		}
+		if aws.StringValue(current.MasterId) != uid {
+			common.WriteError(w, http.StatusForbidden, "only the recruit owner can add webhooks")
+			return
+		}
+	}
+
+	hooks, err := s.hooks.ListByUid(uid)
+	if err != nil {
+		common.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if len(hooks) >= webhook.MaxPerUser {
+		common.WriteError(w, http.StatusConflict, fmt.Sprintf("at most %d webhooks can be added", webhook.MaxPerUser))
+		return
+	}
+
+	hook := &webhook.Webhook{
+		Uid:       uid,
+		RecruitId: reqHook.RecruitId,
+		Url:       *reqHook.Url,
+		Events:    events,
+	}
+	if err := s.hooks.Create(hook); err != nil {
+		fmt.Println("Got error calling PutItem:")
+		fmt.Println(err.Error())
+		common.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// 署名の鍵はこのレスポンスでのみ返す
+	j, _ := json.Marshal(hook)
+	w.Header().Set("Location", "/webhooks/"+hook.Id)
+	w.WriteHeader(http.StatusCreated)
+	w.Write(j)
+
+	// 作成値のログ（署名の鍵は残さない）
+	fmt.Println("webhook", hook.Id, uid, hook.Scope, hook.Url)
+}
+
+func (s *Server) WebhookAllGet(w http.ResponseWriter, r *http.Request) {
+	uid := r.Header.Get("uid")
+	if uid == "" {
+		common.WriteError(w, http.StatusUnauthorized, "uid header is required")
+		return
+	}
+
+	hooks, err := s.hooks.ListByUid(uid)
+	if err != nil {
+		common.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	for i := range hooks {
+		hooks[i].Secret = ""
+	}
+
+	j, _ := json.Marshal(hooks)
+	w.Write(j)
+
+	// 取得値のログ
+	fmt.Println(string(j))
+}
+
+// uidが登録したidのWebhook（他のユーザーのWebhookは無いものとして扱う）
+func (s *Server) ownWebhook(w http.ResponseWriter, r *http.Request) (*webhook.Webhook, bool) {
+	uid := r.Header.Get("uid")
+	if uid == "" {
+		common.WriteError(w, http.StatusUnauthorized, "uid header is required")
+		return nil, false
+	}
+	hook, err := s.hooks.Get(mux.Vars(r)["id"])
+	if err != nil {
+		common.WriteError(w, http.StatusInternalServerError, err.Error())
+		return nil, false
+	}
+	if hook == nil || hook.Uid != uid {
+		common.WriteError(w, http.StatusNotFound, "webhook not found")
+		return nil, false
+	}
+	return hook, true
+}
+
+func (s *Server) WebhookDelete(w http.ResponseWriter, r *http.Request) {
+	hook, ok := s.ownWebhook(w, r)
+	if !ok {
+		return
+	}
+	if err := s.hooks.Delete(hook.Id); err != nil {
+		common.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+
+	// 削除のログ
+	fmt.Println("delete webhook", hook.Uid, hook.Id)
+}
+
+// 試験用の Ping を1回だけ送り、送信結果を返す
+func (s *Server) WebhookTest(w http.ResponseWriter, r *http.Request) {
+	hook, ok := s.ownWebhook(w, r)
+	if !ok {
+		return
+	}
+	if err := s.CheckActiveUser(hook.Uid); err != nil {
+		WriteUserCheckError(w, err)
+		return
+	}
+
+	delivery, err := s.hooks.Test(hook)
+	if err != nil {
+		common.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	j, _ := json.Marshal(delivery)
+	w.Write(j)
+
+	// 送信結果のログ
+	fmt.Println(string(j))
+}
+
+func (s *Server) WebhookDeliveryAllGet(w http.ResponseWriter, r *http.Request) {
+	hook, ok := s.ownWebhook(w, r)
+	if !ok {
+		return
+	}
+	limit := defaultDeliveryLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxDeliveryLimit {
+			common.WriteError(w, http.StatusBadRequest, fmt.Sprintf("limit must be 1 to %d", maxDeliveryLimit))
+			return
+		}
+		limit = n
+	}
+
+	deliveries, err := s.hooks.Deliveries(hook.Id, limit)
+	if err != nil {
+		common.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	j, _ := json.Marshal(deliveries)
+	w.Write(j)
+
+	// 取得値のログ
+	fmt.Println(string(j))
+}
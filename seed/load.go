@@ -0,0 +1,119 @@
+package seed
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	adminuser "github.com/hew-team1/all-api-dev/admin/end_user"
+	"github.com/hew-team1/all-api-dev/common"
+	"github.com/hew-team1/all-api-dev/connpass"
+	enduser "github.com/hew-team1/all-api-dev/end_user"
+	"github.com/hew-team1/all-api-dev/recruit"
+)
+
+// 生成したデータをDynamoDBに登録する
+//
+// 件数が多くても速く登録できるよう、各サービスと同じ形の項目をBatchWriteItemで並列に書き込み、
+// Recruitsの連番と統計のカウンターは最後にまとめて更新する
+type Loader struct {
+	db      *dynamodb.DynamoDB
+	cfg     *common.Config
+	tables  common.Tables
+	workers int
+}
+
+func NewLoader(db *dynamodb.DynamoDB, cfg *common.Config, workers int) *Loader {
+	return &Loader{
+		db:      db,
+		cfg:     cfg,
+		tables:  cfg.Tables,
+		workers: workers,
+	}
+}
+
+func (l *Loader) Load(data *Data) error {
+	// ユーザーとメールアドレスの使用者
+	requests := []common.PutRequest{}
+	for _, user := range data.Users {
+		av, err := dynamodbattribute.MarshalMap(user)
+		if err != nil {
+			return err
+		}
+		requests = append(requests,
+			common.PutRequest{Table: l.tables.EndUsers, Item: av},
+			common.PutRequest{Table: l.tables.UserEmails, Item: map[string]*dynamodb.AttributeValue{
+				"email": {S: aws.String(enduser.NormalizeEmail(*user.Email))},
+				"uid":   {S: user.Uid},
+			}},
+		)
+	}
+	if err := common.BatchPut(l.db, requests, l.workers); err != nil {
+		return err
+	}
+	fmt.Println("seed: users", len(data.Users))
+
+	// ボードの連番をまとめて確保する
+	if len(data.Recruits) > 0 {
+		last, err := recruit.ReserveIDs(l.db, l.tables.AtomicCounter, recruit.RecruitCountKey, len(data.Recruits))
+		if err != nil {
+			return err
+		}
+		requests = requests[:0]
+		for i := range data.Recruits {
+			id := last - len(data.Recruits) + 1 + i
+			data.Recruits[i].Id = &id
+			av, err := dynamodbattribute.MarshalMap(data.Recruits[i])
+			if err != nil {
+				return err
+			}
+			requests = append(requests,
+				common.PutRequest{Table: l.tables.Recruits, Item: av},
+				common.PutRequest{Table: l.tables.RecruitOwners, Item: map[string]*dynamodb.AttributeValue{
+					"recruitId": {N: aws.String(strconv.Itoa(id))},
+					"uid":       {S: data.Recruits[i].MasterId},
+					"created":   {S: data.Recruits[i].Created},
+				}},
+			)
+			for _, member := range data.Recruits[i].Members {
+				requests = append(requests, common.PutRequest{Table: l.tables.Memberships, Item: map[string]*dynamodb.AttributeValue{
+					"recruitId": {N: aws.String(strconv.Itoa(id))},
+					"uid":       {S: member.Uid},
+					"position":  {S: member.Position},
+					"joinedAt":  {S: data.Recruits[i].Created},
+				}})
+			}
+		}
+		if err := common.BatchPut(l.db, requests, l.workers); err != nil {
+			return err
+		}
+	}
+	fmt.Println("seed: recruits", len(data.Recruits))
+
+	// 統計のカウンターを数え直す
+	counts, err := adminuser.NewServer(l.db, nil, l.cfg).RebuildStats()
+	if err != nil {
+		return err
+	}
+	fmt.Println("seed: stats", len(counts), "counters")
+	return nil
+}
+
+// ==================== Events ====================
+// eventsをconnpassのAPIと同じ形でpathに書き込む（CONNPASS_EVENTS_FILE で読み込む）
+func WriteEvents(path string, events []connpass.ConnpassEvent) error {
+	j, err := json.MarshalIndent(connpass.ConnpassApi{
+		ResultsReturned:  len(events),
+		Events:           events,
+		ResultsStart:     1,
+		ResultsAvailable: len(events),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, j, 0644)
+}
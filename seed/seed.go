@@ -0,0 +1,220 @@
+// ローカル開発・性能検証用のデータの生成
+//
+// 同じ Seed と Base からは同じデータが生成される
+package seed
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/hew-team1/all-api-dev/common"
+	"github.com/hew-team1/all-api-dev/connpass"
+	enduser "github.com/hew-team1/all-api-dev/end_user"
+	"github.com/hew-team1/all-api-dev/recruit"
+)
+
+var jst = time.FixedZone("Asia/Tokyo", 9*60*60)
+
+// 生成する件数など
+type Options struct {
+	Seed     int64
+	Users    int
+	Recruits int
+	Events   int
+	// 日付の基準日（登録日は基準日までの1年間、イベントは基準日の前後）
+	Base time.Time
+}
+
+// 生成したデータ（RecruitsのIdは登録時に採番する）
+type Data struct {
+	Users    []enduser.UserProfile
+	Recruits []recruit.RecruitsCreateRequest
+	Events   []connpass.ConnpassEvent
+}
+
+type generator struct {
+	rand *rand.Rand
+	opts Options
+}
+
+func Generate(opts Options) *Data {
+	g := &generator{
+		rand: rand.New(rand.NewSource(opts.Seed)),
+		opts: opts,
+	}
+	data := &Data{}
+	for i := 0; i < opts.Events; i++ {
+		data.Events = append(data.Events, g.event(i))
+	}
+	// connpassのAPIと同じく開催日時の新しい順
+	sort.SliceStable(data.Events, func(i, j int) bool {
+		return data.Events[i].StartedAt.After(data.Events[j].StartedAt)
+	})
+
+	for i := 0; i < opts.Users; i++ {
+		data.Users = append(data.Users, g.user(i))
+	}
+	if len(data.Users) > 0 && len(data.Events) > 0 {
+		for i := 0; i < opts.Recruits; i++ {
+			data.Recruits = append(data.Recruits, g.recruit(data.Users, data.Events))
+		}
+	}
+	return data
+}
+
+func (g *generator) pick(list []string) string {
+	return list[g.rand.Intn(len(list))]
+}
+
+// 基準日の前days日以内の日時
+func (g *generator) before(days int) time.Time {
+	return g.opts.Base.Add(-time.Duration(g.rand.Int63n(int64(days) * 24 * int64(time.Hour))))
+}
+
+func format(t time.Time) string {
+	return t.In(jst).Format("2006-01-02 15:04")
+}
+
+const uidChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// Firebaseのuidと同じ28文字
+func (g *generator) uid() string {
+	b := make([]byte, 28)
+	for i := range b {
+		b[i] = uidChars[g.rand.Intn(len(uidChars))]
+	}
+	return string(b)
+}
+
+// ==================== User ====================
+func (g *generator) user(i int) enduser.UserProfile {
+	family := familyNames[g.rand.Intn(len(familyNames))]
+	given := givenNames[g.rand.Intn(len(givenNames))]
+	handle := given.romaji + "_" + family.romaji[:1] + strconv.Itoa(i+1)
+
+	userSkills := []common.Skill{}
+	for _, n := range g.rand.Perm(len(skills))[:1+g.rand.Intn(5)] {
+		level := 1 + g.rand.Intn(5)
+		userSkills = append(userSkills, common.Skill{Name: aws.String(skills[n]), Level: &level})
+	}
+	userPositions := []string{}
+	for _, n := range g.rand.Perm(len(positions))[:1+g.rand.Intn(2)] {
+		userPositions = append(userPositions, positions[n])
+	}
+
+	created := g.before(365)
+	updated := created.Add(time.Duration(g.rand.Int63n(int64(g.opts.Base.Sub(created)) + 1)))
+	user := enduser.UserProfile{
+		Profile: common.Profile{
+			Uid:         aws.String(g.uid()),
+			Name:        aws.String(family.kanji + " " + given.kanji),
+			DisplayName: aws.String(handle),
+			Bio:         aws.String(fmt.Sprintf(g.pick(bios), *userSkills[0].Name)),
+			Skills:      userSkills,
+			Positions:   userPositions,
+		},
+		Email:   aws.String(fmt.Sprintf("%s.%s%d@example.com", given.romaji, family.romaji, i+1)),
+		Created: aws.String(format(created)),
+		Updated: aws.String(format(updated)),
+		// 一部のユーザーは停止中にする
+		IsActive: g.rand.Intn(100) >= 3,
+	}
+	if g.rand.Intn(2) == 0 {
+		user.GithubUrl = aws.String("https://github.com/" + strings.Replace(handle, "_", "-", -1))
+	}
+	return user
+}
+
+// ==================== Event ====================
+func (g *generator) event(i int) connpass.ConnpassEvent {
+	// 基準日の30日前から90日後の10時開始
+	day := g.opts.Base.In(jst).AddDate(0, 0, g.rand.Intn(120)-30)
+	started := time.Date(day.Year(), day.Month(), day.Day(), 10, 0, 0, 0, jst)
+	ended := time.Date(day.Year(), day.Month(), day.Day()+g.rand.Intn(3), 18, 0, 0, 0, jst)
+	place := places[g.rand.Intn(len(places))]
+	organizer := g.pick(organizers)
+	limit := 20 + 10*g.rand.Intn(10)
+
+	event := connpass.ConnpassEvent{
+		EventID:          200000 + i,
+		Title:            fmt.Sprintf("%s%s%s %d", g.pick(eventPrefixes), g.pick(eventThemes), g.pick(eventKinds), started.Year()),
+		Catch:            "チームでプロダクトを作り上げよう",
+		EventType:        "participation",
+		OwnerNickname:    "guildhack_" + strconv.Itoa(g.rand.Intn(50)),
+		OwnerDisplayName: organizer,
+		HashTag:          "guildhack",
+		StartedAt:        started,
+		EndedAt:          ended,
+		UpdatedAt:        started.AddDate(0, 0, -30),
+		Limit:            limit,
+		Accepted:         g.rand.Intn(limit + 1),
+		Waiting:          g.rand.Intn(5),
+		Place:            place.place,
+		Address:          place.address,
+	}
+	event.EventURL = fmt.Sprintf("https://example.connpass.com/event/%d/", event.EventID)
+	event.Series.ID = 1000 + g.rand.Intn(len(organizers))
+	event.Series.Title = organizer
+	event.Series.URL = fmt.Sprintf("https://example.connpass.com/series/%d/", event.Series.ID)
+	return event
+}
+
+// ==================== Recruit ====================
+func (g *generator) recruit(users []enduser.UserProfile, events []connpass.ConnpassEvent) recruit.RecruitsCreateRequest {
+	master := users[g.rand.Intn(len(users))]
+	event := events[g.rand.Intn(len(events))]
+	total := 3 + g.rand.Intn(4)
+	days := int(event.EndedAt.Sub(event.StartedAt).Hours()/24) + 1
+	position := g.pick(positions)
+
+	created := g.before(60)
+	rec := recruit.RecruitsCreateRequest{
+		MasterId:    master.Uid,
+		Title:       aws.String(event.Title + g.pick(recruitSuffixes)),
+		EventDay:    aws.String(event.StartedAt.Format("2006/01/02")),
+		Day:         aws.String(strconv.Itoa(days)),
+		Organizer:   aws.String(event.OwnerDisplayName),
+		Commit:      aws.String(g.pick(commits)),
+		Beginner:    aws.String(g.pick(beginners)),
+		Message:     aws.String(g.message()),
+		SlackUrl:    aws.String(fmt.Sprintf("https://join.slack.com/t/guildhack-%d/shared_invite/example", event.EventID)),
+		TotalMember: aws.String(strconv.Itoa(total)),
+		Position:    aws.String(position),
+		Reword:      aws.String(g.pick(rewords)),
+		Created:     aws.String(format(created)),
+		Updated:     aws.String(format(created)),
+		IsActive:    master.IsActive,
+		Version:     1,
+		Members: []recruit.RecruitsMembers{
+			{Uid: master.Uid, Position: aws.String(position)},
+		},
+	}
+
+	// 募集者以外のメンバー（定員まで、同じユーザーは1度のみ）
+	joined := map[string]bool{*master.Uid: true}
+	for n := g.rand.Intn(total); n > 0; n-- {
+		member := users[g.rand.Intn(len(users))]
+		if joined[*member.Uid] || !member.IsActive {
+			continue
+		}
+		joined[*member.Uid] = true
+		rec.Members = append(rec.Members, recruit.RecruitsMembers{
+			Uid:      member.Uid,
+			Position: aws.String(g.pick(positions)),
+		})
+	}
+	return rec
+}
+
+func (g *generator) message() string {
+	message := g.pick(messages)
+	if strings.Contains(message, "%s") {
+		message = fmt.Sprintf(message, g.pick(skills))
+	}
+	return message
+}
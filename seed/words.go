@@ -0,0 +1,86 @@
+package seed
+
+// 漢字とローマ字（メールアドレス・ハンドル名に使う）
+type word struct {
+	kanji  string
+	romaji string
+}
+
+var familyNames = []word{
+	{"佐藤", "sato"}, {"鈴木", "suzuki"}, {"高橋", "takahashi"}, {"田中", "tanaka"}, {"伊藤", "ito"},
+	{"渡辺", "watanabe"}, {"山本", "yamamoto"}, {"中村", "nakamura"}, {"小林", "kobayashi"}, {"加藤", "kato"},
+	{"吉田", "yoshida"}, {"山田", "yamada"}, {"佐々木", "sasaki"}, {"山口", "yamaguchi"}, {"松本", "matsumoto"},
+	{"井上", "inoue"}, {"木村", "kimura"}, {"林", "hayashi"}, {"斎藤", "saito"}, {"清水", "shimizu"},
+	{"山崎", "yamazaki"}, {"森", "mori"}, {"池田", "ikeda"}, {"橋本", "hashimoto"}, {"阿部", "abe"},
+}
+
+var givenNames = []word{
+	{"翔太", "shota"}, {"蓮", "ren"}, {"大翔", "hiroto"}, {"悠真", "yuma"}, {"陽翔", "haruto"},
+	{"湊", "minato"}, {"健太", "kenta"}, {"拓海", "takumi"}, {"陸", "riku"}, {"大輝", "daiki"},
+	{"結衣", "yui"}, {"陽菜", "hina"}, {"さくら", "sakura"}, {"美咲", "misaki"}, {"葵", "aoi"},
+	{"凛", "rin"}, {"花子", "hanako"}, {"真央", "mao"}, {"彩", "aya"}, {"七海", "nanami"},
+	{"颯", "hayate"}, {"優斗", "yuto"}, {"芽依", "mei"}, {"莉子", "riko"}, {"智也", "tomoya"},
+}
+
+// ボードの募集ポジション（統計のポジションと同じ）
+var positions = []string{"frontend", "backend", "infra"}
+
+var skills = []string{
+	"Go", "TypeScript", "JavaScript", "React", "Vue.js", "Next.js", "Nuxt.js", "Flutter", "Swift", "Kotlin",
+	"Python", "Ruby on Rails", "Laravel", "Docker", "Kubernetes", "AWS", "GCP", "Firebase", "Unity", "Figma",
+	"PostgreSQL", "MySQL", "DynamoDB", "Terraform", "GraphQL",
+}
+
+var bios = []string{
+	"%sを中心に開発しています。ハッカソンで新しい技術を試すのが好きです。",
+	"普段は%sを書いています。初心者ですがよろしくお願いします！",
+	"専門学校で%sを勉強中です。チーム開発の経験を積みたいです。",
+	"%sが得意です。デザインもできるので気軽に声をかけてください。",
+	"社会人エンジニアです。週末は%sで個人開発をしています。",
+}
+
+// ==================== Event ====================
+var eventPrefixes = []string{
+	"春の", "夏の", "秋の", "冬の", "オンライン", "学生向け", "初心者歓迎", "週末", "48時間", "地方創生",
+}
+
+var eventThemes = []string{
+	"防災", "観光", "ヘルスケア", "教育", "農業", "フィンテック", "ゲーム", "IoT", "AI", "SDGs",
+}
+
+var eventKinds = []string{"ハッカソン", "Hackathon", "ハックデー", "Hack Night"}
+
+var places = []struct {
+	place   string
+	address string
+}{
+	{"オンライン", "オンライン"},
+	{"HAL東京", "東京都新宿区西新宿1-7-3"},
+	{"HAL大阪", "大阪府大阪市北区梅田3-3-1"},
+	{"HAL名古屋", "愛知県名古屋市中村区名駅4-27-1"},
+	{"福岡市エンジニアカフェ", "福岡県福岡市中央区天神1-15-30"},
+	{"札幌駅前ビジネスセンター", "北海道札幌市北区北7条西2-20"},
+}
+
+var organizers = []string{
+	"GuildHack運営事務局", "ハッカソン実行委員会", "学生エンジニア会", "地域ITコミュニティ", "テック勉強会",
+}
+
+// ==================== Recruit ====================
+var recruitSuffixes = []string{
+	" チームメンバー募集", " 一緒に出ませんか", " 入賞を目指すメンバー募集", " 初参加の仲間を募集", " もくもく参加者募集",
+}
+
+var commits = []string{"入賞を目指す", "楽しく参加", "最後までやり切る", "学びを重視"}
+
+var beginners = []string{"歓迎", "経験者のみ", "相談可"}
+
+var rewords = []string{"賞金は山分け", "なし", "打ち上げをおごります", "相談して決める"}
+
+var messages = []string{
+	"アイデアは一緒に考えましょう。気軽に参加してください！",
+	"%sを使ったアプリを作る予定です。",
+	"Slackで事前に打ち合わせをしてから参加します。",
+	"初めてのハッカソンなので、一緒に楽しめる方を募集しています。",
+	"%sの経験がある方がいると心強いです。",
+}
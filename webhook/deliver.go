@@ -0,0 +1,283 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/hew-team1/all-api-dev/common"
+)
+
+// 送信するリクエストのヘッダー
+const (
+	HeaderEvent     = "X-GuildHack-Event"
+	HeaderDelivery  = "X-GuildHack-Delivery"
+	HeaderTimestamp = "X-GuildHack-Timestamp"
+	HeaderSignature = "X-GuildHack-Signature"
+)
+
+// 送信結果に残すレスポンスの本文の長さ
+const maxResponseBody = 512
+
+// 送信するJSON
+type Payload struct {
+	// 送信ごとのid（再送しても変わらない）
+	Id        string `json:"id"`
+	Type      string `json:"type"`
+	WebhookId string `json:"webhookId"`
+	// 元になった変更のid（同じ変更が2回送られた場合の重複の判定に使う）
+	EventId string      `json:"eventId"`
+	Created string      `json:"created"`
+	Data    interface{} `json:"data"`
+}
+
+// WebhookDeliveriesの項目
+type Delivery struct {
+	WebhookId  string `json:"webhookId" dynamodbav:"webhookId"`
+	DeliveryId string `json:"deliveryId" dynamodbav:"deliveryId"`
+	Event      string `json:"event" dynamodbav:"event"`
+	EventId    string `json:"eventId" dynamodbav:"eventId"`
+	Url        string `json:"url" dynamodbav:"url"`
+	Success    bool   `json:"success" dynamodbav:"success"`
+	// 最後の試行の結果（接続できなかった場合は0）
+	StatusCode   int    `json:"statusCode" dynamodbav:"statusCode"`
+	ResponseBody string `json:"responseBody,omitempty" dynamodbav:"responseBody,omitempty"`
+	Error        string `json:"error,omitempty" dynamodbav:"error,omitempty"`
+	Attempts     int    `json:"attempts" dynamodbav:"attempts"`
+	DurationMs   int64  `json:"durationMs" dynamodbav:"durationMs"`
+	Created      string `json:"created" dynamodbav:"created"`
+	ExpiresAt    int64  `json:"-" dynamodbav:"expiresAt"`
+}
+
+// 署名（"<timestamp>.<本文>" のHMAC-SHA256）
+//
+// 受信側は同じ値を計算し、X-GuildHack-Signature の "sha256=" の後と比べる
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// ==================== Deliver ====================
+// eventTypeのdataを送り、結果を記録する（失敗した場合は設定の回数まで再送する）
+func (h *Hooks) Deliver(w *Webhook, eventType, eventId string, data interface{}) (*Delivery, error) {
+	return h.deliver(w, eventType, eventId, data, h.attempts)
+}
+
+// 試験送信（再送せず、結果をすぐに返す）
+func (h *Hooks) Test(w *Webhook) (*Delivery, error) {
+	data := map[string]string{
+		"message": "webhook test",
+	}
+	if w.RecruitId != nil {
+		data["recruitId"] = strconv.Itoa(*w.RecruitId)
+	}
+	return h.deliver(w, EventPing, "", data, 1)
+}
+
+func (h *Hooks) deliver(w *Webhook, eventType, eventId string, data interface{}, attempts int) (*Delivery, error) {
+	now := time.Now()
+	nowTime := now.UTC().In(
+		time.FixedZone("Asia/Tokyo", 9*60*60),
+	).Format("2006-01-02 15:04:05")
+
+	// 送信順に並ぶid
+	suffix, err := common.RandomHex(4)
+	if err != nil {
+		return nil, err
+	}
+	deliveryId := fmt.Sprintf("%019d-%s", now.UnixNano(), suffix)
+	body, err := json.Marshal(Payload{
+		Id:        deliveryId,
+		Type:      eventType,
+		WebhookId: w.Id,
+		EventId:   eventId,
+		Created:   nowTime,
+		Data:      data,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Delivery{
+		WebhookId:  w.Id,
+		DeliveryId: deliveryId,
+		Event:      eventType,
+		EventId:    eventId,
+		Url:        w.Url,
+		Created:    nowTime,
+		ExpiresAt:  now.Add(deliveryRetention).Unix(),
+	}
+	for attempt := 1; attempt <= attempts; attempt++ {
+		d.Attempts = attempt
+		d.StatusCode, d.ResponseBody, err = h.sender.post(w, eventType, deliveryId, body)
+		d.Success = err == nil && d.StatusCode >= 200 && d.StatusCode < 300
+		switch {
+		case d.Success:
+			d.Error = ""
+		case err != nil:
+			d.Error = err.Error()
+		default:
+			d.Error = fmt.Sprintf("unexpected status %d", d.StatusCode)
+		}
+		d.DurationMs = time.Since(now).Milliseconds()
+
+		// 試行ごとに記録する（再送の途中で止まっても、それまでの結果が残る）
+		// 記録に失敗しても送信は済んでいるため、ログに残すのみ
+		if err := h.saveDelivery(d); err != nil {
+			fmt.Println("Got error saving webhook delivery:")
+			fmt.Println(err.Error())
+		}
+		if d.Success || !retryable(d.StatusCode, err) {
+			break
+		}
+		if attempt < attempts {
+			time.Sleep(time.Duration(attempt) * h.backoff)
+		}
+	}
+	return d, nil
+}
+
+// 接続できなかった場合と、429・5xxのみ再送する（それ以外は再送しても変わらない）
+func retryable(status int, err error) bool {
+	if err != nil {
+		return true
+	}
+	return status == http.StatusTooManyRequests || status >= 500
+}
+
+func (h *Hooks) saveDelivery(d *Delivery) error {
+	av, err := dynamodbattribute.MarshalMap(d)
+	if err != nil {
+		return err
+	}
+	_, err = h.db.PutItem(&dynamodb.PutItemInput{
+		TableName: aws.String(h.tables.WebhookDeliveries),
+		Item:      av,
+	})
+	return err
+}
+
+// webhookIdの送信結果（新しい順にlimit件）
+func (h *Hooks) Deliveries(webhookId string, limit int) ([]Delivery, error) {
+	result, err := h.db.Query(&dynamodb.QueryInput{
+		TableName:              aws.String(h.tables.WebhookDeliveries),
+		KeyConditionExpression: aws.String("#id = :id"),
+		ExpressionAttributeNames: map[string]*string{
+			"#id": aws.String("webhookId"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":id": {S: aws.String(webhookId)},
+		},
+		ScanIndexForward: aws.Bool(false),
+		Limit:            aws.Int64(int64(limit)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	deliveries := []Delivery{}
+	if err := dynamodbattribute.UnmarshalListOfMaps(result.Items, &deliveries); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// ==================== HTTP ====================
+type sender struct {
+	client *http.Client
+}
+
+// リダイレクトには従わず、許可しない場合はプライベートなアドレスに接続しない
+func newSender(timeout time.Duration, allowPrivate bool) *sender {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowPrivate {
+		// 名前解決した後のアドレスを確かめる（登録後にDNSを変えられても内部に送らない）
+		dialer.Control = func(network, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || isPrivate(ip) {
+				return fmt.Errorf("%s is a private address", host)
+			}
+			return nil
+		}
+	}
+	return &sender{
+		client: &http.Client{
+			Timeout: timeout,
+			Transport: &http.Transport{
+				DialContext:         dialer.DialContext,
+				TLSHandshakeTimeout: timeout,
+				MaxIdleConns:        10,
+				IdleConnTimeout:     90 * time.Second,
+			},
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+func (s *sender) post(w *Webhook, eventType, deliveryId string, body []byte) (int, string, error) {
+	req, err := http.NewRequest(http.MethodPost, w.Url, bytes.NewReader(body))
+	if err != nil {
+		return 0, "", err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "GuildHack-Webhook/1.0")
+	req.Header.Set(HeaderEvent, eventType)
+	req.Header.Set(HeaderDelivery, deliveryId)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(w.Secret, timestamp, body))
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer res.Body.Close()
+	b, _ := ioutil.ReadAll(io.LimitReader(res.Body, maxResponseBody))
+	// 接続を再利用できるように残りを読み捨てる
+	io.Copy(ioutil.Discard, io.LimitReader(res.Body, 64*1024))
+	return res.StatusCode, string(b), nil
+}
+
+// ループバック・プライベート・リンクローカルなどのアドレス
+var privateNets = func() []*net.IPNet {
+	nets := []*net.IPNet{}
+	for _, cidr := range []string{
+		"0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10", "127.0.0.0/8", "169.254.0.0/16",
+		"172.16.0.0/12", "192.168.0.0/16", "::1/128", "fc00::/7", "fe80::/10",
+	} {
+		_, n, _ := net.ParseCIDR(cidr)
+		nets = append(nets, n)
+	}
+	return nets
+}()
+
+func isPrivate(ip net.IP) bool {
+	if ip.IsUnspecified() || ip.IsMulticast() {
+		return true
+	}
+	for _, n := range privateNets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
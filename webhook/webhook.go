@@ -0,0 +1,259 @@
+// ボード・ユーザーごとのWebhookの登録と、署名付きのJSONの送信
+//
+// 送信はworkerのwebhookハンドラー（events）と、RecruitAPIの試験送信から行う
+package webhook
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/hew-team1/all-api-dev/common"
+)
+
+const (
+	// ユーザーごとに登録できる数
+	MaxPerUser = 10
+	// 送信結果を残す期間
+	deliveryRetention = 14 * 24 * time.Hour
+	maxURLLength      = 2048
+)
+
+// 登録できるイベント（events.TypeMemberJoined などと同じ名前）
+var Events = []string{"MemberJoined", "BoardFull", "BoardClosed"}
+
+// 試験送信のイベント
+const EventPing = "Ping"
+
+// Webhooksの項目
+type Webhook struct {
+	Id  string `json:"id" dynamodbav:"id"`
+	Uid string `json:"uid" dynamodbav:"uid"`
+	// 送信先を探すためのキー（ScopeRecruit・ScopeUser）
+	Scope string `json:"-" dynamodbav:"scope"`
+	// ボードのWebhookのみ（無い場合は登録したユーザーの全てのボード）
+	RecruitId *int     `json:"recruitId,omitempty" dynamodbav:"recruitId,omitempty"`
+	Url       string   `json:"url" dynamodbav:"url"`
+	Events    []string `json:"events" dynamodbav:"events"`
+	// 署名の鍵（登録時のレスポンスのみ返す）
+	Secret  string `json:"secret,omitempty" dynamodbav:"secret"`
+	Created string `json:"created" dynamodbav:"created"`
+}
+
+func ScopeRecruit(id int) string {
+	return "recruit:" + strconv.Itoa(id)
+}
+
+func ScopeUser(uid string) string {
+	return "user:" + uid
+}
+
+// eventTypeを送るか
+func (w *Webhook) Subscribes(eventType string) bool {
+	for _, e := range w.Events {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+type Hooks struct {
+	db       *dynamodb.DynamoDB
+	tables   common.Tables
+	sender   *sender
+	attempts int
+	// 再送までの間隔（n回目の失敗の後は n*backoff）
+	backoff      time.Duration
+	allowPrivate bool
+}
+
+func New(db *dynamodb.DynamoDB, cfg *common.Config) *Hooks {
+	timeout := time.Duration(cfg.Webhooks.TimeoutSeconds) * time.Second
+	return &Hooks{
+		db:           db,
+		tables:       cfg.Tables,
+		sender:       newSender(timeout, cfg.Webhooks.AllowPrivate),
+		attempts:     cfg.Webhooks.Attempts,
+		backoff:      time.Second,
+		allowPrivate: cfg.Webhooks.AllowPrivate,
+	}
+}
+
+// ==================== Validate ====================
+// 送信先のURL（https のみ、プライベートなアドレスは許可した場合のみ）
+func (h *Hooks) ValidateURL(raw string) error {
+	if len(raw) > maxURLLength {
+		return fmt.Errorf("url must be at most %d characters", maxURLLength)
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("url must be an absolute URL")
+	}
+	if u.User != nil {
+		return fmt.Errorf("url must not contain credentials")
+	}
+	if u.Scheme != "https" && !(h.allowPrivate && u.Scheme == "http") {
+		return fmt.Errorf("url must use https")
+	}
+	if h.allowPrivate {
+		return nil
+	}
+	// 名前解決後のアドレスは送信時にも確かめる
+	host := strings.ToLower(u.Hostname())
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return fmt.Errorf("url must not point to a private address")
+	}
+	if ip := net.ParseIP(host); ip != nil && isPrivate(ip) {
+		return fmt.Errorf("url must not point to a private address")
+	}
+	return nil
+}
+
+// 登録できるイベントか（空の場合は全てのイベント）
+func ValidateEvents(events []string) ([]string, error) {
+	if len(events) == 0 {
+		return append([]string{}, Events...), nil
+	}
+	res := []string{}
+	seen := map[string]bool{}
+	for _, e := range events {
+		known := false
+		for _, name := range Events {
+			known = known || name == e
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown event %q (available: %s)", e, strings.Join(Events, ", "))
+		}
+		if !seen[e] {
+			seen[e] = true
+			res = append(res, e)
+		}
+	}
+	return res, nil
+}
+
+// ==================== Store ====================
+// 登録する（idと署名の鍵はここで作る）
+func (h *Hooks) Create(w *Webhook) error {
+	id, err := common.RandomHex(16)
+	if err != nil {
+		return err
+	}
+	secret, err := common.RandomHex(32)
+	if err != nil {
+		return err
+	}
+	w.Id = id
+	w.Secret = "whsec_" + secret
+	w.Created = time.Now().UTC().In(
+		time.FixedZone("Asia/Tokyo", 9*60*60),
+	).Format("2006-01-02 15:04")
+	w.Scope = ScopeUser(w.Uid)
+	if w.RecruitId != nil {
+		w.Scope = ScopeRecruit(*w.RecruitId)
+	}
+
+	av, err := dynamodbattribute.MarshalMap(w)
+	if err != nil {
+		return err
+	}
+	_, err = h.db.PutItem(&dynamodb.PutItemInput{
+		TableName:           aws.String(h.tables.Webhooks),
+		Item:                av,
+		ConditionExpression: aws.String("attribute_not_exists(#id)"),
+		ExpressionAttributeNames: map[string]*string{
+			"#id": aws.String("id"),
+		},
+	})
+	return err
+}
+
+// idのWebhook（無い場合はnil）
+func (h *Hooks) Get(id string) (*Webhook, error) {
+	result, err := h.db.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String(h.tables.Webhooks),
+		Key: map[string]*dynamodb.AttributeValue{
+			"id": {S: aws.String(id)},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.Item == nil {
+		return nil, nil
+	}
+	var w Webhook
+	if err := dynamodbattribute.UnmarshalMap(result.Item, &w); err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+func (h *Hooks) Delete(id string) error {
+	_, err := h.db.DeleteItem(&dynamodb.DeleteItemInput{
+		TableName: aws.String(h.tables.Webhooks),
+		Key: map[string]*dynamodb.AttributeValue{
+			"id": {S: aws.String(id)},
+		},
+	})
+	return err
+}
+
+// GSIのkeyがvalueのWebhook
+func (h *Hooks) query(index, key, value string) ([]Webhook, error) {
+	hooks := []Webhook{}
+	var perr error
+	err := h.db.QueryPages(&dynamodb.QueryInput{
+		TableName:              aws.String(h.tables.Webhooks),
+		IndexName:              aws.String(index),
+		KeyConditionExpression: aws.String("#k = :v"),
+		ExpressionAttributeNames: map[string]*string{
+			"#k": aws.String(key),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":v": {S: aws.String(value)},
+		},
+	}, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+		var items []Webhook
+		if perr = dynamodbattribute.UnmarshalListOfMaps(page.Items, &items); perr != nil {
+			return false
+		}
+		hooks = append(hooks, items...)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return hooks, perr
+}
+
+// uidが登録したWebhook
+func (h *Hooks) ListByUid(uid string) ([]Webhook, error) {
+	return h.query("uid-index", "uid", uid)
+}
+
+// ボードのイベントを送るWebhook（ボードのWebhookと、作成者のユーザーのWebhook）
+//
+// 作成者が変わったボードのWebhookは、登録したユーザーが作成者でなくなったため送らない
+func (h *Hooks) Subscribers(recruitId int, masterId, eventType string) ([]Webhook, error) {
+	res := []Webhook{}
+	for _, scope := range []string{ScopeRecruit(recruitId), ScopeUser(masterId)} {
+		hooks, err := h.query("scope-index", "scope", scope)
+		if err != nil {
+			return nil, err
+		}
+		for _, w := range hooks {
+			if w.Uid == masterId && w.Subscribes(eventType) {
+				res = append(res, w)
+			}
+		}
+	}
+	return res, nil
+}